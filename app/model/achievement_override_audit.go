@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// AchievementOverrideAudit records an admin edit of an achievement document
+// made outside the student workflow. The row is written before the edit with
+// the intended changes; Version (and the applied Changes) are filled in once
+// the edit lands, so Version 0 marks an override that was not applied.
+type AchievementOverrideAudit struct {
+	ID            string        `db:"id" json:"id"`
+	AchievementID string        `db:"achievement_id" json:"achievement_id"`
+	ActorID       string        `db:"actor_id" json:"actor_id"`
+	Reason        string        `db:"reason" json:"reason"`
+	Changes       []FieldChange `db:"changes" json:"changes"`
+	Version       int           `db:"version" json:"version"`
+	CreatedAt     time.Time     `db:"created_at" json:"created_at"`
+}
@@ -6,11 +6,12 @@ type AchievementReference struct {
     ID                 string     `db:"id" json:"id"`
     StudentID          string     `db:"student_id" json:"student_id"`
     MongoAchievementID string     `db:"mongo_achievement_id" json:"mongo_achievement_id"`
-    Status             string     `db:"status" json:"status"` // draft/submitted/verified/rejected
+    Status             string     `db:"status" json:"status"` // draft/submitted/revision_requested/verified/rejected/deleted
     SubmittedAt        *time.Time `db:"submitted_at" json:"submitted_at,omitempty"`
     VerifiedAt         *time.Time `db:"verified_at" json:"verified_at,omitempty"`
     VerifiedBy         *string    `db:"verified_by" json:"verified_by,omitempty"`
     RejectionNote      *string    `db:"rejection_note" json:"rejection_note,omitempty"`
+    VerifiedVersion    *int       `db:"verified_version" json:"verified_version,omitempty"` // achievement_versions snapshot the verifier approved
     CreatedAt          time.Time  `db:"created_at" json:"created_at"`
     UpdatedAt          time.Time  `db:"updated_at" json:"updated_at"`
 }
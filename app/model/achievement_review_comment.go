@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// AchievementReviewComment is a reviewer's comment from a revision request,
+// keyed to an achievement field (e.g. "title", "details.rank") or to an
+// attachment. The student resolves comments one by one before resubmitting.
+type AchievementReviewComment struct {
+	ID           string     `db:"id" json:"id"`
+	ReferenceID  string     `db:"reference_id" json:"reference_id"`
+	Field        string     `db:"field" json:"field,omitempty"`
+	AttachmentID string     `db:"attachment_id" json:"attachment_id,omitempty"`
+	Comment      string     `db:"comment" json:"comment"`
+	AuthorID     string     `db:"author_id" json:"author_id"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+	ResolvedAt   *time.Time `db:"resolved_at" json:"resolved_at,omitempty"`
+	ResolvedBy   *string    `db:"resolved_by" json:"resolved_by,omitempty"`
+	Resolution   *string    `db:"resolution" json:"resolution,omitempty"`
+}
+
+// Resolved reports whether the student has addressed the comment.
+func (c AchievementReviewComment) Resolved() bool {
+	return c.ResolvedAt != nil
+}
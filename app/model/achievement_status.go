@@ -0,0 +1,57 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Achievement reference statuses.
+const (
+	StatusDraft             = "draft"
+	StatusSubmitted         = "submitted"
+	StatusRevisionRequested = "revision_requested"
+	StatusVerified          = "verified"
+	StatusRejected          = "rejected"
+	StatusDeleted           = "deleted"
+)
+
+// ErrIllegalTransition is returned for a status change the workflow doesn't allow.
+var ErrIllegalTransition = errors.New("illegal status transition")
+
+// statusTransitions is the verification workflow: the statuses each status
+// may move to. verified and deleted are terminal. revision_requested goes
+// back to submitted once the reviewer's comments are resolved.
+var statusTransitions = map[string][]string{
+	StatusDraft:             {StatusSubmitted, StatusDeleted},
+	StatusSubmitted:         {StatusVerified, StatusRejected, StatusRevisionRequested},
+	StatusRevisionRequested: {StatusSubmitted, StatusDraft},
+	StatusRejected:          {StatusDraft, StatusSubmitted},
+	StatusVerified:          {},
+	StatusDeleted:           {},
+}
+
+// NextStatuses lists the statuses an achievement in from may move to.
+func NextStatuses(from string) []string {
+	return statusTransitions[from]
+}
+
+// CheckStatusTransition reports whether from -> to is allowed, wrapping
+// ErrIllegalTransition when it isn't.
+func CheckStatusTransition(from, to string) error {
+	for _, s := range statusTransitions[from] {
+		if s == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, from, to)
+}
+
+// StudentEditable reports whether the owning student may still edit an
+// achievement in this status (before submission or when sent back).
+func StudentEditable(status string) bool {
+	switch status {
+	case StatusDraft, StatusRejected, StatusRevisionRequested:
+		return true
+	}
+	return false
+}
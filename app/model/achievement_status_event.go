@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// AchievementStatusEvent is one entry of an achievement's append-only status
+// history. FromStatus is empty for the event that created the reference.
+type AchievementStatusEvent struct {
+	ID          string    `db:"id" json:"id"`
+	ReferenceID string    `db:"reference_id" json:"reference_id"`
+	FromStatus  string    `db:"from_status" json:"from_status,omitempty"`
+	ToStatus    string    `db:"to_status" json:"to_status"`
+	ActorID     *string   `db:"actor_id" json:"actor_id,omitempty"`
+	ActorName   string    `db:"-" json:"actor_name,omitempty"`
+	Note        *string   `db:"note" json:"note,omitempty"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
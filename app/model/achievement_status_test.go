@@ -0,0 +1,38 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckStatusTransition(t *testing.T) {
+	allowed := [][2]string{
+		{StatusDraft, StatusSubmitted},
+		{StatusDraft, StatusDeleted},
+		{StatusSubmitted, StatusVerified},
+		{StatusSubmitted, StatusRejected},
+		{StatusSubmitted, StatusRevisionRequested},
+		{StatusRevisionRequested, StatusSubmitted},
+		{StatusRejected, StatusDraft},
+		{StatusRejected, StatusSubmitted},
+	}
+	for _, tr := range allowed {
+		assert.NoError(t, CheckStatusTransition(tr[0], tr[1]), "%s -> %s", tr[0], tr[1])
+	}
+
+	illegal := [][2]string{
+		{StatusDraft, StatusVerified},
+		{StatusRejected, StatusVerified},
+		{StatusRevisionRequested, StatusVerified},
+		{StatusSubmitted, StatusSubmitted},
+		{StatusVerified, StatusRejected},
+		{StatusDeleted, StatusDraft},
+		{"unknown", StatusSubmitted},
+	}
+	for _, tr := range illegal {
+		err := CheckStatusTransition(tr[0], tr[1])
+		assert.True(t, errors.Is(err, ErrIllegalTransition), "%s -> %s", tr[0], tr[1])
+	}
+}
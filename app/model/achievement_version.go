@@ -0,0 +1,29 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AchievementVersion is an immutable snapshot of an achievement document,
+// written on create and after every update. Versions count up from 1 per
+// achievement.
+type AchievementVersion struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	AchievementID string             `bson:"achievementId" json:"achievementId"`
+	Version       int                `bson:"version" json:"version"`
+	Snapshot      Achievement        `bson:"snapshot" json:"snapshot"`
+	Reason        string             `bson:"reason" json:"reason"` // create, update, backfill
+	CreatedBy     string             `bson:"createdBy,omitempty" json:"createdBy,omitempty"`
+	CreatedAt     time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// FieldChange is one difference between two achievement versions. Field is
+// a dotted path ("title", "details.rank"); From/To are absent when the
+// field was added/removed.
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from,omitempty"`
+	To    interface{} `json:"to,omitempty"`
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// APIToken is a named personal access token. Only the sha256 hash of the
+// token is stored; Prefix (first characters) lets owners recognise it.
+type APIToken struct {
+	ID          string     `db:"id" json:"id"`
+	UserID      string     `db:"user_id" json:"user_id"`
+	Name        string     `db:"name" json:"name"`
+	Prefix      string     `db:"token_prefix" json:"prefix"`
+	TokenHash   string     `db:"token_hash" json:"-"`
+	Permissions []string   `db:"permissions" json:"permissions"`
+	ExpiresAt   time.Time  `db:"expires_at" json:"expires_at"`
+	LastUsedAt  *time.Time `db:"last_used_at" json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`
+	CreatedBy   string     `db:"created_by" json:"created_by,omitempty"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+}
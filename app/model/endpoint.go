@@ -0,0 +1,25 @@
+package model
+
+// Endpoint is one registered API route and the permission it requires.
+// Permission is empty for public routes and for routes any authenticated
+// user may call. Routes needing several permissions list them in
+// Permissions instead, with PermissionMode "any" or "all".
+type Endpoint struct {
+	Method         string   `json:"method"`
+	Path           string   `json:"path"`
+	Permission     string   `json:"permission,omitempty"`
+	Permissions    []string `json:"permissions,omitempty"`
+	PermissionMode string   `json:"permission_mode,omitempty"`
+	Public         bool     `json:"public"`
+}
+
+// RequiredPermissions returns every permission the route names.
+func (e Endpoint) RequiredPermissions() []string {
+	if len(e.Permissions) > 0 {
+		return e.Permissions
+	}
+	if e.Permission != "" {
+		return []string{e.Permission}
+	}
+	return nil
+}
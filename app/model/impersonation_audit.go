@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// ImpersonationAudit records an admin acting as another user: the token
+// issuance (Method "IMPERSONATE") and every mutating request made with it.
+type ImpersonationAudit struct {
+	ID        string    `db:"id" json:"id"`
+	ActorID   string    `db:"actor_id" json:"actor_id"`
+	TargetID  string    `db:"target_id" json:"target_id"`
+	TokenID   string    `db:"token_id" json:"token_id"`
+	Method    string    `db:"method" json:"method"`
+	Path      string    `db:"path" json:"path"`
+	Status    int       `db:"status" json:"status"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
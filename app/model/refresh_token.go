@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// RefreshToken is a single rotation of an opaque refresh token.
+// Only the sha256 hash of the token is persisted.
+type RefreshToken struct {
+	ID        string     `db:"id" json:"id"`
+	UserID    string     `db:"user_id" json:"user_id"`
+	FamilyID  string     `db:"family_id" json:"family_id"`
+	TokenHash string     `db:"token_hash" json:"-"`
+	ExpiresAt time.Time  `db:"expires_at" json:"expires_at"`
+	UsedAt    *time.Time `db:"used_at" json:"used_at,omitempty"`
+	RevokedAt *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+}
@@ -3,9 +3,12 @@ package model
 import "time"
 
 type Role struct {
-    ID        string    `db:"id" json:"id"`
-    Name      string    `db:"name" json:"name"`
-    Desc      string    `db:"description" json:"description"`
-    CreatedAt time.Time `db:"created_at" json:"created_at"`
-    UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+    ID          string    `db:"id" json:"id"`
+    Name        string    `db:"name" json:"name"`
+    Desc        string    `db:"description" json:"description"`
+    PermVersion int       `db:"perm_version" json:"perm_version"`
+    MFARequired bool      `db:"mfa_required" json:"mfa_required"`
+    CreatedAt   time.Time `db:"created_at" json:"created_at"`
+    UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+    UserCount   *int      `db:"-" json:"user_count,omitempty"`
 }
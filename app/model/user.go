@@ -3,13 +3,14 @@ package model
 import "time"
 
 type User struct {
-    ID           string    `db:"id" json:"id"`
-    Username     string    `db:"username" json:"username"`
-    Email        string    `db:"email" json:"email"`
-    PasswordHash string    `db:"password_hash" json:"-"`
-    FullName     string    `db:"full_name" json:"full_name"`
-    RoleID       string    `db:"role_id" json:"role_id"`
-    IsActive     bool      `db:"is_active" json:"is_active"`
-    CreatedAt    time.Time `db:"created_at" json:"created_at"`
-    UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+    ID               string    `db:"id" json:"id"`
+    Username         string    `db:"username" json:"username"`
+    Email            string    `db:"email" json:"email"`
+    PasswordHash     string    `db:"password_hash" json:"-"`
+    FullName         string    `db:"full_name" json:"full_name"`
+    RoleID           string    `db:"role_id" json:"role_id"`
+    IsActive         bool      `db:"is_active" json:"is_active"`
+    IsServiceAccount bool      `db:"is_service_account" json:"is_service_account"` // no password login, API tokens only
+    CreatedAt        time.Time `db:"created_at" json:"created_at"`
+    UpdatedAt        time.Time `db:"updated_at" json:"updated_at"`
 }
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// UserIdentity links an external (OIDC) account, identified by issuer and
+// subject, to a local user.
+type UserIdentity struct {
+	ID        string    `db:"id" json:"id"`
+	UserID    string    `db:"user_id" json:"user_id"`
+	Issuer    string    `db:"issuer" json:"issuer"`
+	Subject   string    `db:"subject" json:"subject"`
+	Email     string    `db:"email" json:"email"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
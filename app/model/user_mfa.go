@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// UserMFA is a user's TOTP enrollment. Secret is base32 (RFC 4648, no padding).
+type UserMFA struct {
+	UserID       string     `db:"user_id" json:"user_id"`
+	Secret       string     `db:"secret" json:"-"`
+	Enabled      bool       `db:"enabled" json:"enabled"`
+	LastUsedStep int64      `db:"last_used_step" json:"-"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+	EnabledAt    *time.Time `db:"enabled_at" json:"enabled_at,omitempty"`
+}
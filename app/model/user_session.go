@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// UserSession is one login (device). Its ID is the refresh token family id
+// and the "sid" claim of every access token issued for it.
+type UserSession struct {
+	ID         string     `db:"id" json:"id"`
+	UserID     string     `db:"user_id" json:"user_id"`
+	UserAgent  string     `db:"user_agent" json:"user_agent"`
+	IP         string     `db:"ip" json:"ip"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	LastSeenAt time.Time  `db:"last_seen_at" json:"last_seen_at"`
+	RevokedAt  *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`
+	Current    bool       `db:"-" json:"current"`
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"clean-arch/app/model"
+	"clean-arch/database"
+
+	"github.com/google/uuid"
+)
+
+// CreateAchievementOverrideAudit appends one audit row (version NULL while a.Version is 0).
+func CreateAchievementOverrideAudit(ctx context.Context, a *model.AchievementOverrideAudit) error {
+	changes, err := json.Marshal(a.Changes)
+	if err != nil {
+		return err
+	}
+	a.ID = uuid.New().String()
+	a.CreatedAt = time.Now()
+	q := `INSERT INTO achievement_override_audit (id, achievement_id, actor_id, reason, changes, version, created_at)
+	      VALUES ($1,$2,$3,$4,$5,$6,$7)`
+	_, err = database.PostgresDB.ExecContext(ctx, q,
+		a.ID, a.AchievementID, a.ActorID, a.Reason, changes, sql.NullInt64{Int64: int64(a.Version), Valid: a.Version > 0}, a.CreatedAt,
+	)
+	return err
+}
+
+// SetAchievementOverrideResult records the version an override produced and
+// the changes actually applied.
+func SetAchievementOverrideResult(ctx context.Context, id string, version int, applied []model.FieldChange) error {
+	changes, err := json.Marshal(applied)
+	if err != nil {
+		return err
+	}
+	_, err = database.PostgresDB.ExecContext(ctx,
+		`UPDATE achievement_override_audit SET version=$2, changes=$3 WHERE id=$1`, id, version, changes)
+	return err
+}
+
+// ListAchievementOverrideAudit returns an achievement's override rows, newest first.
+func ListAchievementOverrideAudit(ctx context.Context, achievementID string) ([]model.AchievementOverrideAudit, error) {
+	q := `SELECT id, achievement_id, actor_id, reason, changes, version, created_at
+	      FROM achievement_override_audit WHERE achievement_id=$1 ORDER BY created_at DESC`
+	rows, err := database.PostgresDB.QueryContext(ctx, q, achievementID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.AchievementOverrideAudit{}
+	for rows.Next() {
+		var a model.AchievementOverrideAudit
+		var changes []byte
+		var version sql.NullInt64
+		if err := rows.Scan(&a.ID, &a.AchievementID, &a.ActorID, &a.Reason, &changes, &version, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		a.Version = int(version.Int64)
+		if err := json.Unmarshal(changes, &a.Changes); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
@@ -10,10 +10,16 @@ import (
 	"clean-arch/database"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
-// CreateAchievementReference inserts a new achievement reference row.
-func CreateAchievementReference(ctx context.Context, r *model.AchievementReference) error {
+// ErrReferenceExists is returned when the Mongo achievement already has a
+// reference (unique mongo_achievement_id).
+var ErrReferenceExists = errors.New("achievement already has a reference")
+
+// CreateAchievementReference inserts a new achievement reference row and
+// its first history event (created by actorID) in one transaction.
+func CreateAchievementReference(ctx context.Context, r *model.AchievementReference, actorID string) error {
 	if r.ID == "" {
 		r.ID = uuid.New().String()
 	}
@@ -39,23 +45,43 @@ func CreateAchievementReference(ctx context.Context, r *model.AchievementReferen
 		verified = nil
 	}
 
-	_, err := database.PostgresDB.ExecContext(ctx, q,
+	tx, err := database.PostgresDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// waits for student edits of the document in flight (see WithStudentEditLock)
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, r.MongoAchievementID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, q,
 		r.ID, r.StudentID, r.MongoAchievementID, r.Status, submitted, verified, r.VerifiedBy, r.RejectionNote, r.CreatedAt, r.UpdatedAt,
-	)
-	return err
+	); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return ErrReferenceExists
+		}
+		return err
+	}
+	if err := insertStatusEvent(ctx, tx, r.ID, "", r.Status, actorID, nil, now); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // GetAchievementReferenceByMongoID finds a reference row by mongo_achievement_id
 func GetAchievementReferenceByMongoID(ctx context.Context, mongoID string) (*model.AchievementReference, error) {
-	q := `SELECT id, student_id, mongo_achievement_id, status, submitted_at, verified_at, verified_by, rejection_note, created_at, updated_at
+	q := `SELECT id, student_id, mongo_achievement_id, status, submitted_at, verified_at, verified_by, rejection_note, verified_version, created_at, updated_at
 	      FROM achievement_references WHERE mongo_achievement_id=$1 LIMIT 1`
 	row := database.PostgresDB.QueryRowContext(ctx, q, mongoID)
 
 	var ref model.AchievementReference
 	var submitted, verified sql.NullTime
 	var verifiedBy, rejectionNote sql.NullString
+	var verifiedVersion sql.NullInt64
 
-	if err := row.Scan(&ref.ID, &ref.StudentID, &ref.MongoAchievementID, &ref.Status, &submitted, &verified, &verifiedBy, &rejectionNote, &ref.CreatedAt, &ref.UpdatedAt); err != nil {
+	if err := row.Scan(&ref.ID, &ref.StudentID, &ref.MongoAchievementID, &ref.Status, &submitted, &verified, &verifiedBy, &rejectionNote, &verifiedVersion, &ref.CreatedAt, &ref.UpdatedAt); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
@@ -77,11 +103,42 @@ func GetAchievementReferenceByMongoID(ctx context.Context, mongoID string) (*mod
 		v := rejectionNote.String
 		ref.RejectionNote = &v
 	}
+	if verifiedVersion.Valid {
+		v := int(verifiedVersion.Int64)
+		ref.VerifiedVersion = &v
+	}
 	return &ref, nil
 }
 
-// UpdateAchievementReferenceStatus updates status and optional verifier/note
-func UpdateAchievementReferenceStatus(ctx context.Context, referenceID, status string, verifierID *string, rejectionNote *string) error {
+// ErrStatusChanged is returned when the reference left the expected status
+// before the update (a concurrent verify/reject/submit won).
+var ErrStatusChanged = errors.New("achievement status changed concurrently")
+
+// UpdateAchievementReferenceStatus moves a reference from status `from` to
+// `to` on behalf of actorID (recorded as verifier for verified/rejected),
+// with an optional note. The transition is checked against the workflow
+// (model.ErrIllegalTransition) and applied only while the row is still in
+// `from` (ErrStatusChanged otherwise). The history event is written in the
+// same transaction.
+func UpdateAchievementReferenceStatus(ctx context.Context, referenceID, from, to, actorID string, rejectionNote *string) error {
+	tx, err := database.PostgresDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := updateReferenceStatus(ctx, tx, referenceID, from, to, actorID, rejectionNote); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateReferenceStatus is UpdateAchievementReferenceStatus inside the
+// caller's transaction.
+func updateReferenceStatus(ctx context.Context, tx *sql.Tx, referenceID, from, to, actorID string, rejectionNote *string) error {
+	if err := model.CheckStatusTransition(from, to); err != nil {
+		return err
+	}
 	now := time.Now()
 	// We'll set fields depending on status:
 	// - 'submitted': set status, submitted_at=now, updated_at
@@ -91,33 +148,145 @@ func UpdateAchievementReferenceStatus(ctx context.Context, referenceID, status s
 	var q string
 	var args []interface{}
 
-	switch status {
-	case "submitted":
-		q = `UPDATE achievement_references SET status=$1, submitted_at=$2, updated_at=$3 WHERE id=$4`
-		args = []interface{}{status, now, now, referenceID}
-	case "verified":
-		q = `UPDATE achievement_references SET status=$1, verified_at=$2, verified_by=$3, updated_at=$4 WHERE id=$5`
+	switch to {
+	case model.StatusSubmitted:
+		q = `UPDATE achievement_references SET status=$1, submitted_at=$2, updated_at=$3 WHERE id=$4 AND status=$5`
+		args = []interface{}{to, now, now, referenceID, from}
+	case model.StatusVerified:
+		q = `UPDATE achievement_references SET status=$1, verified_at=$2, verified_by=$3, updated_at=$4 WHERE id=$5 AND status=$6`
 		vby := sql.NullString{}
-		if verifierID != nil {
-			vby = sql.NullString{String: *verifierID, Valid: true}
+		if actorID != "" {
+			vby = sql.NullString{String: actorID, Valid: true}
 		}
-		args = []interface{}{status, now, vby, now, referenceID}
-	case "rejected":
-		q = `UPDATE achievement_references SET status=$1, rejection_note=$2, verified_by=$3, updated_at=$4 WHERE id=$5`
+		args = []interface{}{to, now, vby, now, referenceID, from}
+	case model.StatusRejected:
+		q = `UPDATE achievement_references SET status=$1, rejection_note=$2, verified_by=$3, updated_at=$4 WHERE id=$5 AND status=$6`
 		rn := sql.NullString{}
 		if rejectionNote != nil {
 			rn = sql.NullString{String: *rejectionNote, Valid: true}
 		}
 		vby := sql.NullString{}
-		if verifierID != nil {
-			vby = sql.NullString{String: *verifierID, Valid: true}
+		if actorID != "" {
+			vby = sql.NullString{String: actorID, Valid: true}
 		}
-		args = []interface{}{status, rn, vby, now, referenceID}
+		args = []interface{}{to, rn, vby, now, referenceID, from}
 	default:
-		q = `UPDATE achievement_references SET status=$1, updated_at=$2 WHERE id=$3`
-		args = []interface{}{status, now, referenceID}
+		q = `UPDATE achievement_references SET status=$1, updated_at=$2 WHERE id=$3 AND status=$4`
+		args = []interface{}{to, now, referenceID, from}
 	}
 
-	_, err := database.PostgresDB.ExecContext(ctx, q, args...)
+	res, err := tx.ExecContext(ctx, q, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrStatusChanged
+	}
+	return insertStatusEvent(ctx, tx, referenceID, from, to, actorID, rejectionNote, now)
+}
+
+// VerifyAchievementReference moves a reference from `from` to verified and
+// pins the approved snapshot version, in one transaction (see
+// UpdateAchievementReferenceStatus for the errors).
+func VerifyAchievementReference(ctx context.Context, referenceID, from, verifierID string, version int) error {
+	tx, err := database.PostgresDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := updateReferenceStatus(ctx, tx, referenceID, from, model.StatusVerified, verifierID, nil); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE achievement_references SET verified_version=$1 WHERE id=$2`, version, referenceID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PinBackfilledVersion pins version as the approved one on a verified
+// reference that was verified before versioning (verified_version NULL).
+func PinBackfilledVersion(ctx context.Context, referenceID string, version int) error {
+	_, err := database.PostgresDB.ExecContext(ctx,
+		`UPDATE achievement_references SET verified_version=$1 WHERE id=$2 AND status=$3 AND verified_version IS NULL`,
+		version, referenceID, model.StatusVerified)
 	return err
 }
+
+// WithStudentEditLock runs edit while the achievement's workflow state is
+// held still: the reference row is locked FOR SHARE, so a submit, verify or
+// any other status change waits until edit returns, and a shared advisory
+// lock on the Mongo id keeps a first reference from being created
+// meanwhile. edit gets the reference (nil when there is none) to re-check
+// its status; an error from edit is returned as is.
+func WithStudentEditLock(ctx context.Context, mongoID string, edit func(ref *model.AchievementReference) error) error {
+	tx, err := database.PostgresDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock_shared(hashtext($1))`, mongoID); err != nil {
+		return err
+	}
+	var ref *model.AchievementReference
+	var r model.AchievementReference
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, student_id, status, updated_at FROM achievement_references WHERE mongo_achievement_id=$1 FOR SHARE`, mongoID,
+	).Scan(&r.ID, &r.StudentID, &r.Status, &r.UpdatedAt)
+	switch {
+	case err == nil:
+		r.MongoAchievementID = mongoID
+		ref = &r
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+	if err := edit(ref); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetAchievementReferenceByID finds a reference row by its id
+func GetAchievementReferenceByID(ctx context.Context, id string) (*model.AchievementReference, error) {
+	q := `SELECT id, student_id, mongo_achievement_id, status, submitted_at, verified_at, verified_by, rejection_note, verified_version, created_at, updated_at
+	      FROM achievement_references WHERE id=$1`
+	row := database.PostgresDB.QueryRowContext(ctx, q, id)
+
+	var ref model.AchievementReference
+	var submitted, verified sql.NullTime
+	var verifiedBy, rejectionNote sql.NullString
+	var verifiedVersion sql.NullInt64
+
+	if err := row.Scan(&ref.ID, &ref.StudentID, &ref.MongoAchievementID, &ref.Status, &submitted, &verified, &verifiedBy, &rejectionNote, &verifiedVersion, &ref.CreatedAt, &ref.UpdatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if submitted.Valid {
+		t := submitted.Time
+		ref.SubmittedAt = &t
+	}
+	if verified.Valid {
+		t := verified.Time
+		ref.VerifiedAt = &t
+	}
+	if verifiedBy.Valid {
+		v := verifiedBy.String
+		ref.VerifiedBy = &v
+	}
+	if rejectionNote.Valid {
+		v := rejectionNote.String
+		ref.RejectionNote = &v
+	}
+	if verifiedVersion.Valid {
+		v := int(verifiedVersion.Int64)
+		ref.VerifiedVersion = &v
+	}
+	return &ref, nil
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"clean-arch/app/model"
+	"clean-arch/database"
+
+	"github.com/google/uuid"
+)
+
+const reviewCommentColumns = `id, reference_id, field, attachment_id, comment, author_id, created_at, resolved_at, resolved_by, resolution`
+
+// RequestAchievementRevision moves a reference from `from` to
+// revision_requested and stores the reviewer's comments, all in one
+// transaction (see UpdateAchievementReferenceStatus for the errors).
+func RequestAchievementRevision(ctx context.Context, referenceID, from, reviewerID string, note *string, comments []model.AchievementReviewComment) error {
+	tx, err := database.PostgresDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := updateReferenceStatus(ctx, tx, referenceID, from, model.StatusRevisionRequested, reviewerID, note); err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := range comments {
+		cm := &comments[i]
+		cm.ID = uuid.New().String()
+		cm.ReferenceID = referenceID
+		cm.AuthorID = reviewerID
+		cm.CreatedAt = now
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO achievement_review_comments (id, reference_id, field, attachment_id, comment, author_id, created_at)
+			 VALUES ($1,$2,NULLIF($3,''),NULLIF($4,''),$5,$6,$7)`,
+			cm.ID, referenceID, cm.Field, cm.AttachmentID, cm.Comment, reviewerID, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func scanReviewComment(row interface{ Scan(...interface{}) error }) (*model.AchievementReviewComment, error) {
+	var cm model.AchievementReviewComment
+	var field, attachment, resolvedBy, resolution sql.NullString
+	var resolvedAt sql.NullTime
+	if err := row.Scan(&cm.ID, &cm.ReferenceID, &field, &attachment, &cm.Comment, &cm.AuthorID, &cm.CreatedAt, &resolvedAt, &resolvedBy, &resolution); err != nil {
+		return nil, err
+	}
+	cm.Field = field.String
+	cm.AttachmentID = attachment.String
+	if resolvedAt.Valid {
+		t := resolvedAt.Time
+		cm.ResolvedAt = &t
+	}
+	if resolvedBy.Valid {
+		v := resolvedBy.String
+		cm.ResolvedBy = &v
+	}
+	if resolution.Valid {
+		v := resolution.String
+		cm.Resolution = &v
+	}
+	return &cm, nil
+}
+
+// ListReviewComments returns a reference's review comments, oldest first;
+// with openOnly only the unresolved ones.
+func ListReviewComments(ctx context.Context, referenceID string, openOnly bool) ([]model.AchievementReviewComment, error) {
+	q := `SELECT ` + reviewCommentColumns + ` FROM achievement_review_comments WHERE reference_id=$1`
+	if openOnly {
+		q += ` AND resolved_at IS NULL`
+	}
+	q += ` ORDER BY created_at, id`
+	rows, err := database.PostgresDB.QueryContext(ctx, q, referenceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.AchievementReviewComment{}
+	for rows.Next() {
+		cm, err := scanReviewComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *cm)
+	}
+	return out, rows.Err()
+}
+
+// GetReviewComment returns a comment by id (nil when not found).
+func GetReviewComment(ctx context.Context, id string) (*model.AchievementReviewComment, error) {
+	row := database.PostgresDB.QueryRowContext(ctx,
+		`SELECT `+reviewCommentColumns+` FROM achievement_review_comments WHERE id=$1`, id)
+	cm, err := scanReviewComment(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return cm, err
+}
+
+// ResolveReviewComment marks an open comment resolved. It returns false when
+// the comment was already resolved.
+func ResolveReviewComment(ctx context.Context, id, userID string, resolution *string) (bool, error) {
+	res, err := database.PostgresDB.ExecContext(ctx,
+		`UPDATE achievement_review_comments SET resolved_at=$1, resolved_by=$2, resolution=$3
+		 WHERE id=$4 AND resolved_at IS NULL`,
+		time.Now(), userID, resolution, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
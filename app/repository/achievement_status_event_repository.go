@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"clean-arch/app/model"
+	"clean-arch/database"
+
+	"github.com/google/uuid"
+)
+
+// insertStatusEvent appends a history row inside the caller's transaction.
+func insertStatusEvent(ctx context.Context, tx *sql.Tx, referenceID, from, to, actorID string, note *string, at time.Time) error {
+	var fromStatus, actor sql.NullString
+	if from != "" {
+		fromStatus = sql.NullString{String: from, Valid: true}
+	}
+	if actorID != "" {
+		actor = sql.NullString{String: actorID, Valid: true}
+	}
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO achievement_status_events (id, reference_id, from_status, to_status, actor_id, note, created_at)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7)`,
+		uuid.New().String(), referenceID, fromStatus, to, actor, note, at)
+	return err
+}
+
+// ListAchievementStatusEvents returns a reference's status history, oldest
+// first, with the actor's name when the user still exists.
+func ListAchievementStatusEvents(ctx context.Context, referenceID string) ([]model.AchievementStatusEvent, error) {
+	q := `SELECT e.id, e.reference_id, e.from_status, e.to_status, e.actor_id, COALESCE(u.full_name, ''), e.note, e.created_at
+	      FROM achievement_status_events e
+	      LEFT JOIN users u ON u.id = e.actor_id
+	      WHERE e.reference_id=$1
+	      ORDER BY e.created_at, e.id`
+	rows, err := database.PostgresDB.QueryContext(ctx, q, referenceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.AchievementStatusEvent{}
+	for rows.Next() {
+		var e model.AchievementStatusEvent
+		var from, actor, note sql.NullString
+		if err := rows.Scan(&e.ID, &e.ReferenceID, &from, &e.ToStatus, &actor, &e.ActorName, &note, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.FromStatus = from.String
+		if actor.Valid {
+			v := actor.String
+			e.ActorID = &v
+		}
+		if note.Valid {
+			v := note.String
+			e.Note = &v
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
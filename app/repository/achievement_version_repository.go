@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	mongoModel "clean-arch/app/model"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mgo "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const achievementVersionsCollection = "achievement_versions"
+
+// snapshot writers racing for the same version number retry this often
+const snapshotAttempts = 5
+
+// LatestAchievementVersion returns the newest snapshot of an achievement
+// (nil when it has none yet).
+func LatestAchievementVersion(db *mgo.Database, achievementID string) (*mongoModel.AchievementVersion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	col := db.Collection(achievementVersionsCollection)
+
+	var out mongoModel.AchievementVersion
+	opts := options.FindOne().SetSort(bson.M{"version": -1})
+	if err := col.FindOne(ctx, bson.M{"achievementId": achievementID}, opts).Decode(&out); err != nil {
+		if errors.Is(err, mgo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SnapshotAchievement stores the achievement's current document as its next
+// version. Versions are never updated; the unique (achievementId, version)
+// index turns a concurrent writer into a retry with the next number.
+func SnapshotAchievement(db *mgo.Database, hexID, createdBy, reason string) (*mongoModel.AchievementVersion, error) {
+	a, err := GetAchievementByID(db, hexID)
+	if err != nil {
+		return nil, err
+	}
+	col := db.Collection(achievementVersionsCollection)
+
+	for attempt := 0; ; attempt++ {
+		latest, err := LatestAchievementVersion(db, hexID)
+		if err != nil {
+			return nil, err
+		}
+		v := &mongoModel.AchievementVersion{
+			AchievementID: hexID,
+			Version:       1,
+			Snapshot:      *a,
+			Reason:        reason,
+			CreatedBy:     createdBy,
+			CreatedAt:     time.Now(),
+		}
+		if latest != nil {
+			v.Version = latest.Version + 1
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		res, err := col.InsertOne(ctx, v)
+		cancel()
+		if err == nil {
+			v.ID, _ = res.InsertedID.(primitive.ObjectID)
+			return v, nil
+		}
+		if !mgo.IsDuplicateKeyError(err) || attempt+1 >= snapshotAttempts {
+			return nil, err
+		}
+	}
+}
+
+// ListAchievementVersions returns an achievement's snapshots, oldest first.
+func ListAchievementVersions(db *mgo.Database, achievementID string) ([]mongoModel.AchievementVersion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	col := db.Collection(achievementVersionsCollection)
+
+	cur, err := col.Find(ctx, bson.M{"achievementId": achievementID}, options.Find().SetSort(bson.M{"version": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := []mongoModel.AchievementVersion{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetAchievementVersion returns one snapshot (nil when it doesn't exist).
+func GetAchievementVersion(db *mgo.Database, achievementID string, version int) (*mongoModel.AchievementVersion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	col := db.Collection(achievementVersionsCollection)
+
+	var out mongoModel.AchievementVersion
+	if err := col.FindOne(ctx, bson.M{"achievementId": achievementID, "version": version}).Decode(&out); err != nil {
+		if errors.Is(err, mgo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"clean-arch/app/model"
+	"clean-arch/database"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const apiTokenColumns = `id, user_id, name, token_prefix, token_hash, permissions, expires_at,
+	last_used_at, revoked_at, created_by, created_at`
+
+// CreateAPIToken inserts a new API token row.
+func CreateAPIToken(ctx context.Context, t *model.APIToken) error {
+	if t.ID == "" {
+		t.ID = uuid.New().String()
+	}
+	t.CreatedAt = time.Now()
+
+	var createdBy sql.NullString
+	if t.CreatedBy != "" {
+		createdBy = sql.NullString{String: t.CreatedBy, Valid: true}
+	}
+	q := `INSERT INTO api_tokens (id, user_id, name, token_prefix, token_hash, permissions, expires_at, created_by, created_at)
+	      VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`
+	_, err := database.PostgresDB.ExecContext(ctx, q,
+		t.ID, t.UserID, t.Name, t.Prefix, t.TokenHash, pq.Array(t.Permissions), t.ExpiresAt, createdBy, t.CreatedAt,
+	)
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIToken(row rowScanner) (*model.APIToken, error) {
+	var t model.APIToken
+	var lastUsed, revoked sql.NullTime
+	var createdBy sql.NullString
+	if err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.TokenHash, pq.Array(&t.Permissions),
+		&t.ExpiresAt, &lastUsed, &revoked, &createdBy, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	if lastUsed.Valid {
+		v := lastUsed.Time
+		t.LastUsedAt = &v
+	}
+	if revoked.Valid {
+		v := revoked.Time
+		t.RevokedAt = &v
+	}
+	t.CreatedBy = createdBy.String
+	return &t, nil
+}
+
+// GetAPITokenByHash returns the token for a sha256 hash (nil if none).
+func GetAPITokenByHash(ctx context.Context, hash string) (*model.APIToken, error) {
+	q := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE token_hash=$1`
+	t, err := scanAPIToken(database.PostgresDB.QueryRowContext(ctx, q, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return t, err
+}
+
+// ListAPITokensByUser returns every token of a user, newest first.
+func ListAPITokensByUser(ctx context.Context, userID string) ([]model.APIToken, error) {
+	q := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE user_id=$1 ORDER BY created_at DESC`
+	rows, err := database.PostgresDB.QueryContext(ctx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.APIToken{}
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *t)
+	}
+	return out, rows.Err()
+}
+
+// RevokeAPIToken revokes a live token of the user. It returns false when
+// there is no such live token.
+func RevokeAPIToken(ctx context.Context, userID, id string) (bool, error) {
+	q := `UPDATE api_tokens SET revoked_at=$1 WHERE id=$2 AND user_id=$3 AND revoked_at IS NULL`
+	res, err := database.PostgresDB.ExecContext(ctx, q, time.Now(), id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// TouchAPIToken records when a token was last used.
+func TouchAPIToken(ctx context.Context, id string, at time.Time) error {
+	_, err := database.PostgresDB.ExecContext(ctx, `UPDATE api_tokens SET last_used_at=$1 WHERE id=$2`, at, id)
+	return err
+}
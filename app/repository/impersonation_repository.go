@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"clean-arch/app/model"
+	"clean-arch/database"
+
+	"github.com/google/uuid"
+)
+
+// CreateImpersonationAudit appends one audit row.
+func CreateImpersonationAudit(ctx context.Context, actorID, targetID, tokenID, method, path string, status int) error {
+	q := `INSERT INTO impersonation_audit (id, actor_id, target_id, token_id, method, path, status, created_at)
+	      VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`
+	_, err := database.PostgresDB.ExecContext(ctx, q,
+		uuid.New().String(), actorID, targetID, tokenID, method, path, status, time.Now(),
+	)
+	return err
+}
+
+// ListImpersonationAudit returns the newest rows, optionally filtered by actor and/or target.
+func ListImpersonationAudit(ctx context.Context, actorID, targetID string, limit int) ([]model.ImpersonationAudit, error) {
+	q := `SELECT id, actor_id, target_id, token_id, method, path, status, created_at FROM impersonation_audit WHERE TRUE`
+	args := []interface{}{}
+	if actorID != "" {
+		args = append(args, actorID)
+		q += fmt.Sprintf(" AND actor_id=$%d", len(args))
+	}
+	if targetID != "" {
+		args = append(args, targetID)
+		q += fmt.Sprintf(" AND target_id=$%d", len(args))
+	}
+	args = append(args, limit)
+	q += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d", len(args))
+
+	rows, err := database.PostgresDB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.ImpersonationAudit{}
+	for rows.Next() {
+		var a model.ImpersonationAudit
+		if err := rows.Scan(&a.ID, &a.ActorID, &a.TargetID, &a.TokenID, &a.Method, &a.Path, &a.Status, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
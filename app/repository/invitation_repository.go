@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"clean-arch/app/model"
+	"clean-arch/database"
+
+	"github.com/google/uuid"
+)
+
+// CreateInvitation stores a new invitation and revokes the user's older
+// open ones, so only the most recent link works.
+func CreateInvitation(ctx context.Context, inv *model.UserInvitation) error {
+	if inv.ID == "" {
+		inv.ID = uuid.New().String()
+	}
+	inv.CreatedAt = time.Now()
+
+	var createdBy sql.NullString
+	if inv.CreatedBy != "" {
+		createdBy = sql.NullString{String: inv.CreatedBy, Valid: true}
+	}
+
+	tx, err := database.PostgresDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE user_invitations SET revoked_at=$1 WHERE user_id=$2 AND accepted_at IS NULL AND revoked_at IS NULL`,
+		inv.CreatedAt, inv.UserID,
+	); err != nil {
+		return err
+	}
+	q := `INSERT INTO user_invitations (id, user_id, token_hash, expires_at, created_by, created_at)
+	      VALUES ($1,$2,$3,$4,$5,$6)`
+	if _, err := tx.ExecContext(ctx, q, inv.ID, inv.UserID, inv.TokenHash, inv.ExpiresAt, createdBy, inv.CreatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetInvitationByHash returns the invitation for a token hash (nil if none).
+func GetInvitationByHash(ctx context.Context, hash string) (*model.UserInvitation, error) {
+	q := `SELECT id, user_id, token_hash, expires_at, accepted_at, revoked_at, created_by, created_at
+	      FROM user_invitations WHERE token_hash=$1`
+	var inv model.UserInvitation
+	var accepted, revoked sql.NullTime
+	var createdBy sql.NullString
+	err := database.PostgresDB.QueryRowContext(ctx, q, hash).Scan(
+		&inv.ID, &inv.UserID, &inv.TokenHash, &inv.ExpiresAt, &accepted, &revoked, &createdBy, &inv.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if accepted.Valid {
+		v := accepted.Time
+		inv.AcceptedAt = &v
+	}
+	if revoked.Valid {
+		v := revoked.Time
+		inv.RevokedAt = &v
+	}
+	inv.CreatedBy = createdBy.String
+	return &inv, nil
+}
+
+// RevokeInvitations revokes every open invitation of a user and reports how many there were.
+func RevokeInvitations(ctx context.Context, userID string) (int64, error) {
+	q := `UPDATE user_invitations SET revoked_at=$1 WHERE user_id=$2 AND accepted_at IS NULL AND revoked_at IS NULL`
+	res, err := database.PostgresDB.ExecContext(ctx, q, time.Now(), userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// AcceptInvitation consumes an open invitation and, in the same transaction,
+// sets the user's password and activates the account. It returns false when
+// the invitation was already accepted, revoked or has expired.
+func AcceptInvitation(ctx context.Context, invitationID, userID, passwordHash string) (bool, error) {
+	now := time.Now()
+	tx, err := database.PostgresDB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE user_invitations SET accepted_at=$1
+		 WHERE id=$2 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > $1`,
+		now, invitationID,
+	)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE users SET password_hash=$1, is_active=TRUE, updated_at=$2 WHERE id=$3`,
+		passwordHash, now, userID,
+	); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"clean-arch/database"
+
+	"github.com/lib/pq"
+)
+
+// GetLoginLockedUntil returns the latest locked_until among keys (zero if none is locked).
+func GetLoginLockedUntil(ctx context.Context, keys []string) (time.Time, error) {
+	var until sql.NullTime
+	q := `SELECT MAX(locked_until) FROM login_attempts WHERE key = ANY($1) AND locked_until > $2`
+	if err := database.PostgresDB.QueryRowContext(ctx, q, pq.Array(keys), time.Now()).Scan(&until); err != nil {
+		return time.Time{}, err
+	}
+	if !until.Valid {
+		return time.Time{}, nil
+	}
+	return until.Time, nil
+}
+
+// RecordLoginFailure increments the failure counter of a key and returns the new count.
+// Counters restart when the previous failure is older than window.
+func RecordLoginFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	now := time.Now()
+	q := `INSERT INTO login_attempts (key, failures, last_failure_at) VALUES ($1, 1, $2)
+	      ON CONFLICT (key) DO UPDATE SET
+	          failures = CASE WHEN login_attempts.last_failure_at < $3 THEN 1 ELSE login_attempts.failures + 1 END,
+	          last_failure_at = $2
+	      RETURNING failures`
+	var failures int
+	err := database.PostgresDB.QueryRowContext(ctx, q, key, now, now.Add(-window)).Scan(&failures)
+	return failures, err
+}
+
+// LockLogin sets locked_until for a key.
+func LockLogin(ctx context.Context, key string, until time.Time) error {
+	_, err := database.PostgresDB.ExecContext(ctx, `UPDATE login_attempts SET locked_until=$1 WHERE key=$2`, until, key)
+	return err
+}
+
+// ClearLoginAttempts removes counters and locks for the given keys.
+func ClearLoginAttempts(ctx context.Context, keys []string) error {
+	_, err := database.PostgresDB.ExecContext(ctx, `DELETE FROM login_attempts WHERE key = ANY($1)`, pq.Array(keys))
+	return err
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"clean-arch/app/model"
+	"clean-arch/database"
+
+	"github.com/google/uuid"
+)
+
+// GetUserMFA returns the user's TOTP enrollment (nil if none).
+func GetUserMFA(ctx context.Context, userID string) (*model.UserMFA, error) {
+	q := `SELECT user_id, secret, enabled, last_used_step, created_at, enabled_at FROM user_mfa WHERE user_id=$1`
+	row := database.PostgresDB.QueryRowContext(ctx, q, userID)
+
+	var m model.UserMFA
+	var enabledAt sql.NullTime
+	if err := row.Scan(&m.UserID, &m.Secret, &m.Enabled, &m.LastUsedStep, &m.CreatedAt, &enabledAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if enabledAt.Valid {
+		v := enabledAt.Time
+		m.EnabledAt = &v
+	}
+	return &m, nil
+}
+
+// SaveUserMFASecret starts (or restarts) a pending enrollment. An enabled
+// enrollment is never overwritten; it has to be disabled first.
+func SaveUserMFASecret(ctx context.Context, userID, secret string) error {
+	q := `INSERT INTO user_mfa (user_id, secret, enabled, last_used_step, created_at)
+	      VALUES ($1,$2,FALSE,0,$3)
+	      ON CONFLICT (user_id) DO UPDATE SET secret=EXCLUDED.secret, created_at=EXCLUDED.created_at
+	      WHERE user_mfa.enabled = FALSE`
+	_, err := database.PostgresDB.ExecContext(ctx, q, userID, secret, time.Now())
+	return err
+}
+
+// EnableUserMFA turns the enrollment on and replaces the recovery codes.
+func EnableUserMFA(ctx context.Context, userID string, codeHashes []string) error {
+	tx, err := database.PostgresDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if _, err := tx.ExecContext(ctx, `UPDATE user_mfa SET enabled=TRUE, enabled_at=$1 WHERE user_id=$2`, now, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id=$1`, userID); err != nil {
+		return err
+	}
+	for _, h := range codeHashes {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO mfa_recovery_codes (id, user_id, code_hash, created_at) VALUES ($1,$2,$3,$4)`,
+			uuid.New().String(), userID, h, now,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DisableUserMFA removes the enrollment and its recovery codes.
+func DisableUserMFA(ctx context.Context, userID string) error {
+	tx, err := database.PostgresDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id=$1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id=$1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AdvanceMFAStep records the TOTP time step just used. It returns false when
+// that step (or a later one) was already used, i.e. the code is a replay.
+func AdvanceMFAStep(ctx context.Context, userID string, step int64) (bool, error) {
+	res, err := database.PostgresDB.ExecContext(ctx,
+		`UPDATE user_mfa SET last_used_step=$1 WHERE user_id=$2 AND last_used_step < $1`, step, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// ConsumeRecoveryCode marks a matching unused recovery code as used.
+func ConsumeRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	res, err := database.PostgresDB.ExecContext(ctx,
+		`UPDATE mfa_recovery_codes SET used_at=$1 WHERE user_id=$2 AND code_hash=$3 AND used_at IS NULL`,
+		time.Now(), userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
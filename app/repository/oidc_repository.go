@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"clean-arch/app/model"
+	"clean-arch/database"
+
+	"github.com/google/uuid"
+)
+
+// SaveOIDCLoginState stores a pending SSO login keyed by the hashed state.
+func SaveOIDCLoginState(ctx context.Context, stateHash, verifier, nonce string, expiresAt time.Time) error {
+	q := `INSERT INTO oidc_login_states (state_hash, code_verifier, nonce, expires_at) VALUES ($1,$2,$3,$4)`
+	if _, err := database.PostgresDB.ExecContext(ctx, q, stateHash, verifier, nonce, expiresAt); err != nil {
+		return err
+	}
+	// abandoned logins are cleaned up opportunistically
+	_, err := database.PostgresDB.ExecContext(ctx, `DELETE FROM oidc_login_states WHERE expires_at < $1`, time.Now())
+	return err
+}
+
+// ConsumeOIDCLoginState deletes and returns a pending login. ok is false
+// when the state is unknown, already used or expired.
+func ConsumeOIDCLoginState(ctx context.Context, stateHash string) (verifier, nonce string, ok bool, err error) {
+	q := `DELETE FROM oidc_login_states WHERE state_hash=$1 RETURNING code_verifier, nonce, expires_at`
+	var expiresAt time.Time
+	err = database.PostgresDB.QueryRowContext(ctx, q, stateHash).Scan(&verifier, &nonce, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", false, nil
+	}
+	if err != nil {
+		return "", "", false, err
+	}
+	if time.Now().After(expiresAt) {
+		return "", "", false, nil
+	}
+	return verifier, nonce, true, nil
+}
+
+// GetUserIdentity returns the link for an issuer/subject pair (nil if none).
+func GetUserIdentity(ctx context.Context, issuer, subject string) (*model.UserIdentity, error) {
+	q := `SELECT id, user_id, issuer, subject, email, created_at FROM user_identities WHERE issuer=$1 AND subject=$2`
+	var i model.UserIdentity
+	err := database.PostgresDB.QueryRowContext(ctx, q, issuer, subject).
+		Scan(&i.ID, &i.UserID, &i.Issuer, &i.Subject, &i.Email, &i.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// CreateUserIdentity links an external account to a user.
+func CreateUserIdentity(ctx context.Context, i *model.UserIdentity) error {
+	if i.ID == "" {
+		i.ID = uuid.New().String()
+	}
+	i.CreatedAt = time.Now()
+	q := `INSERT INTO user_identities (id, user_id, issuer, subject, email, created_at) VALUES ($1,$2,$3,$4,$5,$6)`
+	_, err := database.PostgresDB.ExecContext(ctx, q, i.ID, i.UserID, i.Issuer, i.Subject, i.Email, i.CreatedAt)
+	return err
+}
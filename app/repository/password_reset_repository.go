@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"clean-arch/app/model"
+	"clean-arch/database"
+
+	"github.com/google/uuid"
+)
+
+// CreatePasswordResetToken stores a new reset token and retires the user's
+// older unused ones, so only the most recent email works.
+func CreatePasswordResetToken(ctx context.Context, t *model.PasswordResetToken) error {
+	if t.ID == "" {
+		t.ID = uuid.New().String()
+	}
+	t.CreatedAt = time.Now()
+
+	tx, err := database.PostgresDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE password_reset_tokens SET used_at=$1 WHERE user_id=$2 AND used_at IS NULL`,
+		t.CreatedAt, t.UserID,
+	); err != nil {
+		return err
+	}
+	q := `INSERT INTO password_reset_tokens (id, user_id, token_hash, expires_at, created_at)
+	      VALUES ($1,$2,$3,$4,$5)`
+	if _, err := tx.ExecContext(ctx, q, t.ID, t.UserID, t.TokenHash, t.ExpiresAt, t.CreatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetPasswordResetTokenByHash returns the token row for a hash (nil if none).
+func GetPasswordResetTokenByHash(ctx context.Context, hash string) (*model.PasswordResetToken, error) {
+	q := `SELECT id, user_id, token_hash, expires_at, used_at, created_at
+	      FROM password_reset_tokens WHERE token_hash=$1`
+	row := database.PostgresDB.QueryRowContext(ctx, q, hash)
+
+	var t model.PasswordResetToken
+	var used sql.NullTime
+	if err := row.Scan(&t.ID, &t.UserID, &t.TokenHash, &t.ExpiresAt, &used, &t.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if used.Valid {
+		v := used.Time
+		t.UsedAt = &v
+	}
+	return &t, nil
+}
+
+// ConsumePasswordResetToken marks an unused, unexpired token as used.
+// It returns false if the token was already used or has expired.
+func ConsumePasswordResetToken(ctx context.Context, id string) (bool, error) {
+	now := time.Now()
+	q := `UPDATE password_reset_tokens SET used_at=$1
+	      WHERE id=$2 AND used_at IS NULL AND expires_at > $1`
+	res, err := database.PostgresDB.ExecContext(ctx, q, now, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
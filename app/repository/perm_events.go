@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// PermChangeChannel is the NOTIFY channel carrying the id of a role whose
+// effective permissions changed. Every API instance listens on it to evict
+// its cached copy.
+const PermChangeChannel = "perm_changed"
+
+// notifyPermChange queues one notification per role. Postgres delivers them
+// when tx commits and drops them on rollback.
+func notifyPermChange(ctx context.Context, tx *sql.Tx, roleIDs []string) error {
+	if len(roleIDs) == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `SELECT pg_notify($1, id) FROM unnest($2::text[]) AS id`, PermChangeChannel, pq.Array(roleIDs))
+	return err
+}
@@ -6,21 +6,14 @@ import (
 	"fmt"
 
 	model "clean-arch/app/model" // import model Permission
+	"clean-arch/database"
 
 	"github.com/google/uuid"
 )
 
-// DB is a package-level database handle. Set this from your app initialization.
-var DB *sql.DB
-
-// SetDB sets the package-level DB handle (call once during app startup).
-func SetDB(db *sql.DB) {
-	DB = db
-}
-
 // CreatePermission inserts a new permission record.
 func CreatePermission(ctx context.Context, p *model.Permission) error {
-	if DB == nil {
+	if database.PostgresDB == nil {
 		return fmt.Errorf("database not initialized")
 	}
 	if p == nil {
@@ -34,13 +27,13 @@ func CreatePermission(ctx context.Context, p *model.Permission) error {
 		INSERT INTO permissions (id, name, resource, action, description)
 		VALUES ($1, $2, $3, $4, $5)
 	`
-	_, err := DB.ExecContext(ctx, q, p.ID, p.Name, p.Resource, p.Action, p.Description)
+	_, err := database.PostgresDB.ExecContext(ctx, q, p.ID, p.Name, p.Resource, p.Action, p.Description)
 	return err
 }
 
 // GetPermissionByID returns a permission by ID.
 func GetPermissionByID(ctx context.Context, id string) (*model.Permission, error) {
-	if DB == nil {
+	if database.PostgresDB == nil {
 		return nil, fmt.Errorf("database not initialized")
 	}
 	const q = `
@@ -48,7 +41,28 @@ func GetPermissionByID(ctx context.Context, id string) (*model.Permission, error
 		FROM permissions
 		WHERE id = $1
 	`
-	row := DB.QueryRowContext(ctx, q, id)
+	row := database.PostgresDB.QueryRowContext(ctx, q, id)
+	var p model.Permission
+	if err := row.Scan(&p.ID, &p.Name, &p.Resource, &p.Action, &p.Description); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetPermissionByName returns a permission by its unique name.
+func GetPermissionByName(ctx context.Context, name string) (*model.Permission, error) {
+	if database.PostgresDB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+	const q = `
+		SELECT id, name, resource, action, description
+		FROM permissions
+		WHERE name = $1
+	`
+	row := database.PostgresDB.QueryRowContext(ctx, q, name)
 	var p model.Permission
 	if err := row.Scan(&p.ID, &p.Name, &p.Resource, &p.Action, &p.Description); err != nil {
 		if err == sql.ErrNoRows {
@@ -61,7 +75,7 @@ func GetPermissionByID(ctx context.Context, id string) (*model.Permission, error
 
 // ListPermissions returns a list of permissions.
 func ListPermissions(ctx context.Context, limit, offset int) ([]model.Permission, error) {
-	if DB == nil {
+	if database.PostgresDB == nil {
 		return nil, fmt.Errorf("database not initialized")
 	}
 	const q = `
@@ -70,13 +84,13 @@ func ListPermissions(ctx context.Context, limit, offset int) ([]model.Permission
 		ORDER BY name
 		LIMIT $1 OFFSET $2
 	`
-	rows, err := DB.QueryContext(ctx, q, limit, offset)
+	rows, err := database.PostgresDB.QueryContext(ctx, q, limit, offset)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var out []model.Permission
+	out := []model.Permission{}
 	for rows.Next() {
 		var p model.Permission
 		if err := rows.Scan(&p.ID, &p.Name, &p.Resource, &p.Action, &p.Description); err != nil {
@@ -90,47 +104,106 @@ func ListPermissions(ctx context.Context, limit, offset int) ([]model.Permission
 	return out, nil
 }
 
-// UpdatePermission updates fields of a permission by ID.
-func UpdatePermission(ctx context.Context, p *model.Permission) error {
-	if DB == nil {
-		return fmt.Errorf("database not initialized")
+// UpdatePermission updates fields of a permission by ID. Roles holding the
+// permission get their perm_version bumped (a rename changes what their
+// tokens mean); their IDs are returned so callers can drop cached perms.
+func UpdatePermission(ctx context.Context, p *model.Permission) ([]string, error) {
+	if database.PostgresDB == nil {
+		return nil, fmt.Errorf("database not initialized")
 	}
 	if p == nil || p.ID == "" {
-		return fmt.Errorf("permission or permission.ID is empty")
+		return nil, fmt.Errorf("permission or permission.ID is empty")
+	}
+
+	tx, err := database.PostgresDB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
 	}
+	defer tx.Rollback()
 
 	const q = `
 		UPDATE permissions
 		SET name = $1, resource = $2, action = $3, description = $4
 		WHERE id = $5
 	`
-	res, err := DB.ExecContext(ctx, q, p.Name, p.Resource, p.Action, p.Description, p.ID)
+	res, err := tx.ExecContext(ctx, q, p.Name, p.Resource, p.Action, p.Description, p.ID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	n, err := res.RowsAffected()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if n == 0 {
-		return sql.ErrNoRows
+		return nil, sql.ErrNoRows
+	}
+	roles, err := bumpRolesWithPermission(ctx, tx, p.ID)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return roles, tx.Commit()
 }
 
-// DeletePermission deletes a permission by ID.
-func DeletePermission(ctx context.Context, id string) error {
-	if DB == nil {
-		return fmt.Errorf("database not initialized")
+// DeletePermission deletes a permission by ID together with its grants,
+// bumping the perm_version of the roles that held it. It returns those roles.
+func DeletePermission(ctx context.Context, id string) ([]string, error) {
+	if database.PostgresDB == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	tx, err := database.PostgresDB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	roles, err := bumpRolesWithPermission(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE permission_id = $1`, id); err != nil {
+		return nil, err
 	}
 	const q = `
 		DELETE FROM permissions
 		WHERE id = $1
 	`
-	res, err := DB.ExecContext(ctx, q, id)
+	res, err := tx.ExecContext(ctx, q, id)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	_, err = res.RowsAffected()
-	return err
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return roles, tx.Commit()
+}
+
+// bumpRolesWithPermission increments perm_version of every role granted the
+// permission, directly or by inheritance, and returns their IDs.
+func bumpRolesWithPermission(ctx context.Context, tx *sql.Tx, permissionID string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT role_id FROM role_permissions WHERE permission_id = $1`, permissionID)
+	if err != nil {
+		return nil, err
+	}
+	var holders []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		holders = append(holders, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(holders) == 0 {
+		return nil, nil
+	}
+	return bumpRoleHeirs(ctx, tx, holders)
 }
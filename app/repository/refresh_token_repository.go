@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"clean-arch/app/model"
+	"clean-arch/database"
+
+	"github.com/google/uuid"
+)
+
+// CreateRefreshToken inserts a new refresh token row.
+func CreateRefreshToken(ctx context.Context, t *model.RefreshToken) error {
+	if t.ID == "" {
+		t.ID = uuid.New().String()
+	}
+	if t.FamilyID == "" {
+		t.FamilyID = uuid.New().String()
+	}
+	t.CreatedAt = time.Now()
+
+	q := `INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, expires_at, created_at)
+	      VALUES ($1,$2,$3,$4,$5,$6)`
+	_, err := database.PostgresDB.ExecContext(ctx, q,
+		t.ID, t.UserID, t.FamilyID, t.TokenHash, t.ExpiresAt, t.CreatedAt,
+	)
+	return err
+}
+
+// GetRefreshTokenByHash returns the token row for a sha256 hash (nil if none).
+func GetRefreshTokenByHash(ctx context.Context, hash string) (*model.RefreshToken, error) {
+	q := `SELECT id, user_id, family_id, token_hash, expires_at, used_at, revoked_at, created_at
+	      FROM refresh_tokens WHERE token_hash=$1`
+	row := database.PostgresDB.QueryRowContext(ctx, q, hash)
+
+	var t model.RefreshToken
+	var used, revoked sql.NullTime
+	if err := row.Scan(&t.ID, &t.UserID, &t.FamilyID, &t.TokenHash, &t.ExpiresAt, &used, &revoked, &t.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if used.Valid {
+		v := used.Time
+		t.UsedAt = &v
+	}
+	if revoked.Valid {
+		v := revoked.Time
+		t.RevokedAt = &v
+	}
+	return &t, nil
+}
+
+// MarkRefreshTokenUsed atomically consumes a token. It returns false when the
+// token was already used or revoked, which callers must treat as reuse.
+func MarkRefreshTokenUsed(ctx context.Context, id string) (bool, error) {
+	q := `UPDATE refresh_tokens SET used_at=$1
+	      WHERE id=$2 AND used_at IS NULL AND revoked_at IS NULL`
+	res, err := database.PostgresDB.ExecContext(ctx, q, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// RevokeRefreshTokenFamily revokes every token that descends from the same login.
+func RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	q := `UPDATE refresh_tokens SET revoked_at=$1 WHERE family_id=$2 AND revoked_at IS NULL`
+	_, err := database.PostgresDB.ExecContext(ctx, q, time.Now(), familyID)
+	return err
+}
+
+// RevokeUserRefreshTokens revokes every outstanding refresh token of a user.
+func RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+	q := `UPDATE refresh_tokens SET revoked_at=$1 WHERE user_id=$2 AND revoked_at IS NULL`
+	_, err := database.PostgresDB.ExecContext(ctx, q, time.Now(), userID)
+	return err
+}
@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"context"
+
+	"clean-arch/database"
+)
+
+// RevocationChannel is the NOTIFY channel carrying access-token revocations
+// ("jti|<jti>|<expiry>", "user|<user id>|<cutoff>", "session|<sid>|<revoked>",
+// times in unix microseconds). Every API instance listens on it to
+// update its in-memory revocation store.
+const RevocationChannel = "token_revoked"
+
+// NotifyRevocation publishes one revocation event to all instances.
+func NotifyRevocation(ctx context.Context, payload string) error {
+	_, err := database.PostgresDB.ExecContext(ctx, `SELECT pg_notify($1, $2)`, RevocationChannel, payload)
+	return err
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"clean-arch/database"
+)
+
+// RevokeAccessToken stores a revoked jti until the token would have expired.
+func RevokeAccessToken(ctx context.Context, jti, userID string, expiresAt time.Time) error {
+	q := `INSERT INTO revoked_tokens (jti, user_id, expires_at, revoked_at)
+	      VALUES ($1,$2,$3,$4) ON CONFLICT (jti) DO NOTHING`
+	_, err := database.PostgresDB.ExecContext(ctx, q, jti, userID, expiresAt, time.Now())
+	return err
+}
+
+// ClaimAccessToken stores a revoked jti unless it is already there. It returns
+// false if another caller revoked (or claimed) the token first, so exactly one
+// request gets to use a one-shot token.
+func ClaimAccessToken(ctx context.Context, jti, userID string, expiresAt time.Time) (bool, error) {
+	q := `INSERT INTO revoked_tokens (jti, user_id, expires_at, revoked_at)
+	      VALUES ($1,$2,$3,$4) ON CONFLICT (jti) DO NOTHING`
+	res, err := database.PostgresDB.ExecContext(ctx, q, jti, userID, expiresAt, time.Now())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// ReleaseAccessToken drops a claim taken with ClaimAccessToken.
+func ReleaseAccessToken(ctx context.Context, jti string) error {
+	_, err := database.PostgresDB.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE jti=$1`, jti)
+	return err
+}
+
+// ListActiveRevokedTokens returns jti -> expiry for revocations that still matter.
+func ListActiveRevokedTokens(ctx context.Context) (map[string]time.Time, error) {
+	q := `SELECT jti, expires_at FROM revoked_tokens WHERE expires_at > $1`
+	rows, err := database.PostgresDB.QueryContext(ctx, q, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]time.Time{}
+	for rows.Next() {
+		var jti string
+		var exp time.Time
+		if err := rows.Scan(&jti, &exp); err != nil {
+			return nil, err
+		}
+		out[jti] = exp
+	}
+	return out, rows.Err()
+}
+
+// SetUserTokenCutoff invalidates every access token of the user issued before the given time.
+func SetUserTokenCutoff(ctx context.Context, userID string, before time.Time) error {
+	q := `INSERT INTO user_token_cutoffs (user_id, revoked_before) VALUES ($1,$2)
+	      ON CONFLICT (user_id) DO UPDATE SET revoked_before = EXCLUDED.revoked_before`
+	_, err := database.PostgresDB.ExecContext(ctx, q, userID, before)
+	return err
+}
+
+// ListUserTokenCutoffs returns user_id -> cutoff for cutoffs newer than since.
+func ListUserTokenCutoffs(ctx context.Context, since time.Time) (map[string]time.Time, error) {
+	q := `SELECT user_id, revoked_before FROM user_token_cutoffs WHERE revoked_before > $1`
+	rows, err := database.PostgresDB.QueryContext(ctx, q, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]time.Time{}
+	for rows.Next() {
+		var uid string
+		var before time.Time
+		if err := rows.Scan(&uid, &before); err != nil {
+			return nil, err
+		}
+		out[uid] = before
+	}
+	return out, rows.Err()
+}
+
+// PurgeExpiredRevocations drops revoked jtis whose tokens have expired anyway.
+func PurgeExpiredRevocations(ctx context.Context) error {
+	_, err := database.PostgresDB.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at <= $1`, time.Now())
+	return err
+}
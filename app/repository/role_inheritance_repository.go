@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"clean-arch/app/model"
+	"clean-arch/database"
+
+	"github.com/lib/pq"
+)
+
+// ErrRoleCycle is returned when an inheritance edge would make a role its own ancestor.
+var ErrRoleCycle = errors.New("role inheritance cycle")
+
+// ListRoleParents returns the roles a role inherits from directly.
+func ListRoleParents(ctx context.Context, roleID string) ([]model.Role, error) {
+	q := `SELECT r.id, r.name, r.description, r.perm_version, r.mfa_required, r.created_at, r.updated_at
+	      FROM roles r JOIN role_inherits ri ON ri.parent_role_id = r.id
+	      WHERE ri.role_id=$1 ORDER BY r.name`
+	rows, err := database.PostgresDB.QueryContext(ctx, q, roleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.Role{}
+	for rows.Next() {
+		var r model.Role
+		if err := rows.Scan(&r.ID, &r.Name, &r.Desc, &r.PermVersion, &r.MFARequired, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// AddRoleParent makes roleID inherit parentID's permissions. It fails with
+// ErrRoleCycle when roleID already is (transitively) an ancestor of
+// parentID. The role and its heirs get their perm_version bumped; their IDs
+// are returned.
+func AddRoleParent(ctx context.Context, roleID, parentID string) ([]string, error) {
+	if roleID == parentID {
+		return nil, ErrRoleCycle
+	}
+	tx, err := database.PostgresDB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// serialize graph changes so two concurrent edges can't close a cycle
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE role_inherits IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return nil, err
+	}
+	var cycle bool
+	q := `WITH RECURSIVE ancestors(id) AS (
+	          SELECT parent_role_id FROM role_inherits WHERE role_id=$1
+	          UNION
+	          SELECT ri.parent_role_id FROM role_inherits ri JOIN ancestors a ON ri.role_id = a.id
+	      )
+	      SELECT EXISTS (SELECT 1 FROM ancestors WHERE id=$2)`
+	if err := tx.QueryRowContext(ctx, q, parentID, roleID).Scan(&cycle); err != nil {
+		return nil, err
+	}
+	if cycle {
+		return nil, ErrRoleCycle
+	}
+
+	res, err := tx.ExecContext(ctx, `INSERT INTO role_inherits (role_id, parent_role_id) VALUES ($1,$2) ON CONFLICT DO NOTHING`, roleID, parentID)
+	if err != nil {
+		return nil, err
+	}
+	var bumped []string
+	if n, _ := res.RowsAffected(); n > 0 {
+		if bumped, err = bumpRoleHeirs(ctx, tx, []string{roleID}); err != nil {
+			return nil, err
+		}
+	}
+	return bumped, tx.Commit()
+}
+
+// RemoveRoleParent drops an inheritance edge and bumps the role and its heirs.
+func RemoveRoleParent(ctx context.Context, roleID, parentID string) ([]string, error) {
+	tx, err := database.PostgresDB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM role_inherits WHERE role_id=$1 AND parent_role_id=$2`, roleID, parentID)
+	if err != nil {
+		return nil, err
+	}
+	var bumped []string
+	if n, _ := res.RowsAffected(); n > 0 {
+		if bumped, err = bumpRoleHeirs(ctx, tx, []string{roleID}); err != nil {
+			return nil, err
+		}
+	}
+	return bumped, tx.Commit()
+}
+
+// bumpRoleHeirs increments perm_version of the given roles and of every
+// role inheriting from them, publishes a change event for each and returns
+// the IDs it bumped.
+func bumpRoleHeirs(ctx context.Context, tx *sql.Tx, roleIDs []string) ([]string, error) {
+	q := `WITH RECURSIVE heirs(id) AS (
+	          SELECT id FROM roles WHERE id = ANY($1)
+	          UNION
+	          SELECT ri.role_id FROM role_inherits ri JOIN heirs h ON ri.parent_role_id = h.id
+	      )
+	      UPDATE roles SET perm_version = perm_version + 1
+	      WHERE id IN (SELECT id FROM heirs)
+	      RETURNING id`
+	rows, err := tx.QueryContext(ctx, q, pq.Array(roleIDs))
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// other instances evict their cached copies once this commits
+	return out, notifyPermChange(ctx, tx, out)
+}
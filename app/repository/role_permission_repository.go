@@ -2,14 +2,56 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 
+	"clean-arch/app/model"
 	"clean-arch/database"
 )
 
-func AssignPermissionToRole(ctx context.Context, roleID, permissionID string) error {
+// AssignPermissionToRole grants a permission and bumps the perm_version of
+// the role and of every role inheriting from it. It returns the bumped role
+// IDs (empty when the grant already existed).
+func AssignPermissionToRole(ctx context.Context, roleID, permissionID string) ([]string, error) {
+	tx, err := database.PostgresDB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
 	q := `INSERT INTO role_permissions (role_id, permission_id) VALUES ($1,$2) ON CONFLICT DO NOTHING`
-	_, err := database.PostgresDB.ExecContext(ctx, q, roleID, permissionID)
-	return err
+	res, err := tx.ExecContext(ctx, q, roleID, permissionID)
+	if err != nil {
+		return nil, err
+	}
+	var bumped []string
+	if n, _ := res.RowsAffected(); n > 0 {
+		if bumped, err = bumpRoleHeirs(ctx, tx, []string{roleID}); err != nil {
+			return nil, err
+		}
+	}
+	return bumped, tx.Commit()
+}
+
+// RevokePermissionFromRole removes a grant and bumps the role and its heirs.
+func RevokePermissionFromRole(ctx context.Context, roleID, permissionID string) ([]string, error) {
+	tx, err := database.PostgresDB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	q := `DELETE FROM role_permissions WHERE role_id=$1 AND permission_id=$2`
+	res, err := tx.ExecContext(ctx, q, roleID, permissionID)
+	if err != nil {
+		return nil, err
+	}
+	var bumped []string
+	if n, _ := res.RowsAffected(); n > 0 {
+		if bumped, err = bumpRoleHeirs(ctx, tx, []string{roleID}); err != nil {
+			return nil, err
+		}
+	}
+	return bumped, tx.Commit()
 }
 
 func ListPermissionsByRole(ctx context.Context, roleID string) ([]string, error) {
@@ -25,3 +67,64 @@ func ListPermissionsByRole(ctx context.Context, roleID string) ([]string, error)
 	}
 	return out, nil
 }
+
+// ListRolePermissionDetails returns the full permission rows granted to a role.
+func ListRolePermissionDetails(ctx context.Context, roleID string) ([]model.Permission, error) {
+	q := `SELECT p.id, p.name, p.resource, p.action, p.description
+	      FROM permissions p JOIN role_permissions rp ON rp.permission_id = p.id
+	      WHERE rp.role_id=$1 ORDER BY p.name`
+	rows, err := database.PostgresDB.QueryContext(ctx, q, roleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.Permission{}
+	for rows.Next() {
+		var p model.Permission
+		if err := rows.Scan(&p.ID, &p.Name, &p.Resource, &p.Action, &p.Description); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// LoadRolePermissions returns the role's effective permission names (its
+// own grants plus everything inherited from ancestor roles) with its current
+// perm_version. Names may be patterns such as "achievements.*" or "*".
+func LoadRolePermissions(ctx context.Context, roleID string) ([]string, int, error) {
+	var version int
+	if err := database.PostgresDB.QueryRowContext(ctx, `SELECT perm_version FROM roles WHERE id=$1`, roleID).Scan(&version); err != nil {
+		if err == sql.ErrNoRows {
+			return []string{}, 0, nil
+		}
+		return nil, 0, err
+	}
+	// UNION (not UNION ALL) drops revisited roles, so a cycle can't loop
+	q := `WITH RECURSIVE lineage(id) AS (
+	          SELECT id FROM roles WHERE id=$1
+	          UNION
+	          SELECT ri.parent_role_id FROM role_inherits ri JOIN lineage l ON ri.role_id = l.id
+	      )
+	      SELECT DISTINCT p.name FROM permissions p JOIN role_permissions rp ON rp.permission_id = p.id
+	      WHERE rp.role_id IN (SELECT id FROM lineage) ORDER BY p.name`
+	rows, err := database.PostgresDB.QueryContext(ctx, q, roleID)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	perms := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, 0, err
+		}
+		perms = append(perms, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return perms, version, nil
+}
@@ -9,6 +9,7 @@ import (
 	"clean-arch/app/model"
 	"clean-arch/database"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // CreateRole inserts a new role (sets created_at & updated_at)
@@ -23,15 +24,18 @@ func CreateRole(ctx context.Context, r *model.Role) error {
 	q := `INSERT INTO roles (id, name, description, created_at, updated_at)
 		  VALUES ($1,$2,$3,$4,$5)`
 	_, err := database.PostgresDB.ExecContext(ctx, q, r.ID, r.Name, r.Desc, r.CreatedAt, r.UpdatedAt)
+	if err == nil {
+		r.PermVersion = 1
+	}
 	return err
 }
 
 // GetRoleByName returns role by name
 func GetRoleByName(ctx context.Context, name string) (*model.Role, error) {
 	var r model.Role
-	q := `SELECT id, name, description, created_at, updated_at FROM roles WHERE name=$1`
+	q := `SELECT id, name, description, perm_version, mfa_required, created_at, updated_at FROM roles WHERE name=$1`
 	row := database.PostgresDB.QueryRowContext(ctx, q, name)
-	if err := row.Scan(&r.ID, &r.Name, &r.Desc, &r.CreatedAt, &r.UpdatedAt); err != nil {
+	if err := row.Scan(&r.ID, &r.Name, &r.Desc, &r.PermVersion, &r.MFARequired, &r.CreatedAt, &r.UpdatedAt); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
@@ -43,9 +47,9 @@ func GetRoleByName(ctx context.Context, name string) (*model.Role, error) {
 // GetRoleByID returns role by id
 func GetRoleByID(ctx context.Context, id string) (*model.Role, error) {
 	var r model.Role
-	q := `SELECT id, name, description, created_at, updated_at FROM roles WHERE id=$1`
+	q := `SELECT id, name, description, perm_version, mfa_required, created_at, updated_at FROM roles WHERE id=$1`
 	row := database.PostgresDB.QueryRowContext(ctx, q, id)
-	if err := row.Scan(&r.ID, &r.Name, &r.Desc, &r.CreatedAt, &r.UpdatedAt); err != nil {
+	if err := row.Scan(&r.ID, &r.Name, &r.Desc, &r.PermVersion, &r.MFARequired, &r.CreatedAt, &r.UpdatedAt); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
@@ -53,3 +57,142 @@ func GetRoleByID(ctx context.Context, id string) (*model.Role, error) {
 	}
 	return &r, nil
 }
+
+// SetRoleMFARequired makes TOTP mandatory (or optional) for users of the role
+func SetRoleMFARequired(ctx context.Context, roleID string, required bool) (bool, error) {
+	q := `UPDATE roles SET mfa_required=$1, updated_at=$2 WHERE id=$3`
+	res, err := database.PostgresDB.ExecContext(ctx, q, required, time.Now(), roleID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ErrRoleInUse is returned when deleting a role users still hold without a replacement.
+var ErrRoleInUse = errors.New("role is still assigned to users")
+
+// ListRoles returns all roles with the number of users holding each
+func ListRoles(ctx context.Context) ([]model.Role, error) {
+	q := `SELECT r.id, r.name, r.description, r.perm_version, r.mfa_required, r.created_at, r.updated_at,
+	             (SELECT COUNT(*) FROM users u WHERE u.role_id = r.id)
+	      FROM roles r ORDER BY r.name`
+	rows, err := database.PostgresDB.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.Role{}
+	for rows.Next() {
+		var r model.Role
+		var n int
+		if err := rows.Scan(&r.ID, &r.Name, &r.Desc, &r.PermVersion, &r.MFARequired, &r.CreatedAt, &r.UpdatedAt, &n); err != nil {
+			return nil, err
+		}
+		r.UserCount = &n
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// UpdateRole changes a role's name and description
+func UpdateRole(ctx context.Context, r *model.Role) (bool, error) {
+	r.UpdatedAt = time.Now()
+	q := `UPDATE roles SET name=$1, description=$2, updated_at=$3 WHERE id=$4`
+	res, err := database.PostgresDB.ExecContext(ctx, q, r.Name, r.Desc, r.UpdatedAt, r.ID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ReassignRoleUsers moves users from one role to another in a single
+// transaction. With userIDs empty every holder of fromRoleID is moved.
+// It returns the IDs of the users that were moved.
+func ReassignRoleUsers(ctx context.Context, fromRoleID, toRoleID string, userIDs []string) ([]string, error) {
+	tx, err := database.PostgresDB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	moved, err := reassignRoleUsers(ctx, tx, fromRoleID, toRoleID, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	return moved, tx.Commit()
+}
+
+// DeleteRole deletes a role and its grants. Users holding it are moved to
+// replacementID in the same transaction; without a replacement the delete
+// fails with ErrRoleInUse while any user holds the role. Roles inheriting
+// from it lose those permissions and are returned in bumped. found is false
+// when the role does not exist.
+func DeleteRole(ctx context.Context, id, replacementID string) (moved, bumped []string, found bool, err error) {
+	tx, err := database.PostgresDB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer tx.Rollback()
+
+	// lock the role row so no assignment slips in between check and delete
+	var locked string
+	if err := tx.QueryRowContext(ctx, `SELECT id FROM roles WHERE id=$1 FOR UPDATE`, id).Scan(&locked); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, false, nil
+		}
+		return nil, nil, false, err
+	}
+
+	if replacementID != "" {
+		if moved, err = reassignRoleUsers(ctx, tx, id, replacementID, nil); err != nil {
+			return nil, nil, true, err
+		}
+	} else {
+		var n int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE role_id=$1`, id).Scan(&n); err != nil {
+			return nil, nil, true, err
+		}
+		if n > 0 {
+			return nil, nil, true, ErrRoleInUse
+		}
+	}
+
+	// heirs must be found before the cascade removes their edges
+	if bumped, err = bumpRoleHeirs(ctx, tx, []string{id}); err != nil {
+		return nil, nil, true, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role_id=$1`, id); err != nil {
+		return nil, nil, true, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM roles WHERE id=$1`, id); err != nil {
+		return nil, nil, true, err
+	}
+	return moved, bumped, true, tx.Commit()
+}
+
+func reassignRoleUsers(ctx context.Context, tx *sql.Tx, fromRoleID, toRoleID string, userIDs []string) ([]string, error) {
+	q := `UPDATE users SET role_id=$2, updated_at=NOW() WHERE role_id=$1 RETURNING id`
+	args := []interface{}{fromRoleID, toRoleID}
+	if len(userIDs) > 0 {
+		q = `UPDATE users SET role_id=$2, updated_at=NOW() WHERE role_id=$1 AND id = ANY($3) RETURNING id`
+		args = append(args, pq.Array(userIDs))
+	}
+	rows, err := tx.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	moved := []string{}
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			return nil, err
+		}
+		moved = append(moved, uid)
+	}
+	return moved, rows.Err()
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"clean-arch/app/model"
+	"clean-arch/database"
+
+	"github.com/google/uuid"
+)
+
+// CreateSession inserts a new session row.
+func CreateSession(ctx context.Context, s *model.UserSession) error {
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	now := time.Now()
+	s.CreatedAt = now
+	s.LastSeenAt = now
+
+	q := `INSERT INTO user_sessions (id, user_id, user_agent, ip, created_at, last_seen_at)
+	      VALUES ($1,$2,$3,$4,$5,$6)`
+	_, err := database.PostgresDB.ExecContext(ctx, q,
+		s.ID, s.UserID, s.UserAgent, s.IP, s.CreatedAt, s.LastSeenAt,
+	)
+	return err
+}
+
+// ListUserSessions returns the live sessions of a user seen after since, newest first.
+func ListUserSessions(ctx context.Context, userID string, since time.Time) ([]model.UserSession, error) {
+	q := `SELECT id, user_id, user_agent, ip, created_at, last_seen_at
+	      FROM user_sessions
+	      WHERE user_id=$1 AND revoked_at IS NULL AND last_seen_at > $2
+	      ORDER BY last_seen_at DESC`
+	rows, err := database.PostgresDB.QueryContext(ctx, q, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []model.UserSession{}
+	for rows.Next() {
+		var s model.UserSession
+		if err := rows.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// TouchSession records activity on a session.
+func TouchSession(ctx context.Context, id, ip string, at time.Time) error {
+	q := `UPDATE user_sessions SET last_seen_at=$1, ip=$2 WHERE id=$3 AND revoked_at IS NULL`
+	_, err := database.PostgresDB.ExecContext(ctx, q, at, ip, id)
+	return err
+}
+
+// RevokeSession marks a live session of the user revoked. It returns false
+// when no such live session exists.
+func RevokeSession(ctx context.Context, userID, id string) (bool, error) {
+	q := `UPDATE user_sessions SET revoked_at=$1 WHERE id=$2 AND user_id=$3 AND revoked_at IS NULL`
+	res, err := database.PostgresDB.ExecContext(ctx, q, time.Now(), id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// RevokeUserSessionRows marks every live session of the user revoked.
+func RevokeUserSessionRows(ctx context.Context, userID string) error {
+	q := `UPDATE user_sessions SET revoked_at=$1 WHERE user_id=$2 AND revoked_at IS NULL`
+	_, err := database.PostgresDB.ExecContext(ctx, q, time.Now(), userID)
+	return err
+}
+
+// ListRevokedSessions returns session id -> revoked_at for sessions revoked after since.
+func ListRevokedSessions(ctx context.Context, since time.Time) (map[string]time.Time, error) {
+	q := `SELECT id, revoked_at FROM user_sessions WHERE revoked_at > $1`
+	rows, err := database.PostgresDB.QueryContext(ctx, q, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]time.Time{}
+	for rows.Next() {
+		var id string
+		var at sql.NullTime
+		if err := rows.Scan(&id, &at); err != nil {
+			return nil, err
+		}
+		out[id] = at.Time
+	}
+	return out, rows.Err()
+}
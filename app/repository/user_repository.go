@@ -26,14 +26,14 @@ func CreateUser(ctx context.Context, u *model.User) error {
 
 	q := `
 		INSERT INTO users 
-			(id, username, email, password_hash, full_name, role_id, is_active, created_at, updated_at)
+			(id, username, email, password_hash, full_name, role_id, is_active, is_service_account, created_at, updated_at)
 		VALUES 
-			($1,$2,$3,$4,$5,$6,$7,$8,$9)
+			($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
 	`
 
 	_, err := database.PostgresDB.ExecContext(ctx, q,
 		u.ID, u.Username, u.Email, u.PasswordHash,
-		u.FullName, u.RoleID, u.IsActive, u.CreatedAt, u.UpdatedAt,
+		u.FullName, u.RoleID, u.IsActive, u.IsServiceAccount, u.CreatedAt, u.UpdatedAt,
 	)
 
 	return err
@@ -48,7 +48,7 @@ func GetUserByID(ctx context.Context, id string) (*model.User, error) {
 
 	q := `
 		SELECT id, username, email, password_hash, full_name, role_id, 
-		       is_active, created_at, updated_at
+		       is_active, is_service_account, created_at, updated_at
 		FROM users WHERE id=$1
 	`
 
@@ -56,7 +56,7 @@ func GetUserByID(ctx context.Context, id string) (*model.User, error) {
 
 	if err := row.Scan(
 		&u.ID, &u.Username, &u.Email, &u.PasswordHash,
-		&u.FullName, &u.RoleID, &u.IsActive,
+		&u.FullName, &u.RoleID, &u.IsActive, &u.IsServiceAccount,
 		&u.CreatedAt, &u.UpdatedAt,
 	); err != nil {
 
@@ -78,7 +78,7 @@ func GetUserByUsernameOrEmail(ctx context.Context, identifier string) (*model.Us
 
 	q := `
 		SELECT id, username, email, password_hash, full_name, role_id, 
-		       is_active, created_at, updated_at
+		       is_active, is_service_account, created_at, updated_at
 		FROM users 
 		WHERE username=$1 OR email=$1
 	`
@@ -87,7 +87,7 @@ func GetUserByUsernameOrEmail(ctx context.Context, identifier string) (*model.Us
 
 	if err := row.Scan(
 		&u.ID, &u.Username, &u.Email, &u.PasswordHash,
-		&u.FullName, &u.RoleID, &u.IsActive,
+		&u.FullName, &u.RoleID, &u.IsActive, &u.IsServiceAccount,
 		&u.CreatedAt, &u.UpdatedAt,
 	); err != nil {
 
@@ -142,7 +142,7 @@ func DeleteUser(ctx context.Context, id string) error {
 func ListUsers(ctx context.Context) ([]model.User, error) {
 	q := `
 		SELECT id, username, email, password_hash, full_name, role_id,
-		       is_active, created_at, updated_at
+		       is_active, is_service_account, created_at, updated_at
 		FROM users
 		ORDER BY created_at DESC
 	`
@@ -159,7 +159,55 @@ func ListUsers(ctx context.Context) ([]model.User, error) {
 		var u model.User
 		if err := rows.Scan(
 			&u.ID, &u.Username, &u.Email, &u.PasswordHash,
-			&u.FullName, &u.RoleID, &u.IsActive,
+			&u.FullName, &u.RoleID, &u.IsActive, &u.IsServiceAccount,
+			&u.CreatedAt, &u.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+//
+// =======================
+// UPDATE PASSWORD
+// =======================
+func UpdateUserPassword(ctx context.Context, id, passwordHash string) error {
+	q := `UPDATE users SET password_hash=$1, updated_at=$2 WHERE id=$3`
+
+	_, err := database.PostgresDB.ExecContext(ctx, q, passwordHash, time.Now(), id)
+
+	return err
+}
+
+//
+// =======================
+// LIST SERVICE ACCOUNTS
+// =======================
+func ListServiceAccounts(ctx context.Context) ([]model.User, error) {
+	q := `
+		SELECT id, username, email, password_hash, full_name, role_id,
+		       is_active, is_service_account, created_at, updated_at
+		FROM users
+		WHERE is_service_account = TRUE
+		ORDER BY created_at DESC
+	`
+
+	rows, err := database.PostgresDB.QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []model.User{}
+
+	for rows.Next() {
+		var u model.User
+		if err := rows.Scan(
+			&u.ID, &u.Username, &u.Email, &u.PasswordHash,
+			&u.FullName, &u.RoleID, &u.IsActive, &u.IsServiceAccount,
 			&u.CreatedAt, &u.UpdatedAt,
 		); err != nil {
 			return nil, err
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"clean-arch/app/model"
+	repo "clean-arch/app/repository"
+	"clean-arch/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	mgo "go.mongodb.org/mongo-driver/mongo"
+)
+
+// Limits on editable achievement fields.
+const (
+	maxTitleLen       = 200
+	maxDescriptionLen = 5000
+	maxTags           = 20
+	maxTagLen         = 50
+)
+
+// studentEditableFields may be changed by the owning student.
+var studentEditableFields = map[string]bool{
+	"title":       true,
+	"description": true,
+	"details":     true,
+	"tags":        true,
+}
+
+// overrideEditableFields may be changed through the admin override.
+var overrideEditableFields = map[string]bool{
+	"achievementType": true,
+	"title":           true,
+	"description":     true,
+	"details":         true,
+	"tags":            true,
+	"points":          true,
+}
+
+// achievementTypes are the accepted achievementType values.
+var achievementTypes = map[string]bool{
+	"academic":      true,
+	"competition":   true,
+	"organization":  true,
+	"publication":   true,
+	"certification": true,
+	"other":         true,
+}
+
+// achievementEdit is the typed form of an edit body; nil means "unchanged".
+type achievementEdit struct {
+	AchievementType *string                 `json:"achievementType"`
+	Title           *string                 `json:"title"`
+	Description     *string                 `json:"description"`
+	Details         *map[string]interface{} `json:"details"`
+	Tags            *[]string               `json:"tags"`
+	Points          *int                    `json:"points"`
+}
+
+// parseAchievementEdit checks an edit body against the allowed fields and
+// their types and returns the $set document. On a bad body it returns the
+// error response instead.
+func parseAchievementEdit(body []byte, allowed map[string]bool) (bson.M, fiber.Map) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fiber.Map{"error": "body must be a JSON object"}
+	}
+	var denied []string
+	for k := range raw {
+		if !allowed[k] {
+			denied = append(denied, k)
+		}
+	}
+	if len(denied) > 0 {
+		sort.Strings(denied)
+		return nil, fiber.Map{"error": "fields not editable", "fields": denied}
+	}
+
+	var in achievementEdit
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&in); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, fiber.Map{"error": fmt.Sprintf("field %s must be %s", typeErr.Field, typeErr.Type)}
+		}
+		return nil, fiber.Map{"error": err.Error()}
+	}
+
+	set := bson.M{}
+	if in.AchievementType != nil {
+		if !achievementTypes[*in.AchievementType] {
+			return nil, fiber.Map{"error": "unknown achievementType " + *in.AchievementType}
+		}
+		set["achievementType"] = *in.AchievementType
+	}
+	if in.Title != nil {
+		title := strings.TrimSpace(*in.Title)
+		if title == "" || len(title) > maxTitleLen {
+			return nil, fiber.Map{"error": fmt.Sprintf("title must be 1-%d characters", maxTitleLen)}
+		}
+		set["title"] = title
+	}
+	if in.Description != nil {
+		if len(*in.Description) > maxDescriptionLen {
+			return nil, fiber.Map{"error": fmt.Sprintf("description must be at most %d characters", maxDescriptionLen)}
+		}
+		set["description"] = *in.Description
+	}
+	if in.Details != nil {
+		set["details"] = *in.Details
+	}
+	if in.Tags != nil {
+		tags := []string{}
+		seen := map[string]bool{}
+		for _, t := range *in.Tags {
+			t = strings.TrimSpace(t)
+			if t == "" || seen[t] {
+				continue
+			}
+			if len(t) > maxTagLen {
+				return nil, fiber.Map{"error": fmt.Sprintf("tags must be at most %d characters", maxTagLen)}
+			}
+			seen[t] = true
+			tags = append(tags, t)
+		}
+		if len(tags) > maxTags {
+			return nil, fiber.Map{"error": fmt.Sprintf("at most %d tags", maxTags)}
+		}
+		set["tags"] = tags
+	}
+	if in.Points != nil {
+		if *in.Points < 0 {
+			return nil, fiber.Map{"error": "points must not be negative"}
+		}
+		set["points"] = *in.Points
+	}
+	if len(set) == 0 {
+		return nil, fiber.Map{"error": "no fields to update"}
+	}
+	return set, nil
+}
+
+// OverrideAchievementService handles PUT /achievements/:id/override
+// @Summary Admin override of an achievement
+// @Tags Achievements
+// @Description Admin edit outside the student workflow (any status, points and type included). A reason is required; every override is audited with its field changes and the resulting version.
+// @Accept json
+// @Produce json
+// @Param id path string true "Achievement ID"
+// @Param body body object true "Override" example({"reason":"koreksi poin sesuai SK","fields":{"points":30}})
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security Bearer
+// @Router /achievements/{id}/override [put]
+func OverrideAchievementService(c *fiber.Ctx, db *mgo.Database) error {
+	id := c.Params("id")
+	var body struct {
+		Reason string          `json:"reason"`
+		Fields json.RawMessage `json:"fields"`
+	}
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "body must be a JSON object"})
+	}
+	reason := strings.TrimSpace(body.Reason)
+	if reason == "" || len(body.Fields) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "reason and fields required"})
+	}
+	set, bad := parseAchievementEdit(body.Fields, overrideEditableFields)
+	if bad != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(bad)
+	}
+
+	subject, err := middleware.CurrentSubject(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !subject.Admin {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "admin only"})
+	}
+	before, err := repo.GetAchievementByID(db, id)
+	if err != nil || before == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not found"})
+	}
+
+	// keep the pre-versioning state (what was verified) before changing it
+	if !backfillVersion(c, db, id) {
+		return nil
+	}
+	// audit the intent first so no override lands unrecorded
+	intended, err := previewAchievementEdit(*before, set)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	audit := &model.AchievementOverrideAudit{
+		AchievementID: id,
+		ActorID:       subject.UserID,
+		Reason:        reason,
+		Changes:       diffAchievements(*before, intended),
+	}
+	if err := repo.CreateAchievementOverrideAudit(context.Background(), audit); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "audit failed, override not applied: " + err.Error()})
+	}
+
+	if err := repo.UpdateAchievement(db, id, set); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	v := snapshotAchievement(c, db, id, "admin_override")
+	if v == nil {
+		return nil
+	}
+	audit.Changes = diffAchievements(*before, v.Snapshot)
+	audit.Version = v.Version
+	if err := repo.SetAchievementOverrideResult(context.Background(), audit.ID, audit.Version, audit.Changes); err != nil {
+		// the intent is already audited; only the version link is missing
+		log.Printf("[achievement] override audit %s result error: %v", audit.ID, err)
+	}
+	return c.JSON(fiber.Map{"status": "updated", "version": v.Version, "changes": audit.Changes})
+}
+
+// previewAchievementEdit returns a with the $set document applied.
+func previewAchievementEdit(a model.Achievement, set bson.M) (model.Achievement, error) {
+	raw, err := bson.Marshal(a)
+	if err != nil {
+		return a, err
+	}
+	doc := bson.M{}
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return a, err
+	}
+	for k, v := range set {
+		doc[k] = v
+	}
+	if raw, err = bson.Marshal(doc); err != nil {
+		return a, err
+	}
+	var out model.Achievement
+	err = bson.Unmarshal(raw, &out)
+	return out, err
+}
+
+// ListAchievementOverridesService handles GET /achievements/:id/overrides
+// @Summary List admin overrides of an achievement
+// @Tags Achievements
+// @Produce json
+// @Param id path string true "Achievement ID"
+// @Success 200 {array} model.AchievementOverrideAudit
+// @Security Bearer
+// @Router /achievements/{id}/overrides [get]
+func ListAchievementOverridesService(c *fiber.Ctx) error {
+	out, err := repo.ListAchievementOverrideAudit(context.Background(), c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(out)
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"clean-arch/app/model"
+	"clean-arch/app/repository"
+	"clean-arch/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	mgo "go.mongodb.org/mongo-driver/mongo"
+)
+
+// authorizeAchievement applies the achievement policy for the caller on an
+// achievement owned by studentID. When the caller may not act it writes the
+// error response and returns false.
+func authorizeAchievement(c *fiber.Ctx, action, studentID string) bool {
+	subject, err := middleware.CurrentSubject(c)
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return false
+	}
+	var owner *model.Student
+	if !subject.Admin && studentID != "" {
+		if owner, err = repository.GetStudentByID(context.Background(), studentID); err != nil {
+			c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			return false
+		}
+	}
+	if !subject.CanActOnAchievement(action, owner) {
+		log.Printf("[policy] deny user=%s action=%s student=%s", subject.UserID, action, studentID)
+		c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "not allowed for this achievement"})
+		return false
+	}
+	return true
+}
+
+// achievementOwner returns the student owning a Mongo achievement, from its
+// Postgres reference or else the document itself ("" when neither exists).
+func achievementOwner(db *mgo.Database, mongoID string) (string, error) {
+	ref, err := repository.GetAchievementReferenceByMongoID(context.Background(), mongoID)
+	if err != nil {
+		return "", err
+	}
+	if ref != nil {
+		return ref.StudentID, nil
+	}
+	a, err := repository.GetAchievementByID(db, mongoID)
+	if err != nil || a == nil {
+		return "", nil
+	}
+	return a.StudentID, nil
+}
+
+// authorizeAchievementByMongoID resolves the owner of a Mongo achievement
+// and applies the policy; 404 when the achievement is unknown.
+func authorizeAchievementByMongoID(c *fiber.Ctx, db *mgo.Database, action, mongoID string) bool {
+	studentID, err := achievementOwner(db, mongoID)
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return false
+	}
+	if studentID == "" {
+		c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not found"})
+		return false
+	}
+	return authorizeAchievement(c, action, studentID)
+}
+
+func containsStudent(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
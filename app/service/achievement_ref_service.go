@@ -2,12 +2,15 @@
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"clean-arch/app/model"
 	"clean-arch/app/repository"
 	"clean-arch/middleware"
 	"github.com/gofiber/fiber/v2"
+	mgo "go.mongodb.org/mongo-driver/mongo"
 )
 
 // helper: ambil string dari map dengan beberapa alias
@@ -22,6 +25,54 @@ func getStringFromMap(m map[string]interface{}, keys ...string) string {
 	return ""
 }
 
+// authorizeReference applies the achievement policy to a reference by id
+// (404 when it doesn't exist) and returns the reference.
+func authorizeReference(c *fiber.Ctx, action, refID string) (*model.AchievementReference, bool) {
+	ref, err := repository.GetAchievementReferenceByID(context.Background(), refID)
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return nil, false
+	}
+	if ref == nil {
+		c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "reference not found"})
+		return nil, false
+	}
+	return ref, authorizeAchievement(c, action, ref.StudentID)
+}
+
+// transitionReference moves ref to status `to` through the workflow, as the
+// caller. On failure the response is written and false returned.
+func transitionReference(c *fiber.Ctx, ref *model.AchievementReference, to string, note *string) bool {
+	// a revision request must be fully addressed before any submit
+	if to == model.StatusSubmitted && !revisionResolved(c, ref) {
+		return false
+	}
+	actorID, _ := c.Locals(middleware.LocalsUserID).(string)
+	err := repository.UpdateAchievementReferenceStatus(context.Background(), ref.ID, ref.Status, to, actorID, note)
+	if err != nil {
+		writeTransitionError(c, ref, to, err)
+		return false
+	}
+	return true
+}
+
+// writeTransitionError answers a failed status change: 409 for an illegal
+// transition or one lost to a concurrent update, 500 otherwise.
+func writeTransitionError(c *fiber.Ctx, ref *model.AchievementReference, to string, err error) {
+	switch {
+	case errors.Is(err, model.ErrIllegalTransition):
+		c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   fmt.Sprintf("cannot move achievement from %s to %s", ref.Status, to),
+			"status":  ref.Status,
+			"allowed": model.NextStatuses(ref.Status),
+		})
+	case errors.Is(err, repository.ErrStatusChanged):
+		c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	default:
+		c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+}
+
 // CreateAchievementReferenceService
 // @Summary Create achievement reference (Postgres ref -> Mongo doc id)
 // @Tags AchievementReferences
@@ -31,10 +82,12 @@ func getStringFromMap(m map[string]interface{}, keys ...string) string {
 // @Param body body object true "Reference body" example({"studentId":"stud-1","mongoAchievementId":"mongo-abc-123"})
 // @Success 201 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Security Bearer
 // @Router /refs [post]
-func CreateAchievementReferenceService(c *fiber.Ctx) error {
+func CreateAchievementReferenceService(c *fiber.Ctx, db *mgo.Database) error {
 	var body struct {
 		StudentID          string `json:"studentId"`
 		MongoAchievementID string `json:"mongoAchievementId"`
@@ -56,17 +109,39 @@ func CreateAchievementReferenceService(c *fiber.Ctx) error {
 	if body.StudentID == "" || body.MongoAchievementID == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "studentId and mongoAchievementId required"})
 	}
+	if !authorizeAchievement(c, middleware.ActionEdit, body.StudentID) {
+		return nil
+	}
+	// the document must belong to that student and not be referenced yet
+	a, err := repository.GetAchievementByID(db, body.MongoAchievementID)
+	if err != nil || a == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "achievement not found"})
+	}
+	if a.StudentID != body.StudentID {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "achievement does not belong to this student"})
+	}
+	existing, err := repository.GetAchievementReferenceByMongoID(context.Background(), body.MongoAchievementID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if existing != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "achievement already has a reference", "referenceId": existing.ID})
+	}
 
 	now := time.Now()
 	ref := &model.AchievementReference{
 		StudentID:          body.StudentID,
 		MongoAchievementID: body.MongoAchievementID,
-		Status:             "draft",
+		Status:             model.StatusDraft,
 		CreatedAt:          now,
 		UpdatedAt:          now,
 	}
 
-	if err := repository.CreateAchievementReference(context.Background(), ref); err != nil {
+	actorID, _ := c.Locals(middleware.LocalsUserID).(string)
+	if err := repository.CreateAchievementReference(context.Background(), ref, actorID); err != nil {
+		if errors.Is(err, repository.ErrReferenceExists) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "achievement already has a reference"})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
@@ -85,6 +160,7 @@ func CreateAchievementReferenceService(c *fiber.Ctx) error {
 // @Param id path string true "Reference ID"
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]interface{}
 // @Failure 500 {object} map[string]string
 // @Security Bearer
 // @Router /refs/{id}/submit [post]
@@ -93,23 +169,28 @@ func SubmitAchievementReferenceService(c *fiber.Ctx) error {
 	if id == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "id required"})
 	}
-	if err := repository.UpdateAchievementReferenceStatus(context.Background(), id, "submitted", nil, nil); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	ref, ok := authorizeReference(c, middleware.ActionEdit, id)
+	if !ok {
+		return nil
 	}
-	return c.JSON(fiber.Map{"id": id, "status": "submitted"})
+	if !transitionReference(c, ref, model.StatusSubmitted, nil) {
+		return nil
+	}
+	return c.JSON(fiber.Map{"id": id, "status": model.StatusSubmitted})
 }
 
 // VerifyAchievementReferenceService
 // @Summary Verify a reference
 // @Tags AchievementReferences
-// @Description Lecturer/admin verifies a submitted reference. Verifier taken from JWT.
+// @Description Lecturer/admin verifies a submitted reference and pins the latest achievement version. Verifier taken from JWT.
 // @Param id path string true "Reference ID"
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]interface{}
 // @Failure 500 {object} map[string]string
 // @Security Bearer
 // @Router /refs/{id}/verify [post]
-func VerifyAchievementReferenceService(c *fiber.Ctx) error {
+func VerifyAchievementReferenceService(c *fiber.Ctx, db *mgo.Database) error {
 	id := c.Params("id")
 	if id == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "id required"})
@@ -119,10 +200,15 @@ func VerifyAchievementReferenceService(c *fiber.Ctx) error {
 	if verifierID == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "verifier id missing in token"})
 	}
-	if err := repository.UpdateAchievementReferenceStatus(context.Background(), id, "verified", &verifierID, nil); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	ref, ok := authorizeReference(c, middleware.ActionVerify, id)
+	if !ok {
+		return nil
+	}
+	version := verifyReference(c, db, ref, 0)
+	if version == 0 {
+		return nil
 	}
-	return c.JSON(fiber.Map{"id": id, "status": "verified"})
+	return c.JSON(fiber.Map{"id": id, "status": model.StatusVerified, "version": version})
 }
 
 // RejectAchievementReferenceService
@@ -133,6 +219,7 @@ func VerifyAchievementReferenceService(c *fiber.Ctx) error {
 // @Param body body object true "Reject body" example({"note":"dokumen kurang"})
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]interface{}
 // @Failure 500 {object} map[string]string
 // @Security Bearer
 // @Router /refs/{id}/reject [post]
@@ -154,9 +241,13 @@ func RejectAchievementReferenceService(c *fiber.Ctx) error {
 	if verifierID == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "verifier id missing in token"})
 	}
-	if err := repository.UpdateAchievementReferenceStatus(context.Background(), id, "rejected", &verifierID, &body.Note); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	ref, ok := authorizeReference(c, middleware.ActionVerify, id)
+	if !ok {
+		return nil
+	}
+	if !transitionReference(c, ref, model.StatusRejected, &body.Note) {
+		return nil
 	}
-	return c.JSON(fiber.Map{"id": id, "status": "rejected"})
+	return c.JSON(fiber.Map{"id": id, "status": model.StatusRejected})
 }
 
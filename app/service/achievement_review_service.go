@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"clean-arch/app/model"
+	repo "clean-arch/app/repository"
+	"clean-arch/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	mgo "go.mongodb.org/mongo-driver/mongo"
+)
+
+// reviewableFields are the achievement fields a review comment may point
+// at; "details.<key>" addresses a single dynamic detail.
+var reviewableFields = map[string]bool{
+	"achievementType": true,
+	"title":           true,
+	"description":     true,
+	"details":         true,
+	"tags":            true,
+	"points":          true,
+}
+
+func isReviewableField(field string) bool {
+	if strings.HasPrefix(field, "details.") {
+		return len(field) > len("details.")
+	}
+	return reviewableFields[field]
+}
+
+// achievementAttachmentIDs collects the attachment ids of an achievement,
+// from the attachments collection and the document itself.
+func achievementAttachmentIDs(db *mgo.Database, mongoID string) (map[string]bool, error) {
+	ids := map[string]bool{}
+	list, err := repo.ListAttachmentsByAchievement(db, mongoID)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range list {
+		ids[a.ID] = true
+	}
+	if a, err := repo.GetAchievementByID(db, mongoID); err == nil && a != nil {
+		for _, att := range a.Attachments {
+			ids[att.ID] = true
+		}
+	}
+	return ids, nil
+}
+
+// revisionResolved blocks a (re)submit while review comments are open (409
+// with the open comments). It checks whatever the current status, so going
+// through draft does not skip it. It writes the response and returns false then.
+func revisionResolved(c *fiber.Ctx, ref *model.AchievementReference) bool {
+	open, err := repo.ListReviewComments(context.Background(), ref.ID, true)
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return false
+	}
+	if len(open) > 0 {
+		c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":         "resolve all review comments before resubmitting",
+			"open_comments": open,
+		})
+		return false
+	}
+	return true
+}
+
+// RequestRevisionService handles POST /achievements/:id/request-revision
+// @Summary Request revision
+// @Tags Achievements
+// @Description Lecturer sends a submitted achievement back with comments keyed to fields ("title", "details.rank") or attachment ids.
+// @Accept json
+// @Produce json
+// @Param id path string true "Achievement ID"
+// @Param body body object true "Revision request" example({"note":"hampir lengkap","comments":[{"field":"title","comment":"gunakan nama resmi lomba"},{"attachmentId":"att-1","comment":"sertifikat buram"}]})
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]interface{}
+// @Security Bearer
+// @Router /achievements/{id}/request-revision [post]
+func RequestRevisionService(c *fiber.Ctx, db *mgo.Database) error {
+	mongoID := c.Params("id")
+	if mongoID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "id required"})
+	}
+	var body struct {
+		Note     string `json:"note"`
+		Comments []struct {
+			Field        string `json:"field"`
+			AttachmentID string `json:"attachmentId"`
+			Comment      string `json:"comment"`
+		} `json:"comments"`
+	}
+	if err := c.BodyParser(&body); err != nil || len(body.Comments) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "at least one comment required"})
+	}
+	comments := make([]model.AchievementReviewComment, 0, len(body.Comments))
+	needAttachments := false
+	for i, in := range body.Comments {
+		in.Field, in.AttachmentID, in.Comment = strings.TrimSpace(in.Field), strings.TrimSpace(in.AttachmentID), strings.TrimSpace(in.Comment)
+		switch {
+		case in.Comment == "":
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "comment text required", "index": i})
+		case (in.Field == "") == (in.AttachmentID == ""):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "each comment needs either field or attachmentId", "index": i})
+		case in.Field != "" && !isReviewableField(in.Field):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unknown field " + in.Field, "index": i})
+		}
+		needAttachments = needAttachments || in.AttachmentID != ""
+		comments = append(comments, model.AchievementReviewComment{Field: in.Field, AttachmentID: in.AttachmentID, Comment: in.Comment})
+	}
+
+	reviewerID, _ := c.Locals(middleware.LocalsUserID).(string)
+	if reviewerID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthenticated"})
+	}
+	ref, err := repo.GetAchievementReferenceByMongoID(context.Background(), mongoID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if ref == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "reference not found"})
+	}
+	if !authorizeAchievement(c, middleware.ActionVerify, ref.StudentID) {
+		return nil
+	}
+
+	if needAttachments {
+		ids, err := achievementAttachmentIDs(db, mongoID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		for i, cm := range comments {
+			if cm.AttachmentID != "" && !ids[cm.AttachmentID] {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unknown attachment " + cm.AttachmentID, "index": i})
+			}
+		}
+	}
+
+	var note *string
+	if n := strings.TrimSpace(body.Note); n != "" {
+		note = &n
+	}
+	if err := repo.RequestAchievementRevision(context.Background(), ref.ID, ref.Status, reviewerID, note, comments); err != nil {
+		writeTransitionError(c, ref, model.StatusRevisionRequested, err)
+		return nil
+	}
+	return c.JSON(fiber.Map{
+		"message":     "revision requested",
+		"referenceId": ref.ID,
+		"comments":    comments,
+	})
+}
+
+// ListReviewCommentsService handles GET /achievements/:id/review-comments
+// @Summary List review comments
+// @Tags Achievements
+// @Description Reviewer comments of all revision requests with their resolution state. open=true lists only unresolved ones.
+// @Produce json
+// @Param id path string true "Achievement ID"
+// @Param open query bool false "Only unresolved comments"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Security Bearer
+// @Router /achievements/{id}/review-comments [get]
+func ListReviewCommentsService(c *fiber.Ctx, db *mgo.Database) error {
+	mongoID := c.Params("id")
+	ref, err := repo.GetAchievementReferenceByMongoID(context.Background(), mongoID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if ref == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "reference not found"})
+	}
+	if !authorizeAchievement(c, middleware.ActionView, ref.StudentID) {
+		return nil
+	}
+	comments, err := repo.ListReviewComments(context.Background(), ref.ID, c.QueryBool("open"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	open := 0
+	for _, cm := range comments {
+		if !cm.Resolved() {
+			open++
+		}
+	}
+	return c.JSON(fiber.Map{
+		"referenceId": ref.ID,
+		"status":      ref.Status,
+		"open":        open,
+		"resolved":    len(comments) - open,
+		"comments":    comments,
+	})
+}
+
+// ResolveReviewCommentService handles POST /achievements/:id/review-comments/:commentId/resolve
+// @Summary Resolve a review comment
+// @Tags Achievements
+// @Description Student marks one reviewer comment as addressed, optionally saying how.
+// @Accept json
+// @Produce json
+// @Param id path string true "Achievement ID"
+// @Param commentId path string true "Comment ID"
+// @Param body body object false "Resolution" example({"note":"judul diganti sesuai sertifikat"})
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security Bearer
+// @Router /achievements/{id}/review-comments/{commentId}/resolve [post]
+func ResolveReviewCommentService(c *fiber.Ctx, db *mgo.Database) error {
+	mongoID, commentID := c.Params("id"), c.Params("commentId")
+	var body struct {
+		Note string `json:"note"`
+	}
+	_ = c.BodyParser(&body)
+
+	userID, _ := c.Locals(middleware.LocalsUserID).(string)
+	if userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthenticated"})
+	}
+	ctx := context.Background()
+	ref, err := repo.GetAchievementReferenceByMongoID(ctx, mongoID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if ref == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "reference not found"})
+	}
+	if !authorizeAchievement(c, middleware.ActionEdit, ref.StudentID) {
+		return nil
+	}
+	if ref.Status != model.StatusRevisionRequested {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "no revision requested", "status": ref.Status})
+	}
+	cm, err := repo.GetReviewComment(ctx, commentID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if cm == nil || cm.ReferenceID != ref.ID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "comment not found"})
+	}
+
+	var note *string
+	if n := strings.TrimSpace(body.Note); n != "" {
+		note = &n
+	}
+	ok, err := repo.ResolveReviewComment(ctx, cm.ID, userID, note)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !ok {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "comment already resolved"})
+	}
+	open, err := repo.ListReviewComments(ctx, ref.ID, true)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "comment resolved", "open": len(open)})
+}
@@ -3,6 +3,7 @@
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"strconv"
 	"time"
 	"strings"
@@ -63,15 +64,20 @@ func CreateAchievementService(c *fiber.Ctx, db *mgo.Database) error {
 	ref := &mongoModel.AchievementReference{
 		StudentID:          student.ID,
 		MongoAchievementID: created.ID.Hex(),
-		Status:             "draft",
+		Status:             mongoModel.StatusDraft,
 		CreatedAt:          now,
 		UpdatedAt:          now,
 	}
 
-	if err := repo.CreateAchievementReference(context.Background(), ref); err != nil {
+	if err := repo.CreateAchievementReference(context.Background(), ref, userID); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	// version 1 of the document
+	if snapshotAchievement(c, db, created.ID.Hex(), "create") == nil {
+		return nil
+	}
+
 	// 3️⃣ response
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"achievement": created,
@@ -104,19 +110,24 @@ func GetAchievementService(c *fiber.Ctx, db *mgo.Database) error {
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not found"})
 	}
+	if !authorizeAchievement(c, middleware.ActionView, a.StudentID) {
+		return nil
+	}
 	return c.JSON(a)
 }
 
 // UpdateAchievementService handles PUT /api/v1/achievements/:id
 // @Summary Update achievement
 // @Tags Achievements
-// @Description Update an achievement document by id.
+// @Description Owning student edits title, description, details or tags while the achievement is draft, rejected or revision_requested. Other fields (points, type, owner) are read-only here; admins use the override.
 // @Accept json
 // @Produce json
 // @Param id path string true "Achievement ID"
-// @Param body body object true "Update fields"
-// @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
+// @Param body body object true "Update fields" example({"title":"Juara 1 Gemastik","tags":["lomba"]})
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Security Bearer
 // @Router /achievements/{id} [put]
@@ -125,18 +136,86 @@ func UpdateAchievementService(c *fiber.Ctx, db *mgo.Database) error {
 	if id == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "id required"})
 	}
-	var update map[string]interface{}
-	if err := c.BodyParser(&update); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	set, bad := parseAchievementEdit(c.Body(), studentEditableFields)
+	if bad != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(bad)
 	}
 
-	delete(update, "_id")
-	delete(update, "createdAt")
+	if !studentCanEdit(c, db, id) {
+		return nil
+	}
+	if !backfillVersion(c, db, id) {
+		return nil
+	}
 
-	if err := repo.UpdateAchievement(db, id, bson.M(update)); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	if !studentEdit(c, id, func() error { return repo.UpdateAchievement(db, id, set) }) {
+		return nil
 	}
-	return c.JSON(fiber.Map{"status": "updated"})
+	v := snapshotAchievement(c, db, id, "update")
+	if v == nil {
+		return nil
+	}
+	return c.JSON(fiber.Map{"status": "updated", "version": v.Version})
+}
+
+// studentCanEdit reports whether the current user is the owning student and
+// the achievement is in a student-editable status; otherwise it writes the
+// 404/403/409 response. It guards every student change to the document or
+// its attachments.
+func studentCanEdit(c *fiber.Ctx, db *mgo.Database, id string) bool {
+	subject, err := middleware.CurrentSubject(c)
+	if err != nil {
+		_ = c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return false
+	}
+	ref, err := repo.GetAchievementReferenceByMongoID(context.Background(), id)
+	if err != nil {
+		_ = c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return false
+	}
+	ownerID, status := "", mongoModel.StatusDraft
+	if ref != nil {
+		ownerID, status = ref.StudentID, ref.Status
+	} else if a, err := repo.GetAchievementByID(db, id); err == nil && a != nil {
+		// documents without a reference have never left draft
+		ownerID = a.StudentID
+	}
+	if ownerID == "" {
+		_ = c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not found"})
+		return false
+	}
+	// only the owning student edits through this path
+	if subject.StudentID == "" || subject.StudentID != ownerID {
+		_ = c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "only the owning student can edit this achievement"})
+		return false
+	}
+	if !mongoModel.StudentEditable(status) {
+		_ = c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "achievement cannot be edited while " + status, "status": status})
+		return false
+	}
+	return true
+}
+
+// studentEdit applies a student change checked by studentCanEdit while the
+// workflow state is locked, re-checking the status first: a submit or
+// verify that landed after the check turns the edit into a 409. On failure
+// it writes the response and returns false.
+func studentEdit(c *fiber.Ctx, mongoID string, apply func() error) bool {
+	err := repo.WithStudentEditLock(context.Background(), mongoID, func(ref *mongoModel.AchievementReference) error {
+		if ref != nil && !mongoModel.StudentEditable(ref.Status) {
+			return repo.ErrStatusChanged
+		}
+		return apply()
+	})
+	switch {
+	case errors.Is(err, repo.ErrStatusChanged):
+		_ = c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "achievement status changed, it can no longer be edited"})
+		return false
+	case err != nil:
+		_ = c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return false
+	}
+	return true
 }
 
 // DeleteAchievementService (soft delete - mahasiswa)
@@ -147,6 +226,7 @@ func UpdateAchievementService(c *fiber.Ctx, db *mgo.Database) error {
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} map[string]string
 // @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]interface{}
 // @Failure 500 {object} map[string]string
 // @Security Bearer
 // @Router /achievements/{id} [delete]
@@ -156,33 +236,20 @@ func DeleteAchievementService(c *fiber.Ctx, db *mgo.Database) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "id required"})
 	}
 
-	userID, _ := c.Locals(middleware.LocalsUserID).(string)
-	if userID == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthenticated"})
-	}
-
-	// ambil student
-	student, err := repo.GetStudentByUserID(context.Background(), userID)
-	if err != nil || student == nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "student not found"})
-	}
-
 	// ambil reference
 	ref, err := repo.GetAchievementReferenceByMongoID(context.Background(), mongoID)
 	if err != nil || ref == nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "reference not found"})
 	}
 
-	// ownership check
-	if ref.StudentID != student.ID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "not owner"})
+	// ownership check (policy: owner or admin)
+	if !authorizeAchievement(c, middleware.ActionEdit, ref.StudentID) {
+		return nil
 	}
 
-	// status harus draft
-	if ref.Status != "draft" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "only draft achievement can be deleted",
-		})
+	// draft -> deleted; the reference goes first so a concurrent submit wins cleanly
+	if !transitionReference(c, ref, mongoModel.StatusDeleted, nil) {
+		return nil
 	}
 
 	// soft delete mongo
@@ -190,17 +257,6 @@ func DeleteAchievementService(c *fiber.Ctx, db *mgo.Database) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	// update postgres reference
-	if err := repo.UpdateAchievementReferenceStatus(
-		context.Background(),
-		ref.ID,
-		"deleted",
-		nil,
-		nil,
-	); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
-	}
-
 	return c.JSON(fiber.Map{"message": "achievement deleted"})
 }
 
@@ -219,6 +275,9 @@ func HardDeleteAchievementService(c *fiber.Ctx, db *mgo.Database) error {
 	if id == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "id required"})
 	}
+	if !authorizeAchievementByMongoID(c, db, middleware.ActionEdit, id) {
+		return nil
+	}
 	if err := repo.HardDeleteAchievement(db, id); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -255,9 +314,30 @@ func ListAchievementsService(c *fiber.Ctx, db *mgo.Database) error {
 		limit = 10
 	}
 
+	// policy: admins see all, others only their own and their advisees'
+	subject, err := middleware.CurrentSubject(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	all, scope, err := subject.AchievementScope(context.Background())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	filter := bson.M{}
-	if studentID != "" {
+	switch {
+	case all && studentID != "":
 		filter["studentId"] = studentID
+	case all:
+	case studentID != "":
+		if !containsStudent(scope, studentID) {
+			scope = []string{}
+		} else {
+			scope = []string{studentID}
+		}
+		filter["studentId"] = bson.M{"$in": scope}
+	default:
+		filter["studentId"] = bson.M{"$in": scope}
 	}
 	if atype != "" {
 		filter["achievementType"] = atype
@@ -316,18 +396,30 @@ func SubmitAchievementService(c *fiber.Ctx, db *mgo.Database) error {
 	}
 
 	if ref == nil {
+		// the document must be the caller's own
+		a, err := repo.GetAchievementByID(db, mongoID)
+		if err != nil || a == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not found"})
+		}
+		if a.StudentID != student.ID {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "not owner"})
+		}
+
 		// create new reference
 		now := time.Now()
 		newRef := &mongoModel.AchievementReference{
 			StudentID:          student.ID, // ✅ INI YANG BENAR
 			MongoAchievementID: mongoID,
-			Status:             "submitted",
+			Status:             mongoModel.StatusSubmitted,
 			SubmittedAt:        &now,
 			CreatedAt:          now,
 			UpdatedAt:          now,
 		}
 
-		if err := repo.CreateAchievementReference(context.Background(), newRef); err != nil {
+		if err := repo.CreateAchievementReference(context.Background(), newRef, userID); err != nil {
+			if errors.Is(err, repo.ErrReferenceExists) {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "achievement already has a reference"})
+			}
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
 
@@ -339,19 +431,12 @@ func SubmitAchievementService(c *fiber.Ctx, db *mgo.Database) error {
 	}
 
 	// ownership check
-	if ref.StudentID != student.ID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "not owner"})
-	}
-
-	// update status
-	if err := repo.UpdateAchievementReferenceStatus(
-		context.Background(),
-		ref.ID,
-		"submitted",
-		nil,
-		nil,
-	); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	if !authorizeAchievement(c, middleware.ActionEdit, ref.StudentID) {
+		return nil
+	}
+	// draft/rejected/revision_requested -> submitted
+	if !transitionReference(c, ref, mongoModel.StatusSubmitted, nil) {
+		return nil
 	}
 
 	return c.JSON(fiber.Map{
@@ -362,7 +447,8 @@ func SubmitAchievementService(c *fiber.Ctx, db *mgo.Database) error {
 
 
 // VerifyAchievementService handles POST /achievements/:id/verify
-// Flow: lecturer verifies a submitted reference (by mongo id)
+// Flow: lecturer verifies a submitted reference (by mongo id); the latest
+// document version is pinned as the approved one
 func VerifyAchievementService(c *fiber.Ctx, db *mgo.Database) error {
 	mongoID := c.Params("id")
 	if mongoID == "" {
@@ -372,6 +458,11 @@ func VerifyAchievementService(c *fiber.Ctx, db *mgo.Database) error {
 	if verifierID == "" {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthenticated"})
 	}
+	// optional: the version the lecturer reviewed
+	var body struct {
+		Version int `json:"version"`
+	}
+	_ = c.BodyParser(&body)
 
 	ref, err := repo.GetAchievementReferenceByMongoID(context.Background(), mongoID)
 	if err != nil {
@@ -380,10 +471,14 @@ func VerifyAchievementService(c *fiber.Ctx, db *mgo.Database) error {
 	if ref == nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "reference not found"})
 	}
-	if err := repo.UpdateAchievementReferenceStatus(context.Background(), ref.ID, "verified", &verifierID, nil); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	if !authorizeAchievement(c, middleware.ActionVerify, ref.StudentID) {
+		return nil
+	}
+	version := verifyReference(c, db, ref, body.Version)
+	if version == 0 {
+		return nil
 	}
-	return c.JSON(fiber.Map{"message": "verified", "referenceId": ref.ID})
+	return c.JSON(fiber.Map{"message": "verified", "referenceId": ref.ID, "version": version})
 }
 
 // RejectAchievementService handles POST /achievements/:id/reject
@@ -429,23 +524,12 @@ func RejectAchievementService(c *fiber.Ctx, db *mgo.Database) error {
 		})
 	}
 
-	// ✅ VALIDASI STATUS SESUAI SRS
-	if ref.Status != "submitted" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "only submitted achievement can be rejected",
-		})
+	if !authorizeAchievement(c, middleware.ActionVerify, ref.StudentID) {
+		return nil
 	}
 
-	if err := repo.UpdateAchievementReferenceStatus(
-		ctx,
-		ref.ID,
-		"rejected",
-		&verifierID,
-		&body.RejectionNote,
-	); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+	if !transitionReference(c, ref, mongoModel.StatusRejected, &body.RejectionNote) {
+		return nil
 	}
 
 	return c.JSON(fiber.Map{
@@ -456,63 +540,52 @@ func RejectAchievementService(c *fiber.Ctx, db *mgo.Database) error {
 
 
 // GetAchievementHistoryService handles GET /achievements/:id/history
+// @Summary Achievement status history
+// @Tags Achievements
+// @Description Timeline of status changes (oldest first) with actor and note; earlier rejection notes are kept across resubmits. Empty when the achievement was never submitted.
+// @Produce json
+// @Param id path string true "Achievement ID"
+// @Success 200 {array} model.AchievementStatusEvent
+// @Failure 500 {object} map[string]string
+// @Security Bearer
+// @Router /achievements/{id}/history [get]
 func GetAchievementHistoryService(c *fiber.Ctx, db *mgo.Database) error {
 	mongoID := c.Params("id")
 	if mongoID == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "id required"})
 	}
+	if !authorizeAchievementByMongoID(c, db, middleware.ActionView, mongoID) {
+		return nil
+	}
 
-	q := `SELECT id, student_id, mongo_achievement_id, status, submitted_at, verified_at, verified_by, rejection_note, created_at, updated_at
-	      FROM achievement_references WHERE mongo_achievement_id=$1 ORDER BY created_at DESC LIMIT 20`
-	rows, err := database.PostgresDB.QueryContext(context.Background(), q, mongoID)
+	ref, err := repo.GetAchievementReferenceByMongoID(context.Background(), mongoID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
-	defer rows.Close()
-
-	var out []map[string]interface{}
-	for rows.Next() {
-		var id, studentID, mongoIDv sql.NullString
-		var status sql.NullString
-		var submitted, verified sql.NullTime
-		var verifiedBy, rejectionNote sql.NullString
-		var createdAt, updatedAt sql.NullTime
-		if err := rows.Scan(&id, &studentID, &mongoIDv, &status, &submitted, &verified, &verifiedBy, &rejectionNote, &createdAt, &updatedAt); err != nil {
-			continue
-		}
-		m := map[string]interface{}{
-			"id":             id.String,
-			"studentId":      studentID.String,
-			"mongoId":        mongoIDv.String,
-			"status":         status.String,
-			"submitted_at":   nil,
-			"verified_at":    nil,
-			"verified_by":    nil,
-			"rejection_note": nil,
-			"created_at":     nil,
-			"updated_at":     nil,
-		}
-		if submitted.Valid {
-			m["submitted_at"] = submitted.Time
-		}
-		if verified.Valid {
-			m["verified_at"] = verified.Time
-		}
-		if verifiedBy.Valid {
-			m["verified_by"] = verifiedBy.String
-		}
-		if rejectionNote.Valid {
-			m["rejection_note"] = rejectionNote.String
-		}
-		if createdAt.Valid {
-			m["created_at"] = createdAt.Time
-		}
-		if updatedAt.Valid {
-			m["updated_at"] = updatedAt.Time
-		}
-		out = append(out, m)
+	if ref == nil {
+		return c.JSON([]mongoModel.AchievementStatusEvent{})
 	}
-	return c.JSON(out)
+	events, err := repo.ListAchievementStatusEvents(context.Background(), ref.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(statusTimeline(ref, events))
+}
+
+// statusTimeline returns the reference's history events. References older
+// than the events table have no history rows; their current state is shown
+// instead so the timeline is never empty.
+func statusTimeline(ref *mongoModel.AchievementReference, events []mongoModel.AchievementStatusEvent) []mongoModel.AchievementStatusEvent {
+	if len(events) > 0 {
+		return events
+	}
+	return []mongoModel.AchievementStatusEvent{{
+		ReferenceID: ref.ID,
+		ToStatus:    ref.Status,
+		ActorID:     ref.VerifiedBy,
+		Note:        ref.RejectionNote,
+		CreatedAt:   ref.UpdatedAt,
+	}}
 }
 
 // -------------------- Reporting & Analytics --------------------
@@ -554,6 +627,10 @@ func StudentReportService(c *fiber.Ctx) error {
 	if studentID == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "student id required"})
 	}
+	// same scope as viewing the student's achievements (self, advisor, admin)
+	if !authorizeAchievement(c, middleware.ActionView, studentID) {
+		return nil
+	}
 	ctx := context.Background()
 
 	// Get student profile (Postgres)
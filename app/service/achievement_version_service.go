@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"clean-arch/app/model"
+	repo "clean-arch/app/repository"
+	"clean-arch/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	mgo "go.mongodb.org/mongo-driver/mongo"
+)
+
+// diffIgnored are bookkeeping fields left out of version diffs.
+var diffIgnored = map[string]bool{"id": true, "createdAt": true, "updatedAt": true}
+
+// achievementFields flattens an achievement to its JSON fields.
+func achievementFields(a model.Achievement) map[string]interface{} {
+	b, _ := json.Marshal(a)
+	m := map[string]interface{}{}
+	_ = json.Unmarshal(b, &m)
+	return m
+}
+
+// diffFields compares two JSON objects; nested objects (details) are
+// walked and reported as dotted paths, anything else compares whole.
+func diffFields(prefix string, from, to map[string]interface{}, out *[]model.FieldChange) {
+	keys := map[string]bool{}
+	for k := range from {
+		keys[k] = true
+	}
+	for k := range to {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	for _, k := range sorted {
+		if prefix == "" && diffIgnored[k] {
+			continue
+		}
+		a, b := from[k], to[k]
+		am, aObj := a.(map[string]interface{})
+		bm, bObj := b.(map[string]interface{})
+		switch {
+		case aObj && bObj:
+			diffFields(prefix+k+".", am, bm, out)
+		case !reflect.DeepEqual(a, b):
+			*out = append(*out, model.FieldChange{Field: prefix + k, From: a, To: b})
+		}
+	}
+}
+
+// diffAchievements lists the field changes from one version to another.
+func diffAchievements(from, to model.Achievement) []model.FieldChange {
+	out := []model.FieldChange{}
+	diffFields("", achievementFields(from), achievementFields(to), &out)
+	return out
+}
+
+// snapshotAchievement records the document's current state as a new
+// version. On failure it writes the response and returns nil.
+func snapshotAchievement(c *fiber.Ctx, db *mgo.Database, mongoID, reason string) *model.AchievementVersion {
+	userID, _ := c.Locals(middleware.LocalsUserID).(string)
+	v, err := repo.SnapshotAchievement(db, mongoID, userID, reason)
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to record version: " + err.Error()})
+		return nil
+	}
+	return v
+}
+
+// backfillVersion snapshots a document that predates versioning before its
+// first change, so the state it was verified in is kept (and pinned as the
+// verified version when the reference is verified). On failure it writes
+// the response and returns false.
+func backfillVersion(c *fiber.Ctx, db *mgo.Database, mongoID string) bool {
+	latest, err := repo.LatestAchievementVersion(db, mongoID)
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return false
+	}
+	if latest != nil {
+		return true
+	}
+	v := snapshotAchievement(c, db, mongoID, "backfill")
+	if v == nil {
+		return false
+	}
+	ref, err := repo.GetAchievementReferenceByMongoID(context.Background(), mongoID)
+	if err == nil && ref != nil && ref.Status == model.StatusVerified && ref.VerifiedVersion == nil {
+		err = repo.PinBackfilledVersion(context.Background(), ref.ID, v.Version)
+	}
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// verifyReference verifies ref and pins the achievement's latest version
+// (snapshotting documents that predate versioning). With expected > 0 the
+// verifier states which version they reviewed; a newer one gets 409. On
+// failure it writes the response and returns 0.
+func verifyReference(c *fiber.Ctx, db *mgo.Database, ref *model.AchievementReference, expected int) int {
+	if err := model.CheckStatusTransition(ref.Status, model.StatusVerified); err != nil {
+		writeTransitionError(c, ref, model.StatusVerified, err)
+		return 0
+	}
+	latest, err := repo.LatestAchievementVersion(db, ref.MongoAchievementID)
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return 0
+	}
+	if latest == nil {
+		if latest = snapshotAchievement(c, db, ref.MongoAchievementID, "backfill"); latest == nil {
+			return 0
+		}
+	}
+	if expected > 0 && expected != latest.Version {
+		c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":          "achievement changed since the reviewed version",
+			"version":        expected,
+			"latest_version": latest.Version,
+		})
+		return 0
+	}
+	verifierID, _ := c.Locals(middleware.LocalsUserID).(string)
+	if err := repo.VerifyAchievementReference(context.Background(), ref.ID, ref.Status, verifierID, latest.Version); err != nil {
+		writeTransitionError(c, ref, model.StatusVerified, err)
+		return 0
+	}
+	return latest.Version
+}
+
+// ListAchievementVersionsService handles GET /achievements/:id/versions
+// @Summary List achievement versions
+// @Tags Achievements
+// @Description Snapshots of the achievement document, oldest first, with the version pinned on verify.
+// @Produce json
+// @Param id path string true "Achievement ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Security Bearer
+// @Router /achievements/{id}/versions [get]
+func ListAchievementVersionsService(c *fiber.Ctx, db *mgo.Database) error {
+	mongoID := c.Params("id")
+	if !authorizeAchievementByMongoID(c, db, middleware.ActionView, mongoID) {
+		return nil
+	}
+	ref, err := repo.GetAchievementReferenceByMongoID(context.Background(), mongoID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	versions, err := repo.ListAchievementVersions(db, mongoID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var verified *int
+	if ref != nil {
+		verified = ref.VerifiedVersion
+	}
+	out := make([]fiber.Map, 0, len(versions))
+	for _, v := range versions {
+		out = append(out, fiber.Map{
+			"version":   v.Version,
+			"reason":    v.Reason,
+			"createdBy": v.CreatedBy,
+			"createdAt": v.CreatedAt,
+			"verified":  verified != nil && *verified == v.Version,
+		})
+	}
+	return c.JSON(fiber.Map{"verifiedVersion": verified, "versions": out})
+}
+
+// GetAchievementVersionService handles GET /achievements/:id/versions/:version
+// @Summary Get achievement version
+// @Tags Achievements
+// @Description One immutable snapshot of the achievement document.
+// @Produce json
+// @Param id path string true "Achievement ID"
+// @Param version path int true "Version"
+// @Success 200 {object} model.AchievementVersion
+// @Failure 404 {object} map[string]string
+// @Security Bearer
+// @Router /achievements/{id}/versions/{version} [get]
+func GetAchievementVersionService(c *fiber.Ctx, db *mgo.Database) error {
+	mongoID := c.Params("id")
+	version, err := strconv.Atoi(c.Params("version"))
+	if err != nil || version < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid version"})
+	}
+	if !authorizeAchievementByMongoID(c, db, middleware.ActionView, mongoID) {
+		return nil
+	}
+	v, err := repo.GetAchievementVersion(db, mongoID, version)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if v == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "version not found"})
+	}
+	return c.JSON(v)
+}
+
+// DiffAchievementVersionsService handles GET /achievements/:id/versions/diff
+// @Summary Diff two achievement versions
+// @Tags Achievements
+// @Description Field changes between two versions. to defaults to the latest; from to the verified version (or the one before to).
+// @Produce json
+// @Param id path string true "Achievement ID"
+// @Param from query int false "From version"
+// @Param to query int false "To version"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security Bearer
+// @Router /achievements/{id}/versions/diff [get]
+func DiffAchievementVersionsService(c *fiber.Ctx, db *mgo.Database) error {
+	mongoID := c.Params("id")
+	from, to := c.QueryInt("from"), c.QueryInt("to")
+	if from < 0 || to < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid version"})
+	}
+	if !authorizeAchievementByMongoID(c, db, middleware.ActionView, mongoID) {
+		return nil
+	}
+
+	if to == 0 {
+		latest, err := repo.LatestAchievementVersion(db, mongoID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if latest == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "no versions recorded"})
+		}
+		to = latest.Version
+	}
+	if from == 0 {
+		ref, err := repo.GetAchievementReferenceByMongoID(context.Background(), mongoID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if ref != nil && ref.VerifiedVersion != nil && *ref.VerifiedVersion != to {
+			from = *ref.VerifiedVersion
+		} else {
+			from = to - 1
+		}
+	}
+	if from < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "nothing to compare with"})
+	}
+
+	a, err := repo.GetAchievementVersion(db, mongoID, from)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	b, err := repo.GetAchievementVersion(db, mongoID, to)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if a == nil || b == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "version not found"})
+	}
+	return c.JSON(fiber.Map{
+		"from":    from,
+		"to":      to,
+		"changes": diffAchievements(a.Snapshot, b.Snapshot),
+	})
+}
@@ -0,0 +1,456 @@
+package service
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"clean-arch/app/model"
+	"clean-arch/middleware"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// Workflow tests run the achievement handlers against a mocked Postgres (and,
+// where documents are touched, a mocked Mongo). The caller is an admin so the
+// policy needs no student lookup; the policy has its own tests.
+
+var workflowAdmin = &middleware.Subject{UserID: "u-lect", Admin: true}
+
+// workflowApp mounts one handler behind the admin subject.
+func workflowApp(method, route string, h fiber.Handler) *fiber.App {
+	app := fiber.New()
+	app.Add(method, route, asSubject(workflowAdmin), h)
+	return app
+}
+
+// send performs a request and decodes the JSON response body into a map.
+func send(t *testing.T, app *fiber.App, method, path, body string) (int, map[string]interface{}) {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, r)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp.StatusCode, decodeBody(t, resp)
+}
+
+func decodeBody(t *testing.T, resp *http.Response) map[string]interface{} {
+	out := map[string]interface{}{}
+	raw, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	if len(raw) > 0 {
+		require.NoError(t, json.Unmarshal(raw, &out), string(raw))
+	}
+	return out
+}
+
+func workflowRef(status string) model.AchievementReference {
+	now := time.Now()
+	return model.AchievementReference{ID: "ref-1", StudentID: "s-1", MongoAchievementID: "m-1", Status: status, CreatedAt: now, UpdatedAt: now}
+}
+
+func reviewCommentRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "reference_id", "field", "attachment_id", "comment", "author_id",
+		"created_at", "resolved_at", "resolved_by", "resolution"})
+}
+
+// expectTransition expects one conditional status update plus its event.
+// affected 0 means another request changed the status first.
+func expectTransition(mock sqlmock.Sqlmock, from, to string, affected int64) {
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE achievement_references SET status=\$1`).
+		WithArgs(append([]driver.Value{to}, transitionArgs(from, to)...)...).
+		WillReturnResult(sqlmock.NewResult(0, affected))
+	if affected == 0 {
+		mock.ExpectRollback()
+		return
+	}
+	mock.ExpectExec(`INSERT INTO achievement_status_events`).
+		WithArgs(sqlmock.AnyArg(), "ref-1", from, to, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+// transitionArgs are the arguments after the new status of updateReferenceStatus.
+func transitionArgs(from, to string) []driver.Value {
+	anyArg := sqlmock.AnyArg()
+	switch to {
+	case model.StatusSubmitted:
+		return []driver.Value{anyArg, anyArg, "ref-1", from}
+	case model.StatusVerified, model.StatusRejected:
+		return []driver.Value{anyArg, anyArg, anyArg, "ref-1", from}
+	default:
+		return []driver.Value{anyArg, "ref-1", from}
+	}
+}
+
+func TestRevisionWorkflow_RequestResolveResubmit(t *testing.T) {
+	mock := mockPostgres(t)
+	now := time.Now()
+
+	// 1. the lecturer sends the submitted achievement back with a keyed comment
+	mock.ExpectQuery(`WHERE mongo_achievement_id`).WithArgs("m-1").WillReturnRows(referenceRows(workflowRef(model.StatusSubmitted)))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE achievement_references SET status=\$1`).
+		WithArgs(model.StatusRevisionRequested, sqlmock.AnyArg(), "ref-1", model.StatusSubmitted).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO achievement_status_events`).
+		WithArgs(sqlmock.AnyArg(), "ref-1", model.StatusSubmitted, model.StatusRevisionRequested, "u-lect", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO achievement_review_comments`).
+		WithArgs(sqlmock.AnyArg(), "ref-1", "title", "", "gunakan nama resmi lomba", "u-lect", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	app := workflowApp("POST", "/achievements/:id/request-revision", func(c *fiber.Ctx) error {
+		return RequestRevisionService(c, nil)
+	})
+	code, body := send(t, app, "POST", "/achievements/m-1/request-revision",
+		`{"note":"hampir lengkap","comments":[{"field":"title","comment":"gunakan nama resmi lomba"}]}`)
+	require.Equal(t, fiber.StatusOK, code, body)
+	comments := body["comments"].([]interface{})
+	require.Len(t, comments, 1)
+	commentID := comments[0].(map[string]interface{})["id"].(string)
+	require.NotEmpty(t, commentID)
+
+	// 2. resubmitting with the comment still open is refused
+	mock.ExpectQuery(`WHERE id=\$1`).WithArgs("ref-1").WillReturnRows(referenceRows(workflowRef(model.StatusRevisionRequested)))
+	mock.ExpectQuery(`FROM achievement_review_comments WHERE reference_id=\$1 AND resolved_at IS NULL`).WithArgs("ref-1").
+		WillReturnRows(reviewCommentRows().AddRow(commentID, "ref-1", "title", nil, "gunakan nama resmi lomba", "u-lect", now, nil, nil, nil))
+
+	submit := workflowApp("POST", "/refs/:id/submit", SubmitAchievementReferenceService)
+	code, body = send(t, submit, "POST", "/refs/ref-1/submit", "")
+	assert.Equal(t, fiber.StatusConflict, code)
+	assert.Len(t, body["open_comments"], 1)
+
+	// 3. the student resolves it
+	mock.ExpectQuery(`WHERE mongo_achievement_id`).WithArgs("m-1").WillReturnRows(referenceRows(workflowRef(model.StatusRevisionRequested)))
+	mock.ExpectQuery(`FROM achievement_review_comments WHERE id=\$1`).WithArgs(commentID).
+		WillReturnRows(reviewCommentRows().AddRow(commentID, "ref-1", "title", nil, "gunakan nama resmi lomba", "u-lect", now, nil, nil, nil))
+	mock.ExpectExec(`UPDATE achievement_review_comments SET resolved_at`).
+		WithArgs(sqlmock.AnyArg(), "u-lect", "judul diganti", commentID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`FROM achievement_review_comments WHERE reference_id=\$1 AND resolved_at IS NULL`).WithArgs("ref-1").
+		WillReturnRows(reviewCommentRows())
+
+	resolve := workflowApp("POST", "/achievements/:id/review-comments/:commentId/resolve", func(c *fiber.Ctx) error {
+		return ResolveReviewCommentService(c, nil)
+	})
+	code, body = send(t, resolve, "POST", "/achievements/m-1/review-comments/"+commentID+"/resolve", `{"note":"judul diganti"}`)
+	require.Equal(t, fiber.StatusOK, code, body)
+	assert.EqualValues(t, 0, body["open"])
+
+	// 4. now the resubmit goes through, conditioned on the status it read
+	mock.ExpectQuery(`WHERE id=\$1`).WithArgs("ref-1").WillReturnRows(referenceRows(workflowRef(model.StatusRevisionRequested)))
+	mock.ExpectQuery(`FROM achievement_review_comments WHERE reference_id=\$1 AND resolved_at IS NULL`).WithArgs("ref-1").
+		WillReturnRows(reviewCommentRows())
+	expectTransition(mock, model.StatusRevisionRequested, model.StatusSubmitted, 1)
+
+	code, body = send(t, submit, "POST", "/refs/ref-1/submit", "")
+	assert.Equal(t, fiber.StatusOK, code, body)
+	assert.Equal(t, model.StatusSubmitted, body["status"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevisionWorkflow_ConcurrentChangeIsConflict(t *testing.T) {
+	mock := mockPostgres(t)
+
+	// the reference was verified by someone else between the read and the update
+	mock.ExpectQuery(`WHERE mongo_achievement_id`).WithArgs("m-1").WillReturnRows(referenceRows(workflowRef(model.StatusSubmitted)))
+	expectTransition(mock, model.StatusSubmitted, model.StatusRevisionRequested, 0)
+
+	app := workflowApp("POST", "/achievements/:id/request-revision", func(c *fiber.Ctx) error {
+		return RequestRevisionService(c, nil)
+	})
+	code, _ := send(t, app, "POST", "/achievements/m-1/request-revision", `{"comments":[{"field":"title","comment":"x"}]}`)
+	assert.Equal(t, fiber.StatusConflict, code)
+	// nothing else was written: no comments without the status change
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevisionWorkflow_ResolveTwiceIsConflict(t *testing.T) {
+	mock := mockPostgres(t)
+	now := time.Now()
+
+	mock.ExpectQuery(`WHERE mongo_achievement_id`).WithArgs("m-1").WillReturnRows(referenceRows(workflowRef(model.StatusRevisionRequested)))
+	mock.ExpectQuery(`FROM achievement_review_comments WHERE id=\$1`).WithArgs("c-1").
+		WillReturnRows(reviewCommentRows().AddRow("c-1", "ref-1", "title", nil, "x", "u-lect", now, now, "u-1", nil))
+	mock.ExpectExec(`UPDATE achievement_review_comments SET resolved_at`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	app := workflowApp("POST", "/achievements/:id/review-comments/:commentId/resolve", func(c *fiber.Ctx) error {
+		return ResolveReviewCommentService(c, nil)
+	})
+	code, _ := send(t, app, "POST", "/achievements/m-1/review-comments/c-1/resolve", "")
+	assert.Equal(t, fiber.StatusConflict, code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStatusWorkflow_VerifyDraftIsConflict(t *testing.T) {
+	mock := mockPostgres(t)
+	mock.ExpectQuery(`WHERE id=\$1`).WithArgs("ref-1").WillReturnRows(referenceRows(workflowRef(model.StatusDraft)))
+
+	// refused before any document or status is touched (db is nil)
+	app := workflowApp("POST", "/refs/:id/verify", func(c *fiber.Ctx) error {
+		return VerifyAchievementReferenceService(c, nil)
+	})
+	code, body := send(t, app, "POST", "/refs/ref-1/verify", "")
+	assert.Equal(t, fiber.StatusConflict, code)
+	assert.Equal(t, model.StatusDraft, body["status"])
+	assert.ElementsMatch(t, []interface{}{model.StatusSubmitted, model.StatusDeleted}, body["allowed"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStatusWorkflow_VerifyPinsLatestVersion(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("verify", func(mt *mtest.T) {
+		mock := mockPostgres(mt.T)
+		mock.ExpectQuery(`WHERE id=\$1`).WithArgs("ref-1").WillReturnRows(referenceRows(workflowRef(model.StatusSubmitted)))
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.achievement_versions", mtest.FirstBatch,
+			bson.D{{Key: "achievementId", Value: "m-1"}, {Key: "version", Value: 3}}))
+		// status change and version pin commit together
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE achievement_references SET status=\$1`).
+			WithArgs(model.StatusVerified, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "ref-1", model.StatusSubmitted).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO achievement_status_events`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`SET verified_version=\$1 WHERE id=\$2`).WithArgs(3, "ref-1").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		app := workflowApp("POST", "/refs/:id/verify", func(c *fiber.Ctx) error {
+			return VerifyAchievementReferenceService(c, mt.DB)
+		})
+		code, body := send(mt.T, app, "POST", "/refs/ref-1/verify", "")
+		assert.Equal(mt, fiber.StatusOK, code, body)
+		assert.EqualValues(mt, 3, body["version"])
+		assert.NoError(mt, mock.ExpectationsWereMet())
+	})
+}
+
+func TestStatusWorkflow_ConcurrentRejectIsConflict(t *testing.T) {
+	mock := mockPostgres(t)
+	app := workflowApp("POST", "/refs/:id/reject", RejectAchievementReferenceService)
+
+	// two lecturers read the submitted reference; the first reject wins
+	mock.ExpectQuery(`WHERE id=\$1`).WithArgs("ref-1").WillReturnRows(referenceRows(workflowRef(model.StatusSubmitted)))
+	expectTransition(mock, model.StatusSubmitted, model.StatusRejected, 1)
+	code, _ := send(t, app, "POST", "/refs/ref-1/reject", `{"note":"sertifikat tidak valid"}`)
+	assert.Equal(t, fiber.StatusOK, code)
+
+	mock.ExpectQuery(`WHERE id=\$1`).WithArgs("ref-1").WillReturnRows(referenceRows(workflowRef(model.StatusSubmitted)))
+	expectTransition(mock, model.StatusSubmitted, model.StatusRejected, 0)
+	code, body := send(t, app, "POST", "/refs/ref-1/reject", `{"note":"duplikat"}`)
+	assert.Equal(t, fiber.StatusConflict, code)
+	assert.Contains(t, body["error"], "status changed")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStatusWorkflow_RejectRejectedIsConflict(t *testing.T) {
+	mock := mockPostgres(t)
+	mock.ExpectQuery(`WHERE id=\$1`).WithArgs("ref-1").WillReturnRows(referenceRows(workflowRef(model.StatusRejected)))
+	// the transition table refuses it before any update is sent
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	app := workflowApp("POST", "/refs/:id/reject", RejectAchievementReferenceService)
+	code, body := send(t, app, "POST", "/refs/ref-1/reject", `{"note":"lagi"}`)
+	assert.Equal(t, fiber.StatusConflict, code)
+	assert.ElementsMatch(t, []interface{}{model.StatusDraft, model.StatusSubmitted}, body["allowed"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Mongo mock replies, consumed in the order the commands are sent.
+func achievementDoc(oid primitive.ObjectID) bson.D {
+	return bson.D{{Key: "_id", Value: oid}, {Key: "studentId", Value: "s-1"}, {Key: "title", Value: "Juara 2"}}
+}
+
+func findReply(coll string, docs ...bson.D) bson.D {
+	return mtest.CreateCursorResponse(0, "test."+coll, mtest.FirstBatch, docs...)
+}
+
+func versionDoc(mongoID string, version int) bson.D {
+	return bson.D{{Key: "achievementId", Value: mongoID}, {Key: "version", Value: version}}
+}
+
+// writeLog lists the Mongo writes sent, in order: "update" or
+// "insert <reason> v<version>" for stored achievement versions.
+func writeLog(mt *mtest.T) []string {
+	var out []string
+	for _, e := range mt.GetAllStartedEvents() {
+		switch e.CommandName {
+		case "update":
+			out = append(out, "update")
+		case "insert":
+			vals, _ := e.Command.Lookup("documents").Array().Values()
+			for _, v := range vals {
+				d := v.Document()
+				out = append(out, fmt.Sprintf("insert %s v%d", d.Lookup("reason").StringValue(), d.Lookup("version").AsInt64()))
+			}
+		}
+	}
+	return out
+}
+
+func TestVersionWorkflow_FirstStudentEditKeepsOriginal(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("update", func(mt *mtest.T) {
+		oid := primitive.NewObjectID()
+		id := oid.Hex()
+		ref := workflowRef(model.StatusRejected)
+		ref.MongoAchievementID = id
+
+		mock := mockPostgres(mt.T)
+		// studentCanEdit
+		mock.ExpectQuery(`WHERE mongo_achievement_id`).WithArgs(id).WillReturnRows(referenceRows(ref))
+		// backfill: no versions yet, so the current document becomes v1
+		mt.AddMockResponses(
+			findReply("achievement_versions"),
+			findReply("achievements", achievementDoc(oid)),
+			findReply("achievement_versions"),
+			mtest.CreateSuccessResponse(),
+		)
+		// not verified: nothing to pin
+		mock.ExpectQuery(`WHERE mongo_achievement_id`).WithArgs(id).WillReturnRows(referenceRows(ref))
+		// the edit under the workflow lock
+		mock.ExpectBegin()
+		mock.ExpectExec(`pg_advisory_xact_lock_shared`).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`FOR SHARE`).WithArgs(id).WillReturnRows(
+			sqlmock.NewRows([]string{"id", "student_id", "status", "updated_at"}).AddRow("ref-1", "s-1", model.StatusRejected, time.Now()))
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+		mock.ExpectCommit()
+		// and the edited document becomes v2
+		mt.AddMockResponses(
+			findReply("achievements", achievementDoc(oid)),
+			findReply("achievement_versions", versionDoc(id, 1)),
+			mtest.CreateSuccessResponse(),
+		)
+
+		app := fiber.New()
+		app.Put("/achievements/:id", asSubject(&middleware.Subject{UserID: "u-1", StudentID: "s-1"}), func(c *fiber.Ctx) error {
+			return UpdateAchievementService(c, mt.DB)
+		})
+		code, body := send(mt.T, app, "PUT", "/achievements/"+id, `{"title":"Juara 1"}`)
+		assert.Equal(mt, fiber.StatusOK, code, body)
+		assert.EqualValues(mt, 2, body["version"])
+		assert.Equal(mt, []string{"insert backfill v1", "update", "insert update v2"}, writeLog(mt))
+		assert.NoError(mt, mock.ExpectationsWereMet())
+	})
+}
+
+func TestVersionWorkflow_OverridePinsBackfillOnVerified(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("override", func(mt *mtest.T) {
+		oid := primitive.NewObjectID()
+		id := oid.Hex()
+		ref := workflowRef(model.StatusVerified)
+		ref.MongoAchievementID = id
+
+		mock := mockPostgres(mt.T)
+		mt.AddMockResponses(
+			findReply("achievements", achievementDoc(oid)),
+			// backfill
+			findReply("achievement_versions"),
+			findReply("achievements", achievementDoc(oid)),
+			findReply("achievement_versions"),
+			mtest.CreateSuccessResponse(),
+		)
+		// verified before versioning existed: v1 is what was approved
+		mock.ExpectQuery(`WHERE mongo_achievement_id`).WithArgs(id).WillReturnRows(referenceRows(ref))
+		mock.ExpectExec(`SET verified_version=\$1 WHERE id=\$2 AND status=\$3 AND verified_version IS NULL`).
+			WithArgs(1, "ref-1", model.StatusVerified).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO achievement_override_audit`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			findReply("achievements", achievementDoc(oid)),
+			findReply("achievement_versions", versionDoc(id, 1)),
+			mtest.CreateSuccessResponse(),
+		)
+		mock.ExpectExec(`UPDATE achievement_override_audit SET version`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		app := workflowApp("PUT", "/achievements/:id/override", func(c *fiber.Ctx) error {
+			return OverrideAchievementService(c, mt.DB)
+		})
+		code, body := send(mt.T, app, "PUT", "/achievements/"+id+"/override", `{"reason":"typo in title","fields":{"title":"Juara 1"}}`)
+		assert.Equal(mt, fiber.StatusOK, code, body)
+		assert.EqualValues(mt, 2, body["version"])
+		assert.Equal(mt, []string{"insert backfill v1", "update", "insert admin_override v2"}, writeLog(mt))
+		assert.NoError(mt, mock.ExpectationsWereMet())
+	})
+}
+
+func TestEditWorkflow_SubmitDuringEditIsConflict(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("edit", func(mt *mtest.T) {
+		oid := primitive.NewObjectID()
+		id := oid.Hex()
+		ref := workflowRef(model.StatusDraft)
+		ref.MongoAchievementID = id
+
+		mock := mockPostgres(mt.T)
+		// studentCanEdit still sees a draft
+		mock.ExpectQuery(`WHERE mongo_achievement_id`).WithArgs(id).WillReturnRows(referenceRows(ref))
+		mt.AddMockResponses(findReply("achievement_versions", versionDoc(id, 1)))
+		// but a submit committed before the lock was taken
+		mock.ExpectBegin()
+		mock.ExpectExec(`pg_advisory_xact_lock_shared\(hashtext\(\$1\)\)`).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`FOR SHARE`).WithArgs(id).WillReturnRows(
+			sqlmock.NewRows([]string{"id", "student_id", "status", "updated_at"}).AddRow("ref-1", "s-1", model.StatusSubmitted, time.Now()))
+		mock.ExpectRollback()
+
+		app := fiber.New()
+		app.Put("/achievements/:id", asSubject(&middleware.Subject{UserID: "u-1", StudentID: "s-1"}), func(c *fiber.Ctx) error {
+			return UpdateAchievementService(c, mt.DB)
+		})
+		code, body := send(mt.T, app, "PUT", "/achievements/"+id, `{"title":"Juara 1"}`)
+		assert.Equal(mt, fiber.StatusConflict, code)
+		assert.Contains(mt, body["error"], "status changed")
+		// the submitted document was not touched
+		assert.Empty(mt, writeLog(mt))
+		assert.NoError(mt, mock.ExpectationsWereMet())
+	})
+}
+
+func TestEditWorkflow_FirstSubmitTakesExclusiveLock(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("submit", func(mt *mtest.T) {
+		oid := primitive.NewObjectID()
+		id := oid.Hex()
+
+		mock := mockPostgres(mt.T)
+		mock.ExpectQuery(`FROM students WHERE user_id`).WithArgs("u-1").WillReturnRows(
+			sqlmock.NewRows([]string{"id", "user_id", "student_id", "program_study", "academic_year", "advisor_id", "created_at"}).
+				AddRow("s-1", "u-1", "2101001", "Informatika", "2021", nil, time.Now()))
+		mock.ExpectQuery(`WHERE mongo_achievement_id`).WithArgs(id).WillReturnRows(referenceRows())
+		mt.AddMockResponses(findReply("achievements", achievementDoc(oid)))
+		// the reference appears only once no student edit holds the shared lock
+		mock.ExpectBegin()
+		mock.ExpectExec(`SELECT pg_advisory_xact_lock\(hashtext\(\$1\)\)`).WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`INSERT INTO achievement_references`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO achievement_status_events`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), nil, model.StatusSubmitted, "u-1", nil, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		app := fiber.New()
+		app.Post("/achievements/:id/submit", asSubject(&middleware.Subject{UserID: "u-1", StudentID: "s-1"}), func(c *fiber.Ctx) error {
+			return SubmitAchievementService(c, mt.DB)
+		})
+		code, body := send(mt.T, app, "POST", "/achievements/"+id+"/submit", "")
+		assert.Equal(mt, fiber.StatusOK, code, body)
+		assert.NoError(mt, mock.ExpectationsWereMet())
+	})
+}
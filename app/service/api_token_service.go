@@ -0,0 +1,345 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"clean-arch/app/model"
+	"clean-arch/app/repository"
+	"clean-arch/config"
+	"clean-arch/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// apiTokenRequest is the body of every "create token" endpoint.
+type apiTokenRequest struct {
+	Name          string   `json:"name"`
+	Permissions   []string `json:"permissions"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// errInvalidAPIToken wraps validation failures answered with 400.
+var errInvalidAPIToken = errors.New("invalid api token request")
+
+// issueAPIToken validates the request against the owner's role and stores
+// a new token. The plaintext token is returned once and never stored.
+func issueAPIToken(ctx context.Context, owner *model.User, req apiTokenRequest, createdBy string) (string, *model.APIToken, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return "", nil, fmt.Errorf("%w: name required (max 100 characters)", errInvalidAPIToken)
+	}
+	if len(req.Permissions) == 0 {
+		return "", nil, fmt.Errorf("%w: permissions required", errInvalidAPIToken)
+	}
+
+	// a token can never do more than its owner
+	granted, _, err := repository.LoadRolePermissions(ctx, owner.RoleID)
+	if err != nil {
+		return "", nil, err
+	}
+	perms := make([]string, 0, len(req.Permissions))
+	seen := map[string]bool{}
+	for _, p := range req.Permissions {
+		p = strings.TrimSpace(p)
+		if p == "" || seen[p] {
+			continue
+		}
+		if !middleware.HasPermission(granted, p) {
+			return "", nil, fmt.Errorf("%w: permission %q is not granted to the owner", errInvalidAPIToken, p)
+		}
+		seen[p] = true
+		perms = append(perms, p)
+	}
+
+	env := config.LoadEnv()
+	days := req.ExpiresInDays
+	if days == 0 {
+		days = env.APITokenDefaultDays
+	}
+	if days < 0 || days > env.APITokenMaxDays {
+		return "", nil, fmt.Errorf("%w: expires_in_days must be between 1 and %d", errInvalidAPIToken, env.APITokenMaxDays)
+	}
+
+	secret, err := newOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+	raw := middleware.APITokenPrefix + secret
+	t := &model.APIToken{
+		UserID:      owner.ID,
+		Name:        name,
+		Prefix:      raw[:len(middleware.APITokenPrefix)+4],
+		TokenHash:   hashToken(raw),
+		Permissions: perms,
+		ExpiresAt:   time.Now().Add(time.Duration(days) * 24 * time.Hour),
+		CreatedBy:   createdBy,
+	}
+	if err := repository.CreateAPIToken(ctx, t); err != nil {
+		return "", nil, err
+	}
+	return raw, t, nil
+}
+
+// createAPITokenResponse answers a create request for owner.
+func createAPITokenResponse(c *fiber.Ctx, owner *model.User) error {
+	var req apiTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	createdBy, _ := c.Locals(middleware.LocalsUserID).(string)
+	raw, t, err := issueAPIToken(context.Background(), owner, req, createdBy)
+	if errors.Is(err, errInvalidAPIToken) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"token":     raw,
+		"api_token": t,
+	})
+}
+
+// rejectAPITokenCaller stops token management through an API token, so a
+// leaked token cannot mint more.
+func rejectAPITokenCaller(c *fiber.Ctx) bool {
+	_, ok := c.Locals(middleware.LocalsAPITokenID).(string)
+	return ok
+}
+
+// CreateMyAPITokenService
+// @Summary Create personal access token
+// @Tags API Tokens
+// @Description Create a named, expiring token limited to a subset of the caller's permissions. The token is shown once.
+// @Accept json
+// @Produce json
+// @Param body body object true "Token" example({"name":"reporting script","permissions":["reports.read"],"expires_in_days":90})
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security Bearer
+// @Router /auth/tokens [post]
+func CreateMyAPITokenService(c *fiber.Ctx) error {
+	if rejectAPITokenCaller(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "api tokens cannot manage api tokens"})
+	}
+	u, err := currentUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if u == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthenticated"})
+	}
+	return createAPITokenResponse(c, u)
+}
+
+// ListMyAPITokensService
+// @Summary List personal access tokens
+// @Tags API Tokens
+// @Produce json
+// @Success 200 {array} model.APIToken
+// @Failure 401 {object} map[string]string
+// @Security Bearer
+// @Router /auth/tokens [get]
+func ListMyAPITokensService(c *fiber.Ctx) error {
+	uid, _ := c.Locals(middleware.LocalsUserID).(string)
+	if uid == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthenticated"})
+	}
+	tokens, err := repository.ListAPITokensByUser(context.Background(), uid)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(tokens)
+}
+
+// RevokeMyAPITokenService
+// @Summary Revoke personal access token
+// @Tags API Tokens
+// @Param id path string true "Token ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security Bearer
+// @Router /auth/tokens/{id} [delete]
+func RevokeMyAPITokenService(c *fiber.Ctx) error {
+	uid, _ := c.Locals(middleware.LocalsUserID).(string)
+	if uid == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthenticated"})
+	}
+	return revokeAPITokenResponse(c, uid, c.Params("id"))
+}
+
+func revokeAPITokenResponse(c *fiber.Ctx, userID, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "token not found"})
+	}
+	ok, err := repository.RevokeAPIToken(context.Background(), userID, id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "token not found"})
+	}
+	return c.JSON(fiber.Map{"message": "token revoked"})
+}
+
+// CreateServiceAccountService
+// @Summary Create service account
+// @Tags Service Accounts
+// @Description Create a non-human user that cannot log in and authenticates only with API tokens (admin).
+// @Accept json
+// @Produce json
+// @Param body body object true "Service account" example({"username":"svc-portal","fullName":"Campus portal","roleId":"..."})
+// @Success 201 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security Bearer
+// @Router /service-accounts [post]
+func CreateServiceAccountService(c *fiber.Ctx) error {
+	if rejectAPITokenCaller(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "api tokens cannot manage service accounts"})
+	}
+	var body struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+		FullName string `json:"fullName"`
+		RoleID   string `json:"roleId"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if body.Username == "" || body.RoleID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "username and roleId required"})
+	}
+	ctx := context.Background()
+	role, err := repository.GetRoleByID(ctx, body.RoleID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if role == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "role not found"})
+	}
+	if body.Email == "" {
+		// email is unique and required on users; service accounts get a non-routable one
+		body.Email = body.Username + "@service-account.invalid"
+	}
+
+	// random password nobody knows: password login is impossible
+	secret, err := newOpaqueToken()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to hash password"})
+	}
+
+	u := &model.User{
+		Username:         body.Username,
+		Email:            body.Email,
+		PasswordHash:     string(hashed),
+		FullName:         body.FullName,
+		RoleID:           body.RoleID,
+		IsActive:         true,
+		IsServiceAccount: true,
+	}
+	if err := repository.CreateUser(ctx, u); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"userId": u.ID})
+}
+
+// ListServiceAccountsService
+// @Summary List service accounts
+// @Tags Service Accounts
+// @Produce json
+// @Success 200 {array} model.User
+// @Security Bearer
+// @Router /service-accounts [get]
+func ListServiceAccountsService(c *fiber.Ctx) error {
+	users, err := repository.ListServiceAccounts(context.Background())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(users)
+}
+
+// serviceAccount loads the :id service account or answers 404.
+func serviceAccount(c *fiber.Ctx) (*model.User, error) {
+	u, err := repository.GetUserByID(context.Background(), c.Params("id"))
+	if err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if u == nil || !u.IsServiceAccount {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "service account not found"})
+	}
+	return u, nil
+}
+
+// CreateServiceAccountTokenService
+// @Summary Create service account token
+// @Tags Service Accounts
+// @Description Issue an API token for a service account (admin). The token is shown once.
+// @Accept json
+// @Produce json
+// @Param id path string true "Service account user ID"
+// @Param body body object true "Token" example({"name":"portal prod","permissions":["achievements.list"],"expires_in_days":365})
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security Bearer
+// @Router /service-accounts/{id}/tokens [post]
+func CreateServiceAccountTokenService(c *fiber.Ctx) error {
+	if rejectAPITokenCaller(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "api tokens cannot manage api tokens"})
+	}
+	u, err := serviceAccount(c)
+	if u == nil {
+		return err
+	}
+	return createAPITokenResponse(c, u)
+}
+
+// ListServiceAccountTokensService
+// @Summary List service account tokens
+// @Tags Service Accounts
+// @Param id path string true "Service account user ID"
+// @Success 200 {array} model.APIToken
+// @Failure 404 {object} map[string]string
+// @Security Bearer
+// @Router /service-accounts/{id}/tokens [get]
+func ListServiceAccountTokensService(c *fiber.Ctx) error {
+	u, err := serviceAccount(c)
+	if u == nil {
+		return err
+	}
+	tokens, err := repository.ListAPITokensByUser(context.Background(), u.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(tokens)
+}
+
+// RevokeServiceAccountTokenService
+// @Summary Revoke service account token
+// @Tags Service Accounts
+// @Param id path string true "Service account user ID"
+// @Param tid path string true "Token ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security Bearer
+// @Router /service-accounts/{id}/tokens/{tid} [delete]
+func RevokeServiceAccountTokenService(c *fiber.Ctx) error {
+	u, err := serviceAccount(c)
+	if u == nil {
+		return err
+	}
+	return revokeAPITokenResponse(c, u.ID, c.Params("tid"))
+}
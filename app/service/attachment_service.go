@@ -3,6 +3,7 @@
 import (
 	"clean-arch/app/model"
 	"clean-arch/app/repository"
+	"clean-arch/middleware"
 
 	"github.com/gofiber/fiber/v2"
 	mgo "go.mongodb.org/mongo-driver/mongo"
@@ -18,6 +19,8 @@ import (
 // @Param body body object true "Attachment body" example({"fileName":"dok.pdf","fileUrl":"https://...","fileType":"pdf"})
 // @Success 201 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Security Bearer
 // @Router /achievements/{id}/attachments [post]
@@ -26,6 +29,10 @@ func AddAttachmentService(c *fiber.Ctx, db *mgo.Database) error {
 	if achID == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "achievement id required"})
 	}
+	// same gate as editing the document: owner only, editable statuses only
+	if !studentCanEdit(c, db, achID) {
+		return nil
+	}
 
 	var body struct {
 		FileName string `json:"fileName"`
@@ -43,9 +50,12 @@ func AddAttachmentService(c *fiber.Ctx, db *mgo.Database) error {
 		FileType:      body.FileType,
 	}
 
-	res, err := repository.AddAttachment(db, attach)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	var res *model.Attachment
+	if !studentEdit(c, achID, func() (err error) {
+		res, err = repository.AddAttachment(db, attach)
+		return err
+	}) {
+		return nil
 	}
 	return c.Status(fiber.StatusCreated).JSON(res)
 }
@@ -66,6 +76,9 @@ func ListAttachmentsService(c *fiber.Ctx, db *mgo.Database) error {
 	if achID == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "achievement id required"})
 	}
+	if !authorizeAchievementByMongoID(c, db, middleware.ActionView, achID) {
+		return nil
+	}
 	out, err := repository.ListAttachmentsByAchievement(db, achID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
@@ -2,19 +2,28 @@
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"log"
-	"os"
 	"strconv"
 	"time"
 
+	"clean-arch/app/model"
 	"clean-arch/app/repository"
+	"clean-arch/config"
 	"clean-arch/middleware"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// dummyPasswordHash is compared against when the account does not exist.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
 // AuthenticateService implements FR-001 (login)
 // @Summary Authenticate user (login)
 // @Tags Auth
@@ -25,6 +34,7 @@ import (
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string
 // @Failure 401 {object} map[string]string
+// @Failure 429 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /auth/login [post]
 func AuthenticateService(c *fiber.Ctx) error {
@@ -45,61 +55,81 @@ func AuthenticateService(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "username and password required"})
 	}
 
-	u, err := repository.GetUserByUsernameOrEmail(context.Background(), ident)
+	ctx := context.Background()
+	ip := middleware.ClientIP(c)
+
+	u, err := repository.GetUserByUsernameOrEmail(ctx, ident)
 	if err != nil {
 		log.Printf("[auth] repo error: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
 	}
+	throttleKey := loginThrottleKey(ident, u)
+
+	// brute-force protection: locked accounts / ips are refused before any bcrypt work
+	remaining, err := loginLockRemaining(ctx, throttleKey, ip)
+	if err != nil {
+		log.Printf("[auth] lockout lookup error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
+	}
+	if remaining > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(remaining.Seconds())+1))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "too many failed attempts, try again later"})
+	}
+
 	if u == nil {
-		log.Printf("[auth] user not found for: %s", ident)
+		// spend the same bcrypt time as a real check so response timing
+		// does not reveal whether the account exists
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(body.Password))
+		recordLoginFailure(ctx, throttleKey, ip)
+		log.Printf("[auth] login failed: unknown account from %s", ip)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid credentials"})
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(body.Password)); err != nil {
-		log.Printf("[auth] bcrypt compare fail for user %s: %v", u.Username, err)
+		recordLoginFailure(ctx, throttleKey, ip)
+		log.Printf("[auth] login failed: bad password for user %s from %s", u.ID, ip)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid credentials"})
 	}
+	clearLoginFailures(ctx, throttleKey)
 
 	if !u.IsActive {
 		log.Printf("[auth] user not active: %s", u.Username)
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user not active"})
 	}
-
-	perms, err := repository.ListPermissionsByRole(context.Background(), u.RoleID)
-	if err != nil {
-		log.Printf("[auth] failed load permissions for role %s: %v", u.RoleID, err)
-		perms = []string{}
+	if u.IsServiceAccount {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "service accounts authenticate with api tokens"})
 	}
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "change-this-secret"
-	}
-	expHours := 24
-	if v := os.Getenv("JWT_EXPIRES_HOURS"); v != "" {
-		if hh, err := strconv.Atoi(v); err == nil && hh > 0 {
-			expHours = hh
-		}
+	// second factor: enrolled users (or roles that demand it) get a short-lived
+	// "mfa pending" token instead of a session
+	if beginMFAStep(c, ctx, u) {
+		return nil
 	}
 
-	now := time.Now()
-	claims := jwt.MapClaims{
-		"sub":         u.ID,
-		"username":    u.Username,
-		"email":       u.Email,
-		"role_id":     u.RoleID,
-		"permissions": perms,
-		"iat":         now.Unix(),
-		"exp":         now.Add(time.Duration(expHours) * time.Hour).Unix(),
+	return completeLogin(c, ctx, u, nil)
+}
+
+// completeLogin issues the access/refresh pair and writes the login response.
+// extra fields (if any) are merged into the response body.
+func completeLogin(c *fiber.Ctx, ctx context.Context, u *model.User, extra fiber.Map) error {
+	sid, err := startSession(c, ctx, u.ID)
+	if err != nil {
+		log.Printf("[auth] create session error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenStr, err := token.SignedString([]byte(jwtSecret))
+	tokenStr, perms, err := generateAccessToken(ctx, u, sid)
 	if err != nil {
 		log.Printf("[auth] jwt sign error: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed generate token"})
 	}
 
+	refreshStr, err := issueRefreshToken(ctx, u.ID, sid)
+	if err != nil {
+		log.Printf("[auth] refresh token error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed generate token"})
+	}
+
 	profile := fiber.Map{
 		"id":          u.ID,
 		"username":    u.Username,
@@ -112,29 +142,253 @@ func AuthenticateService(c *fiber.Ctx) error {
 		"permissions": perms,
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"token": tokenStr,
-		"user":  profile,
-	})
+	out := fiber.Map{
+		"token":         tokenStr,
+		"refresh_token": refreshStr,
+		"user":          profile,
+	}
+	for k, v := range extra {
+		out[k] = v
+	}
+	return c.Status(fiber.StatusOK).JSON(out)
 }
 
-// RefreshTokenService - stub (optional)
-// If you implement refresh tokens, replace this with real logic.
-// For now returns 501 Not Implemented.
+// RefreshTokenService exchanges a refresh token for a new access/refresh pair.
+// Every refresh token is single-use: presenting one that was already rotated
+// revokes the whole family (all tokens descending from the same login).
+// @Summary Refresh access token
+// @Tags Auth
+// @Description Rotate a refresh token and return a new access token + refresh token.
+// @Accept json
+// @Produce json
+// @Param body body object true "Refresh body" example({"refresh_token":"..."})
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/refresh [post]
 func RefreshTokenService(c *fiber.Ctx) error {
-	return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{
-		"error":   "not_implemented",
-		"message": "refresh token not implemented",
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "refresh_token required"})
+	}
+	ctx := context.Background()
+
+	rt, err := repository.GetRefreshTokenByHash(ctx, hashToken(body.RefreshToken))
+	if err != nil {
+		log.Printf("[auth] refresh lookup error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
+	}
+	if rt == nil || rt.RevokedAt != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid refresh token"})
+	}
+	if rt.UsedAt != nil {
+		return refreshReuseDetected(c, rt.FamilyID, rt.UserID)
+	}
+	if time.Now().After(rt.ExpiresAt) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "refresh token expired"})
+	}
+
+	// consume atomically; losing the race means someone else used it first
+	ok, err := repository.MarkRefreshTokenUsed(ctx, rt.ID)
+	if err != nil {
+		log.Printf("[auth] refresh consume error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
+	}
+	if !ok {
+		return refreshReuseDetected(c, rt.FamilyID, rt.UserID)
+	}
+
+	u, err := repository.GetUserByID(ctx, rt.UserID)
+	if err != nil {
+		log.Printf("[auth] refresh user lookup error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
+	}
+	if u == nil || !u.IsActive {
+		_ = repository.RevokeRefreshTokenFamily(ctx, rt.FamilyID)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid refresh token"})
+	}
+
+	// the family id is the session id
+	if err := repository.TouchSession(ctx, rt.FamilyID, middleware.ClientIP(c), time.Now()); err != nil {
+		log.Printf("[auth] touch session %s error: %v", rt.FamilyID, err)
+	}
+	tokenStr, _, err := generateAccessToken(ctx, u, rt.FamilyID)
+	if err != nil {
+		log.Printf("[auth] jwt sign error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed generate token"})
+	}
+	refreshStr, err := issueRefreshToken(ctx, u.ID, rt.FamilyID)
+	if err != nil {
+		log.Printf("[auth] refresh token error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed generate token"})
+	}
+
+	return c.JSON(fiber.Map{
+		"token":         tokenStr,
+		"refresh_token": refreshStr,
 	})
 }
 
-// LogoutService - simple logout stub
-// If you track server-side token blacklist, add logic here.
+// refreshReuseDetected revokes the token family after a replayed refresh token.
+func refreshReuseDetected(c *fiber.Ctx, familyID, userID string) error {
+	log.Printf("[auth] refresh token reuse detected user=%s family=%s", userID, familyID)
+	if err := repository.RevokeRefreshTokenFamily(context.Background(), familyID); err != nil {
+		log.Printf("[auth] revoke family %s error: %v", familyID, err)
+	}
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "refresh token reuse detected"})
+}
+
+// generateAccessToken signs a short-lived JWT for the user. The role's
+// permissions are embedded together with the role perm_version ("pv") so
+// RequirePermission can tell when they went stale; "sid" ties the token to
+// its session.
+func generateAccessToken(ctx context.Context, u *model.User, sid string) (string, []string, error) {
+	env := config.LoadEnv()
+	expHours := env.JWTExpiresHours
+	if expHours <= 0 {
+		expHours = 24
+	}
+	return signAccessToken(ctx, u, sid, time.Duration(expHours)*time.Hour, nil)
+}
+
+// signAccessToken builds and signs the access token claims; extra claims
+// (e.g. "act" for impersonation) are added on top.
+func signAccessToken(ctx context.Context, u *model.User, sid string, ttl time.Duration, extra jwt.MapClaims) (string, []string, error) {
+	perms, permVersion, err := repository.LoadRolePermissions(ctx, u.RoleID)
+	if err != nil {
+		log.Printf("[auth] failed load permissions for role %s: %v", u.RoleID, err)
+		perms, permVersion = []string{}, 0
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":         u.ID,
+		"username":    u.Username,
+		"email":       u.Email,
+		"role_id":     u.RoleID,
+		"typ":         middleware.TokenTypeAccess,
+		"permissions": perms,
+		"pv":          permVersion,
+		"sid":         sid,
+		"jti":         uuid.New().String(),
+		"iat":         now.Unix(),
+		"iat_us":      now.UnixMicro(),
+		"exp":         now.Add(ttl).Unix(),
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+
+	tokenStr, err := middleware.SignToken(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return tokenStr, perms, nil
+}
+
+// issueRefreshToken creates and stores a new opaque refresh token.
+// familyID is the session id; empty starts a family without a session.
+func issueRefreshToken(ctx context.Context, userID, familyID string) (string, error) {
+	raw, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	env := config.LoadEnv()
+	expHours := env.RefreshExpiresHours
+	if expHours <= 0 {
+		expHours = 720
+	}
+	rt := &model.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(raw),
+		ExpiresAt: time.Now().Add(time.Duration(expHours) * time.Hour),
+	}
+	if err := repository.CreateRefreshToken(ctx, rt); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// newOpaqueToken returns 32 random bytes, base64url encoded.
+func newOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the sha256 hex digest stored in place of opaque tokens.
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// LogoutService revokes the caller's access token and, when given, the
+// refresh token family it came with.
+// @Summary Logout
+// @Tags Auth
+// @Description Revoke the current access token (and optionally its refresh token).
+// @Accept json
+// @Produce json
+// @Param body body object false "Logout body" example({"refresh_token":"..."})
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security Bearer
+// @Router /auth/logout [post]
 func LogoutService(c *fiber.Ctx) error {
-	// Optionally accept token and blacklist it.
+	uid, _ := c.Locals(middleware.LocalsUserID).(string)
+	jti, _ := c.Locals(middleware.LocalsTokenID).(string)
+	exp, _ := c.Locals(middleware.LocalsTokenExpiry).(time.Time)
+	if uid == "" || jti == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthenticated"})
+	}
+	ctx := context.Background()
+
+	if err := middleware.RevokeToken(ctx, jti, uid, exp); err != nil {
+		log.Printf("[auth] revoke token error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
+	}
+	// logging out ends the whole session (and its refresh tokens)
+	if sid, _ := c.Locals(middleware.LocalsSessionID).(string); sid != "" {
+		if _, err := revokeSession(ctx, uid, sid); err != nil {
+			log.Printf("[auth] revoke session %s error: %v", sid, err)
+		}
+	}
+
+	// refresh token is optional; only revoke it if it belongs to the caller
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	_ = c.BodyParser(&body)
+	if body.RefreshToken != "" {
+		rt, err := repository.GetRefreshTokenByHash(ctx, hashToken(body.RefreshToken))
+		if err == nil && rt != nil && rt.UserID == uid {
+			if err := repository.RevokeRefreshTokenFamily(ctx, rt.FamilyID); err != nil {
+				log.Printf("[auth] revoke family %s error: %v", rt.FamilyID, err)
+			}
+		}
+	}
+
 	return c.JSON(fiber.Map{"message": "logged out"})
 }
 
+// revokeUserSessions kills every session and live access/refresh token of a user.
+func revokeUserSessions(ctx context.Context, userID string) error {
+	if err := middleware.RevokeUserTokens(ctx, userID); err != nil {
+		return err
+	}
+	if err := repository.RevokeUserSessionRows(ctx, userID); err != nil {
+		return err
+	}
+	return repository.RevokeUserRefreshTokens(ctx, userID)
+}
+
 // ProfileService - return current user profile from token (requires JWT middleware)
 func ProfileService(c *fiber.Ctx) error {
 	uid, _ := c.Locals(middleware.LocalsUserID).(string)
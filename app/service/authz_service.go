@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"clean-arch/app/model"
+	"clean-arch/app/repository"
+	"clean-arch/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// lookupUser resolves a user by id, username or email.
+func lookupUser(ctx context.Context, ref string) (*model.User, error) {
+	if _, err := uuid.Parse(ref); err == nil {
+		return repository.GetUserByID(ctx, ref)
+	}
+	return repository.GetUserByUsernameOrEmail(ctx, ref)
+}
+
+// ExplainAuthzService
+// @Summary Explain a permission decision
+// @Tags Permissions
+// @Description Replay the permission check for a user against the role's current grants (database) and this instance's cache. perm is comma separated; mode is "all" (default) or "any".
+// @Produce json
+// @Param user query string true "User id, username or email"
+// @Param perm query string true "Permission(s), e.g. achievements.verify"
+// @Param mode query string false "all | any"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security Bearer
+// @Router /authz/explain [get]
+func ExplainAuthzService(c *fiber.Ctx) error {
+	ref := strings.TrimSpace(c.Query("user"))
+	var perms []string
+	for _, p := range strings.Split(c.Query("perm"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			perms = append(perms, p)
+		}
+	}
+	if ref == "" || len(perms) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "user and perm required"})
+	}
+	mode := c.Query("mode", middleware.ModeAll)
+	if mode != middleware.ModeAll && mode != middleware.ModeAny {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "mode must be all or any"})
+	}
+
+	ctx := context.Background()
+	u, err := lookupUser(ctx, ref)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if u == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+	}
+	if u.RoleID == "" {
+		return c.JSON(fiber.Map{
+			"user":     fiber.Map{"id": u.ID, "username": u.Username, "is_active": u.IsActive},
+			"decision": middleware.Decision{UserID: u.ID, Needed: perms, Mode: mode, Reason: "missing role info"},
+		})
+	}
+
+	cached, fresh, err := middleware.ExplainRolePermissions(ctx, u.ID, u.RoleID, mode, perms)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var notes []string
+	if !u.IsActive {
+		notes = append(notes, "user is inactive; requests are rejected before the permission check")
+	}
+	if u.IsServiceAccount {
+		notes = append(notes, "service account: requests use api tokens, which are further limited to their own scope")
+	}
+	if cached == nil {
+		notes = append(notes, "role is not cached on this instance; the next request loads it from the database")
+	} else if cached.RoleVersion != fresh.RoleVersion {
+		notes = append(notes, "cached role permissions are stale; they are reloaded once a token with the newer version arrives")
+	}
+
+	return c.JSON(fiber.Map{
+		"user": fiber.Map{
+			"id":                 u.ID,
+			"username":           u.Username,
+			"role_id":            u.RoleID,
+			"is_active":          u.IsActive,
+			"is_service_account": u.IsServiceAccount,
+		},
+		"decision": fresh,
+		"cached":   cached,
+		"notes":    notes,
+	})
+}
@@ -0,0 +1,294 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"clean-arch/app/model"
+	"clean-arch/app/repository"
+	"clean-arch/config"
+	"clean-arch/mailer"
+	"clean-arch/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bulk invitations are capped per request
+const maxBulkInvitations = 500
+
+// isPendingInvitation reports whether the user was invited and never set a password.
+func isPendingInvitation(u *model.User) bool {
+	return !u.IsActive && u.PasswordHash == "" && !u.IsServiceAccount
+}
+
+// sendInvitation stores a fresh activation token for the user (retiring
+// older ones) and emails the link. Mail failures are logged and reported
+// through mailSent; the invitation stays valid and can be resent.
+func sendInvitation(ctx context.Context, u *model.User, createdBy string) (inv *model.UserInvitation, mailSent bool, err error) {
+	raw, err := newOpaqueToken()
+	if err != nil {
+		return nil, false, err
+	}
+	env := config.LoadEnv()
+	ttl := time.Duration(env.InvitationTTLHours) * time.Hour
+	if ttl <= 0 {
+		ttl = 72 * time.Hour
+	}
+	inv = &model.UserInvitation{
+		UserID:    u.ID,
+		TokenHash: hashToken(raw),
+		ExpiresAt: time.Now().Add(ttl),
+		CreatedBy: createdBy,
+	}
+	if err := repository.CreateInvitation(ctx, inv); err != nil {
+		return nil, false, err
+	}
+
+	link := env.InvitationURL + "?token=" + url.QueryEscape(raw)
+	msg := mailer.Message{
+		To:      u.Email,
+		Subject: "Aktivasi akun",
+		Body: fmt.Sprintf("Halo %s,\n\nAkun Anda (%s) telah dibuat. Buka tautan berikut untuk mengatur password dan mengaktifkan akun (berlaku %d jam):\n\n%s\n",
+			u.FullName, u.Username, int(ttl.Hours()), link),
+	}
+	if err := mailer.Send(ctx, msg); err != nil {
+		log.Printf("[invite] send invitation to user %s error: %v", u.ID, err)
+		return inv, false, nil
+	}
+	return inv, true, nil
+}
+
+// inviteUser creates a pending (inactive, password-less) user and sends the invitation.
+func inviteUser(ctx context.Context, username, email, fullName, roleID, createdBy string) (*model.User, *model.UserInvitation, bool, error) {
+	u := &model.User{
+		Username: username,
+		Email:    email,
+		FullName: fullName,
+		RoleID:   roleID,
+		IsActive: false,
+	}
+	if err := repository.CreateUser(ctx, u); err != nil {
+		return nil, nil, false, err
+	}
+	inv, mailSent, err := sendInvitation(ctx, u, createdBy)
+	if err != nil {
+		// without an invitation nobody can ever activate the user; drop it so
+		// the username/email can simply be invited again
+		if derr := repository.DeleteUser(ctx, u.ID); derr != nil {
+			log.Printf("[invite] remove user %s after failed invitation error: %v", u.ID, derr)
+		}
+		return nil, nil, false, err
+	}
+	return u, inv, mailSent, nil
+}
+
+// BulkInviteUsersService
+// @Summary Invite users in bulk
+// @Tags Users
+// @Description Create pending users without passwords and email each an activation link (admin). Results are reported per row.
+// @Accept json
+// @Produce json
+// @Param body body object true "Users" example({"users":[{"username":"2101001","email":"a@kampus.ac.id","fullName":"A","roleId":"..."}]})
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Security Bearer
+// @Router /users/invitations [post]
+func BulkInviteUsersService(c *fiber.Ctx) error {
+	var body struct {
+		Users []struct {
+			Username string `json:"username"`
+			Email    string `json:"email"`
+			FullName string `json:"fullName"`
+			RoleID   string `json:"roleId"`
+		} `json:"users"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(body.Users) == 0 || len(body.Users) > maxBulkInvitations {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("between 1 and %d users required", maxBulkInvitations)})
+	}
+	createdBy, _ := c.Locals(middleware.LocalsUserID).(string)
+	ctx := context.Background()
+
+	results := make([]fiber.Map, 0, len(body.Users))
+	invited := 0
+	for _, in := range body.Users {
+		row := fiber.Map{"username": in.Username, "email": in.Email}
+		if strings.TrimSpace(in.Username) == "" || strings.TrimSpace(in.Email) == "" {
+			row["error"] = "username and email required"
+			results = append(results, row)
+			continue
+		}
+		u, inv, mailSent, err := inviteUser(ctx, in.Username, in.Email, in.FullName, in.RoleID, createdBy)
+		if err != nil {
+			row["error"] = err.Error()
+			results = append(results, row)
+			continue
+		}
+		invited++
+		row["userId"] = u.ID
+		row["expires_at"] = inv.ExpiresAt
+		row["mail_sent"] = mailSent
+		results = append(results, row)
+	}
+	return c.JSON(fiber.Map{
+		"invited": invited,
+		"failed":  len(body.Users) - invited,
+		"results": results,
+	})
+}
+
+// ResendInvitationService
+// @Summary Resend invitation
+// @Tags Users
+// @Description Issue a new activation link for a pending user; older links stop working (admin).
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security Bearer
+// @Router /users/{id}/invitation [post]
+func ResendInvitationService(c *fiber.Ctx) error {
+	ctx := context.Background()
+	u, err := repository.GetUserByID(ctx, c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if u == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+	}
+	if !isPendingInvitation(u) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "user has already activated the account"})
+	}
+	createdBy, _ := c.Locals(middleware.LocalsUserID).(string)
+	inv, mailSent, err := sendInvitation(ctx, u, createdBy)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "invitation sent", "expires_at": inv.ExpiresAt, "mail_sent": mailSent})
+}
+
+// RevokeInvitationService
+// @Summary Revoke invitation
+// @Tags Users
+// @Description Invalidate a pending user's activation link (admin). The user stays pending.
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security Bearer
+// @Router /users/{id}/invitation [delete]
+func RevokeInvitationService(c *fiber.Ctx) error {
+	ctx := context.Background()
+	u, err := repository.GetUserByID(ctx, c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if u == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+	}
+	n, err := repository.RevokeInvitations(ctx, u.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if n == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "no open invitation"})
+	}
+	return c.JSON(fiber.Map{"message": "invitation revoked"})
+}
+
+// pendingInvitation loads an acceptable invitation and its user (nil, nil if not acceptable).
+func pendingInvitation(ctx context.Context, token string) (*model.UserInvitation, *model.User, error) {
+	inv, err := repository.GetInvitationByHash(ctx, hashToken(token))
+	if err != nil || inv == nil || !inv.Pending(time.Now()) {
+		return nil, nil, err
+	}
+	u, err := repository.GetUserByID(ctx, inv.UserID)
+	if err != nil || u == nil || !isPendingInvitation(u) {
+		return nil, nil, err
+	}
+	return inv, u, nil
+}
+
+// GetInvitationService
+// @Summary Inspect invitation
+// @Tags Auth
+// @Description Show who an activation link is for, so the activation page can greet the user.
+// @Produce json
+// @Param token query string true "Invitation token"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Router /auth/invitation [get]
+func GetInvitationService(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "token required"})
+	}
+	inv, u, err := pendingInvitation(context.Background(), token)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
+	}
+	if inv == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid or expired invitation"})
+	}
+	return c.JSON(fiber.Map{
+		"username":   u.Username,
+		"email":      u.Email,
+		"full_name":  u.FullName,
+		"expires_at": inv.ExpiresAt,
+	})
+}
+
+// AcceptInvitationService
+// @Summary Accept invitation
+// @Tags Auth
+// @Description Set the first password with an activation link; the account becomes active.
+// @Accept json
+// @Produce json
+// @Param body body object true "Accept body" example({"token":"...","password":"..."})
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]string
+// @Router /auth/accept-invitation [post]
+func AcceptInvitationService(c *fiber.Ctx) error {
+	var body struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if body.Token == "" || body.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "token and password required"})
+	}
+	ctx := context.Background()
+
+	inv, u, err := pendingInvitation(ctx, body.Token)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
+	}
+	if inv == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid or expired invitation"})
+	}
+	if problems := currentPasswordPolicy().Validate(body.Password, u.Username, u.Email); len(problems) > 0 {
+		return passwordPolicyError(c, problems)
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to hash password"})
+	}
+
+	ok, err := repository.AcceptInvitation(ctx, inv.ID, u.ID, string(hashed))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
+	}
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid or expired invitation"})
+	}
+	return c.JSON(fiber.Map{"message": "account activated"})
+}
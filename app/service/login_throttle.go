@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"clean-arch/app/model"
+	"clean-arch/app/repository"
+	"clean-arch/config"
+)
+
+// failures older than this no longer count towards a lockout
+const loginAttemptWindow = 24 * time.Hour
+
+// loginThrottleKey is what the failures of a password login count against:
+// the account when it exists, so its username and email share one counter,
+// otherwise the identifier as typed.
+func loginThrottleKey(ident string, u *model.User) string {
+	if u != nil {
+		return "user:" + u.ID
+	}
+	return ident
+}
+
+// identifierKey / ipKey are the login_attempts keys. Identifiers are
+// tracked whether or not the account exists, so a lockout reveals nothing.
+// The ip is middleware.ClientIP, which trusts the proxy header only from TRUSTED_PROXIES.
+func identifierKey(ident string) string {
+	return "id:" + strings.ToLower(strings.TrimSpace(ident))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginLockRemaining returns how long the identifier or ip is still locked (0 if not).
+func loginLockRemaining(ctx context.Context, ident, ip string) (time.Duration, error) {
+	until, err := repository.GetLoginLockedUntil(ctx, []string{identifierKey(ident), ipKey(ip)})
+	if err != nil || until.IsZero() {
+		return 0, err
+	}
+	return time.Until(until), nil
+}
+
+// lockoutDuration is base * 2^(failures-threshold), capped at max; 0 below the threshold.
+func lockoutDuration(failures, threshold int, base, max time.Duration) time.Duration {
+	if threshold <= 0 || failures < threshold {
+		return 0
+	}
+	d := base
+	for i := threshold; i < failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// recordLoginFailure counts a failed attempt for both keys and locks them
+// once their thresholds are crossed.
+func recordLoginFailure(ctx context.Context, ident, ip string) {
+	env := config.LoadEnv()
+	base := time.Duration(env.LoginLockoutBaseSecs) * time.Second
+	max := time.Duration(env.LoginLockoutMaxSecs) * time.Second
+
+	keys := []struct {
+		key       string
+		threshold int
+	}{
+		{identifierKey(ident), env.LoginMaxAttempts},
+		{ipKey(ip), env.LoginMaxAttemptsPerIP},
+	}
+	for _, k := range keys {
+		failures, err := repository.RecordLoginFailure(ctx, k.key, loginAttemptWindow)
+		if err != nil {
+			log.Printf("[auth] record login failure error: %v", err)
+			continue
+		}
+		if d := lockoutDuration(failures, k.threshold, base, max); d > 0 {
+			if err := repository.LockLogin(ctx, k.key, time.Now().Add(d)); err != nil {
+				log.Printf("[auth] lock login error: %v", err)
+			}
+		}
+	}
+}
+
+// clearLoginFailures resets the identifier counter after a successful login.
+// The ip counter is left to decay so one good login cannot reset it.
+func clearLoginFailures(ctx context.Context, ident string) {
+	if err := repository.ClearLoginAttempts(ctx, []string{identifierKey(ident)}); err != nil {
+		log.Printf("[auth] clear login attempts error: %v", err)
+	}
+}
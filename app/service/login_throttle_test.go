@@ -0,0 +1,63 @@
+package service
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"clean-arch/app/model"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLockoutDuration_ExponentialAndCapped(t *testing.T) {
+	base, max := 30*time.Second, 10*time.Minute
+
+	assert.Equal(t, time.Duration(0), lockoutDuration(4, 5, base, max))
+	assert.Equal(t, 30*time.Second, lockoutDuration(5, 5, base, max))
+	assert.Equal(t, 60*time.Second, lockoutDuration(6, 5, base, max))
+	assert.Equal(t, 240*time.Second, lockoutDuration(8, 5, base, max))
+	assert.Equal(t, max, lockoutDuration(50, 5, base, max))
+}
+
+func TestIdentifierKey_Normalized(t *testing.T) {
+	assert.Equal(t, identifierKey("Budi@Kampus.ac.id "), identifierKey("budi@kampus.ac.id"))
+}
+
+func TestLoginThrottleKey_SharedByUsernameAndEmail(t *testing.T) {
+	u := &model.User{ID: "u-1", Username: "budi", Email: "budi@kampus.ac.id"}
+	assert.Equal(t, loginThrottleKey(u.Username, u), loginThrottleKey(u.Email, u))
+	assert.Equal(t, identifierKey("nobody"), identifierKey(loginThrottleKey("nobody", nil)))
+}
+
+func TestAuthenticate_FailureCountsAgainstAccount(t *testing.T) {
+	mock := mockPostgres(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte("right"), bcrypt.MinCost)
+	require.NoError(t, err)
+	now := time.Now()
+
+	mock.ExpectQuery(`WHERE username=\$1 OR email=\$1`).WithArgs("budi@kampus.ac.id").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "username", "email", "password_hash", "full_name", "role_id",
+			"is_active", "is_service_account", "created_at", "updated_at"}).
+			AddRow("u-1", "budi", "budi@kampus.ac.id", string(hash), "Budi", "r-1", true, false, now, now))
+	mock.ExpectQuery(`FROM login_attempts`).WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+	// logging in by email counts against the same key as by username
+	mock.ExpectQuery(`INSERT INTO login_attempts`).WithArgs("id:user:u-1", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(1))
+	mock.ExpectQuery(`INSERT INTO login_attempts`).WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(1))
+
+	app := fiber.New()
+	app.Post("/auth/login", AuthenticateService)
+	req := httptest.NewRequest("POST", "/auth/login", strings.NewReader(`{"identifier":"budi@kampus.ac.id","password":"wrong"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
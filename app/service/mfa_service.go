@@ -0,0 +1,564 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"clean-arch/app/model"
+	"clean-arch/app/repository"
+	"clean-arch/config"
+	"clean-arch/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	mfaPendingTTL     = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+var (
+	errMFAAlreadyEnabled = errors.New("two-factor authentication already enabled")
+	errMFANotStarted     = errors.New("no pending two-factor enrollment")
+	errMFAInvalidCode    = errors.New("invalid code")
+)
+
+// mfaLoginStep tells AuthenticateService whether a password login needs a
+// second step: "mfa_required" (enrolled) or "mfa_enrollment_required" (the
+// role demands 2FA but the user has none yet). Empty means log in directly.
+func mfaLoginStep(ctx context.Context, u *model.User) (string, error) {
+	m, err := repository.GetUserMFA(ctx, u.ID)
+	if err != nil {
+		return "", err
+	}
+	if m != nil && m.Enabled {
+		return "mfa_required", nil
+	}
+	role, err := repository.GetRoleByID(ctx, u.RoleID)
+	if err != nil {
+		return "", err
+	}
+	if role != nil && role.MFARequired {
+		return "mfa_enrollment_required", nil
+	}
+	return "", nil
+}
+
+// beginMFAStep answers a login that still needs its second factor with an
+// "mfa pending" token instead of a session. It returns true when it wrote
+// that response (or an error), false when the user may log in directly.
+func beginMFAStep(c *fiber.Ctx, ctx context.Context, u *model.User) bool {
+	step, err := mfaLoginStep(ctx, u)
+	if err != nil {
+		log.Printf("[auth] mfa lookup error: %v", err)
+		c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
+		return true
+	}
+	if step == "" {
+		return false
+	}
+	pending, err := generateMFAPendingToken(u.ID)
+	if err != nil {
+		log.Printf("[auth] jwt sign error: %v", err)
+		c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed generate token"})
+		return true
+	}
+	c.Status(fiber.StatusOK).JSON(fiber.Map{
+		step:        true,
+		"mfa_token": pending,
+	})
+	return true
+}
+
+// generateMFAPendingToken signs the short-lived token handed out between
+// the password step and the code step. JWTMiddleware refuses it.
+func generateMFAPendingToken(userID string) (string, error) {
+	now := time.Now()
+	return middleware.SignToken(jwt.MapClaims{
+		"sub":    userID,
+		"typ":    middleware.TokenTypeMFAPending,
+		"jti":    uuid.New().String(),
+		"iat":    now.Unix(),
+		"iat_us": now.UnixMicro(),
+		"exp":    now.Add(mfaPendingTTL).Unix(),
+	})
+}
+
+// userFromMFAPendingToken validates an mfa pending token (not yet consumed)
+// and loads its active user. The claims are returned for consumeMFAPendingToken.
+func userFromMFAPendingToken(ctx context.Context, tokenStr string) (*model.User, jwt.MapClaims, error) {
+	token, err := middleware.ParseToken(tokenStr)
+	if err != nil || !token.Valid {
+		return nil, nil, errMFAInvalidCode
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, nil, errMFAInvalidCode
+	}
+	if typ, _ := claims["typ"].(string); typ != middleware.TokenTypeMFAPending {
+		return nil, nil, errMFAInvalidCode
+	}
+	sub, _ := claims["sub"].(string)
+	jti, _ := claims["jti"].(string)
+	if jti == "" || middleware.IsTokenRevoked(jti, sub, middleware.TokenIssuedAt(claims)) {
+		return nil, nil, errMFAInvalidCode
+	}
+	u, err := repository.GetUserByID(ctx, sub)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u == nil || !u.IsActive {
+		return nil, nil, errMFAInvalidCode
+	}
+	return u, claims, nil
+}
+
+// claimMFAPendingToken takes the pending token before its code is checked, so
+// two concurrent requests cannot both complete a login with it. The claim is
+// released again if the code is wrong, and made final by consumeMFAPendingToken.
+func claimMFAPendingToken(ctx context.Context, claims jwt.MapClaims) error {
+	jti, _ := claims["jti"].(string)
+	sub, _ := claims["sub"].(string)
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return errMFAInvalidCode
+	}
+	ok, err := repository.ClaimAccessToken(ctx, jti, sub, exp.Time)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errMFAInvalidCode
+	}
+	return nil
+}
+
+// releaseMFAPendingToken gives a claimed token back after a rejected code, so
+// the user can retry without repeating the password step.
+func releaseMFAPendingToken(ctx context.Context, claims jwt.MapClaims) {
+	jti, _ := claims["jti"].(string)
+	if err := repository.ReleaseAccessToken(ctx, jti); err != nil {
+		log.Printf("[mfa] release pending token error: %v", err)
+	}
+}
+
+// consumeMFAPendingToken revokes a claimed pending token once its code was
+// accepted, so every instance refuses it from now on.
+func consumeMFAPendingToken(ctx context.Context, claims jwt.MapClaims) error {
+	jti, _ := claims["jti"].(string)
+	sub, _ := claims["sub"].(string)
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return errMFAInvalidCode
+	}
+	return middleware.RevokeToken(ctx, jti, sub, exp.Time)
+}
+
+// beginMFAEnrollment stores a fresh secret and returns it with its otpauth URI.
+func beginMFAEnrollment(ctx context.Context, u *model.User) (fiber.Map, error) {
+	m, err := repository.GetUserMFA(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if m != nil && m.Enabled {
+		return nil, errMFAAlreadyEnabled
+	}
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := repository.SaveUserMFASecret(ctx, u.ID, secret); err != nil {
+		return nil, err
+	}
+	account := u.Email
+	if account == "" {
+		account = u.Username
+	}
+	return fiber.Map{
+		"secret":      secret,
+		"otpauth_uri": totpProvisioningURI(config.LoadEnv().MFAIssuer, account, secret),
+	}, nil
+}
+
+// confirmMFAEnrollment checks the first code and enables 2FA.
+// It returns the plaintext recovery codes (shown once, stored hashed).
+func confirmMFAEnrollment(ctx context.Context, u *model.User, code string) ([]string, error) {
+	m, err := repository.GetUserMFA(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, errMFANotStarted
+	}
+	if m.Enabled {
+		return nil, errMFAAlreadyEnabled
+	}
+	step, ok := verifyTOTP(m.Secret, code, time.Now())
+	if !ok {
+		return nil, errMFAInvalidCode
+	}
+	if ok, err := repository.AdvanceMFAStep(ctx, u.ID, step); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errMFAInvalidCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := repository.EnableUserMFA(ctx, u.ID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// checkMFACode accepts a TOTP code (once per time step) or an unused recovery code.
+func checkMFACode(ctx context.Context, userID, code, recoveryCode string) error {
+	m, err := repository.GetUserMFA(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if m == nil || !m.Enabled {
+		return errMFANotStarted
+	}
+	if recoveryCode != "" {
+		ok, err := repository.ConsumeRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(recoveryCode)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errMFAInvalidCode
+		}
+		return nil
+	}
+	step, ok := verifyTOTP(m.Secret, code, time.Now())
+	if !ok {
+		return errMFAInvalidCode
+	}
+	if ok, err := repository.AdvanceMFAStep(ctx, userID, step); err != nil {
+		return err
+	} else if !ok {
+		return errMFAInvalidCode
+	}
+	return nil
+}
+
+// newRecoveryCodes returns codes like "k3j9d-q8x2m" and their sha256 hashes.
+func newRecoveryCodes() ([]string, []string, error) {
+	enc := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(enc.EncodeToString(b))[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, hashToken(raw))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// mfaErrorResponse maps enrollment/verification errors to HTTP answers.
+func mfaErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errMFAInvalidCode):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, errMFAAlreadyEnabled), errors.Is(err, errMFANotStarted):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	default:
+		log.Printf("[mfa] error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
+	}
+}
+
+// currentUser loads the authenticated user from JWT locals.
+func currentUser(c *fiber.Ctx) (*model.User, error) {
+	uid, _ := c.Locals(middleware.LocalsUserID).(string)
+	if uid == "" {
+		return nil, nil
+	}
+	return repository.GetUserByID(context.Background(), uid)
+}
+
+// MFAEnrollService
+// @Summary Start TOTP enrollment
+// @Tags MFA
+// @Description Generate a TOTP secret and otpauth:// provisioning URI (render it as a QR code).
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security Bearer
+// @Router /auth/mfa/enroll [post]
+func MFAEnrollService(c *fiber.Ctx) error {
+	u, err := currentUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if u == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthenticated"})
+	}
+	out, err := beginMFAEnrollment(context.Background(), u)
+	if err != nil {
+		return mfaErrorResponse(c, err)
+	}
+	return c.JSON(out)
+}
+
+// MFAConfirmService
+// @Summary Confirm TOTP enrollment
+// @Tags MFA
+// @Description Verify the first code, enable 2FA and return one-time recovery codes.
+// @Accept json
+// @Produce json
+// @Param body body object true "Code" example({"code":"123456"})
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security Bearer
+// @Router /auth/mfa/confirm [post]
+func MFAConfirmService(c *fiber.Ctx) error {
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "code required"})
+	}
+	u, err := currentUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if u == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthenticated"})
+	}
+	codes, err := confirmMFAEnrollment(context.Background(), u, body.Code)
+	if err != nil {
+		return mfaErrorResponse(c, err)
+	}
+	return c.JSON(fiber.Map{"message": "two-factor authentication enabled", "recovery_codes": codes})
+}
+
+// MFADisableService
+// @Summary Disable TOTP
+// @Tags MFA
+// @Description Turn off 2FA (needs a current code or recovery code). Not allowed when the role requires 2FA.
+// @Accept json
+// @Produce json
+// @Param body body object true "Code" example({"code":"123456"})
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Security Bearer
+// @Router /auth/mfa/disable [post]
+func MFADisableService(c *fiber.Ctx) error {
+	var body struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.BodyParser(&body); err != nil || (body.Code == "" && body.RecoveryCode == "") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "code or recovery_code required"})
+	}
+	ctx := context.Background()
+	u, err := currentUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if u == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthenticated"})
+	}
+	role, err := repository.GetRoleByID(ctx, u.RoleID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if role != nil && role.MFARequired {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "two-factor authentication is mandatory for this role"})
+	}
+	if err := checkMFACode(ctx, u.ID, body.Code, body.RecoveryCode); err != nil {
+		return mfaErrorResponse(c, err)
+	}
+	if err := repository.DisableUserMFA(ctx, u.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "two-factor authentication disabled"})
+}
+
+// MFASetupService
+// @Summary Start mandatory TOTP enrollment during login
+// @Tags MFA
+// @Description For logins answered with mfa_enrollment_required: exchange the mfa_token for a TOTP secret.
+// @Accept json
+// @Produce json
+// @Param body body object true "Pending token" example({"mfa_token":"..."})
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /auth/mfa/setup [post]
+func MFASetupService(c *fiber.Ctx) error {
+	var body struct {
+		MFAToken string `json:"mfa_token"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.MFAToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "mfa_token required"})
+	}
+	ctx := context.Background()
+	u, _, err := userFromMFAPendingToken(ctx, body.MFAToken)
+	if err != nil {
+		return mfaErrorResponse(c, err)
+	}
+	out, err := beginMFAEnrollment(ctx, u)
+	if err != nil {
+		return mfaErrorResponse(c, err)
+	}
+	return c.JSON(out)
+}
+
+// MFASetupConfirmService
+// @Summary Finish mandatory TOTP enrollment during login
+// @Tags MFA
+// @Description Verify the first code, enable 2FA and complete the login (tokens + recovery codes).
+// @Accept json
+// @Produce json
+// @Param body body object true "Pending token and code" example({"mfa_token":"...","code":"123456"})
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /auth/mfa/setup/confirm [post]
+func MFASetupConfirmService(c *fiber.Ctx) error {
+	var body struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.MFAToken == "" || body.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "mfa_token and code required"})
+	}
+	ctx := context.Background()
+	u, claims, err := userFromMFAPendingToken(ctx, body.MFAToken)
+	if err != nil {
+		return mfaErrorResponse(c, err)
+	}
+	if err := claimMFAPendingToken(ctx, claims); err != nil {
+		return mfaErrorResponse(c, err)
+	}
+	codes, err := confirmMFAEnrollment(ctx, u, body.Code)
+	if err != nil {
+		releaseMFAPendingToken(ctx, claims)
+		return mfaErrorResponse(c, err)
+	}
+	if err := consumeMFAPendingToken(ctx, claims); err != nil {
+		return mfaErrorResponse(c, err)
+	}
+	return completeLogin(c, ctx, u, fiber.Map{"recovery_codes": codes})
+}
+
+// MFAVerifyService
+// @Summary Second login step
+// @Tags MFA
+// @Description Exchange the mfa_token from /auth/login plus a TOTP or recovery code for a session.
+// @Accept json
+// @Produce json
+// @Param body body object true "Pending token and code" example({"mfa_token":"...","code":"123456"})
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Router /auth/mfa/verify [post]
+func MFAVerifyService(c *fiber.Ctx) error {
+	var body struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.MFAToken == "" || (body.Code == "" && body.RecoveryCode == "") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "mfa_token and code (or recovery_code) required"})
+	}
+	ctx := context.Background()
+	u, claims, err := userFromMFAPendingToken(ctx, body.MFAToken)
+	if err != nil {
+		return mfaErrorResponse(c, err)
+	}
+
+	// codes are only 6 digits: reuse the login lockout, keyed per user
+	ip := middleware.ClientIP(c)
+	throttleKey := "mfa:" + u.ID
+	remaining, err := loginLockRemaining(ctx, throttleKey, ip)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
+	}
+	if remaining > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(remaining.Seconds())+1))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "too many failed attempts, try again later"})
+	}
+
+	// one pending token, one login: take it before the code is checked
+	if err := claimMFAPendingToken(ctx, claims); err != nil {
+		return mfaErrorResponse(c, err)
+	}
+	if err := checkMFACode(ctx, u.ID, body.Code, body.RecoveryCode); err != nil {
+		releaseMFAPendingToken(ctx, claims)
+		if errors.Is(err, errMFAInvalidCode) {
+			recordLoginFailure(ctx, throttleKey, ip)
+		}
+		return mfaErrorResponse(c, err)
+	}
+	clearLoginFailures(ctx, throttleKey)
+
+	if err := consumeMFAPendingToken(ctx, claims); err != nil {
+		return mfaErrorResponse(c, err)
+	}
+	return completeLogin(c, ctx, u, nil)
+}
+
+// SetRoleMFARequirementService
+// @Summary Require 2FA for a role
+// @Tags Roles
+// @Description Make TOTP mandatory (or optional) for every user of the role (admin).
+// @Accept json
+// @Produce json
+// @Param id path string true "Role ID"
+// @Param body body object true "Requirement" example({"required":true})
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security Bearer
+// @Router /roles/{id}/mfa [put]
+func SetRoleMFARequirementService(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "id required"})
+	}
+	var body struct {
+		Required *bool `json:"required"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.Required == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "required (bool) required"})
+	}
+	found, err := repository.SetRoleMFARequired(context.Background(), id, *body.Required)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not found"})
+	}
+	return c.JSON(fiber.Map{"roleId": id, "mfa_required": *body.Required})
+}
@@ -0,0 +1,389 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"clean-arch/app/model"
+	"clean-arch/app/repository"
+	"clean-arch/config"
+	"clean-arch/middleware"
+	"clean-arch/oidc"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// pending SSO logins must come back from the provider within this time
+const oidcStateTTL = 10 * time.Minute
+
+var (
+	oidcProvider   *oidc.Provider
+	oidcProviderMu sync.Mutex
+
+	errOIDCDisabled = errors.New("sso is not configured")
+	errOIDCNoRole   = errors.New("no role mapped for this account")
+	errOIDCNoEmail  = errors.New("identity provider did not supply a verified email")
+	errOIDCNoUser   = errors.New("no local account for this identity")
+)
+
+// idpSecondFactor reports whether the provider's MFA counts for this login:
+// only with OIDC_TRUST_IDP_MFA and an amr/acr claim proving it.
+func idpSecondFactor(env *config.Env, claims *oidc.Claims) bool {
+	if !env.OIDCTrustIdPMFA {
+		return false
+	}
+	if env.OIDCMFAACR != "" && claims.ACR == env.OIDCMFAACR {
+		return true
+	}
+	for _, want := range strings.Split(env.OIDCMFAAMR, ",") {
+		want = strings.TrimSpace(want)
+		for _, m := range claims.AMR {
+			if want != "" && m == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// currentOIDCProvider discovers the provider on first use. A failed
+// discovery is retried on the next login instead of being cached.
+func currentOIDCProvider(ctx context.Context) (*oidc.Provider, error) {
+	oidcProviderMu.Lock()
+	defer oidcProviderMu.Unlock()
+	if oidcProvider != nil {
+		return oidcProvider, nil
+	}
+	env := config.LoadEnv()
+	if env.OIDCIssuer == "" {
+		return nil, errOIDCDisabled
+	}
+	p, err := oidc.NewProvider(ctx, oidc.Config{
+		Issuer:       env.OIDCIssuer,
+		ClientID:     env.OIDCClientID,
+		ClientSecret: env.OIDCClientSecret,
+		RedirectURL:  env.OIDCRedirectURL,
+		Scopes:       strings.Split(env.OIDCScopes, ","),
+		GroupsClaim:  env.OIDCGroupsClaim,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	oidcProvider = p
+	return p, nil
+}
+
+// mapGroupsToRole returns the role name of the first "group=role" pair in
+// mapping whose group the user belongs to ("" when none matches).
+func mapGroupsToRole(mapping string, groups []string) string {
+	member := map[string]bool{}
+	for _, g := range groups {
+		member[strings.ToLower(g)] = true
+	}
+	for _, pair := range strings.Split(mapping, ",") {
+		group, role, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		if member[strings.ToLower(strings.TrimSpace(group))] {
+			return strings.TrimSpace(role)
+		}
+	}
+	return ""
+}
+
+// resolveOIDCUser finds the local user for verified ID token claims: by
+// linked identity, then by verified email (and links it), else provisions
+// a new account. IdP groups mapped to a role override the user's role.
+func resolveOIDCUser(ctx context.Context, claims *oidc.Claims) (*model.User, error) {
+	env := config.LoadEnv()
+
+	var mapped *model.Role
+	if name := mapGroupsToRole(env.OIDCGroupRoleMap, claims.Groups); name != "" {
+		r, err := repository.GetRoleByName(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			log.Printf("[oidc] mapped role %q does not exist", name)
+		}
+		mapped = r
+	}
+
+	u, err := linkedOIDCUser(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		if !env.OIDCAutoProvision {
+			return nil, errOIDCNoUser
+		}
+		return provisionOIDCUser(ctx, env, claims, mapped)
+	}
+
+	if mapped != nil && mapped.ID != u.RoleID {
+		u.RoleID = mapped.ID
+		if err := repository.UpdateUser(ctx, u); err != nil {
+			return nil, err
+		}
+		// tokens issued under the old role must not survive
+		if err := middleware.RevokeUserTokens(ctx, u.ID); err != nil {
+			log.Printf("[oidc] revoke tokens for user %s error: %v", u.ID, err)
+		}
+	}
+	return u, nil
+}
+
+// linkedOIDCUser returns the user already linked to the identity, or an
+// existing user with the same verified email (linking it). nil if neither.
+func linkedOIDCUser(ctx context.Context, claims *oidc.Claims) (*model.User, error) {
+	ident, err := repository.GetUserIdentity(ctx, claims.Issuer, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if ident != nil {
+		return repository.GetUserByID(ctx, ident.UserID)
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, nil
+	}
+	u, err := repository.GetUserByUsernameOrEmail(ctx, claims.Email)
+	if err != nil || u == nil {
+		return nil, err
+	}
+	if !strings.EqualFold(u.Email, claims.Email) {
+		return nil, nil
+	}
+	if err := repository.CreateUserIdentity(ctx, &model.UserIdentity{
+		UserID: u.ID, Issuer: claims.Issuer, Subject: claims.Subject, Email: claims.Email,
+	}); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// provisionOIDCUser creates a local account (with an unusable password) for
+// a first-time SSO login.
+func provisionOIDCUser(ctx context.Context, env *config.Env, claims *oidc.Claims, role *model.Role) (*model.User, error) {
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, errOIDCNoEmail
+	}
+	if role == nil && env.OIDCDefaultRole != "" {
+		r, err := repository.GetRoleByName(ctx, env.OIDCDefaultRole)
+		if err != nil {
+			return nil, err
+		}
+		role = r
+	}
+	if role == nil {
+		return nil, errOIDCNoRole
+	}
+
+	username, err := oidcUsername(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	fullName := claims.Name
+	if fullName == "" {
+		fullName = username
+	}
+	u := &model.User{
+		Username:     username,
+		Email:        claims.Email,
+		PasswordHash: string(hashed),
+		FullName:     fullName,
+		RoleID:       role.ID,
+		IsActive:     true,
+	}
+	if err := repository.CreateUser(ctx, u); err != nil {
+		return nil, err
+	}
+	if err := repository.CreateUserIdentity(ctx, &model.UserIdentity{
+		UserID: u.ID, Issuer: claims.Issuer, Subject: claims.Subject, Email: claims.Email,
+	}); err != nil {
+		return nil, err
+	}
+	log.Printf("[oidc] provisioned user %s (%s) role=%s", u.ID, u.Username, role.Name)
+	return u, nil
+}
+
+// oidcUsername picks preferred_username (or the email name) and makes it unique.
+func oidcUsername(ctx context.Context, claims *oidc.Claims) (string, error) {
+	base := strings.TrimSpace(claims.PreferredUsername)
+	if base == "" || strings.Contains(base, "@") {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	name := base
+	for i := 0; i < 5; i++ {
+		existing, err := repository.GetUserByUsernameOrEmail(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		if existing == nil {
+			return name, nil
+		}
+		suffix, err := newOpaqueToken()
+		if err != nil {
+			return "", err
+		}
+		name = base + "-" + strings.ToLower(suffix[:4])
+	}
+	return "", errors.New("could not choose a unique username")
+}
+
+// OIDCLoginService
+// @Summary Start SSO login
+// @Tags Auth
+// @Description Redirect to the campus identity provider (authorization code + PKCE). With ?redirect=false the URL is returned as JSON instead.
+// @Produce json
+// @Param redirect query bool false "false to get the URL as JSON"
+// @Success 302 {string} string "redirect to the identity provider"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Router /auth/oidc/login [get]
+func OIDCLoginService(c *fiber.Ctx) error {
+	ctx := context.Background()
+	p, err := currentOIDCProvider(ctx)
+	if errors.Is(err, errOIDCDisabled) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		log.Printf("[oidc] discovery error: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "identity provider unavailable"})
+	}
+
+	state, err := oidc.RandomState()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
+	}
+	nonce, err := oidc.RandomState()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
+	}
+	verifier, err := oidc.NewPKCEVerifier()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
+	}
+	if err := repository.SaveOIDCLoginState(ctx, hashToken(state), verifier, nonce, time.Now().Add(oidcStateTTL)); err != nil {
+		log.Printf("[oidc] save state error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
+	}
+
+	authURL := p.AuthCodeURL(state, nonce, verifier)
+	if c.Query("redirect") == "false" {
+		return c.JSON(fiber.Map{"authorization_url": authURL})
+	}
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// oidcAuthErrors are the authorization error codes of RFC 6749 4.1.2.1 and
+// OpenID Connect Core 3.1.2.6. Anything else the provider (or whoever crafted
+// the redirect) put in the error parameter is not shown to the user.
+var oidcAuthErrors = map[string]bool{
+	"invalid_request": true, "unauthorized_client": true, "access_denied": true,
+	"unsupported_response_type": true, "invalid_scope": true, "server_error": true,
+	"temporarily_unavailable": true, "interaction_required": true, "login_required": true,
+	"account_selection_required": true, "consent_required": true, "invalid_request_uri": true,
+	"invalid_request_object": true, "request_not_supported": true, "request_uri_not_supported": true,
+	"registration_not_supported": true,
+}
+
+// oidcCallbackError is the message for an error redirect from the provider.
+func oidcCallbackError(code string) string {
+	if oidcAuthErrors[code] {
+		return "sso login failed: " + code
+	}
+	return "sso login failed"
+}
+
+// OIDCCallbackService
+// @Summary Finish SSO login
+// @Tags Auth
+// @Description Redirect target of the identity provider. Verifies the ID token, links or provisions the user and returns the usual login response.
+// @Produce json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State from /auth/oidc/login"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /auth/oidc/callback [get]
+func OIDCCallbackService(c *fiber.Ctx) error {
+	if idpErr := c.Query("error"); idpErr != "" {
+		desc := c.Query("error_description")
+		if len(desc) > 200 {
+			desc = desc[:200]
+		}
+		log.Printf("[oidc] provider returned error=%q description=%q", idpErr, desc)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": oidcCallbackError(idpErr)})
+	}
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "code and state required"})
+	}
+	ctx := context.Background()
+
+	p, err := currentOIDCProvider(ctx)
+	if errors.Is(err, errOIDCDisabled) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		log.Printf("[oidc] discovery error: %v", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "identity provider unavailable"})
+	}
+
+	verifier, nonce, ok, err := repository.ConsumeOIDCLoginState(ctx, hashToken(state))
+	if err != nil {
+		log.Printf("[oidc] consume state error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
+	}
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid or expired state"})
+	}
+
+	claims, err := p.Exchange(ctx, code, verifier, nonce)
+	if err != nil {
+		log.Printf("[oidc] code exchange failed: %v", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "sso login failed"})
+	}
+
+	u, err := resolveOIDCUser(ctx, claims)
+	switch {
+	case errors.Is(err, errOIDCNoRole), errors.Is(err, errOIDCNoEmail), errors.Is(err, errOIDCNoUser):
+		log.Printf("[oidc] refused sub=%s: %v", claims.Subject, err)
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		log.Printf("[oidc] resolve user error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
+	case u == nil:
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": errOIDCNoUser.Error()})
+	}
+	if !u.IsActive {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user not active"})
+	}
+	if u.IsServiceAccount {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "service accounts authenticate with api tokens"})
+	}
+
+	// role-mandated 2FA applies to SSO too, unless the provider's second
+	// factor is explicitly trusted and shown in the ID token
+	if !idpSecondFactor(config.LoadEnv(), claims) && beginMFAStep(c, ctx, u) {
+		return nil
+	}
+	return completeLogin(c, ctx, u, fiber.Map{"sso": true})
+}
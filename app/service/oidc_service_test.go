@@ -0,0 +1,57 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"clean-arch/config"
+	"clean-arch/oidc"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapGroupsToRole(t *testing.T) {
+	mapping := "ti-admin=admin, ti-dosen=dosen_wali,ti-mhs=mahasiswa"
+
+	assert.Equal(t, "admin", mapGroupsToRole(mapping, []string{"ti-mhs", "TI-Admin"}))
+	assert.Equal(t, "dosen_wali", mapGroupsToRole(mapping, []string{"ti-dosen"}))
+	assert.Equal(t, "", mapGroupsToRole(mapping, []string{"staff"}))
+	assert.Equal(t, "", mapGroupsToRole("", []string{"ti-mhs"}))
+}
+
+func TestIdPSecondFactor(t *testing.T) {
+	withMFA := &oidc.Claims{AMR: []string{"pwd", "otp"}}
+	pwdOnly := &oidc.Claims{AMR: []string{"pwd"}, ACR: "loa1"}
+
+	// not trusted unless configured
+	assert.False(t, idpSecondFactor(&config.Env{OIDCMFAAMR: "mfa,otp"}, withMFA))
+
+	env := &config.Env{OIDCTrustIdPMFA: true, OIDCMFAAMR: "mfa, otp", OIDCMFAACR: "loa2"}
+	assert.True(t, idpSecondFactor(env, withMFA))
+	assert.False(t, idpSecondFactor(env, pwdOnly))
+	assert.True(t, idpSecondFactor(env, &oidc.Claims{ACR: "loa2"}))
+}
+
+func TestOIDCCallback_ProviderErrorNotEchoed(t *testing.T) {
+	app := fiber.New()
+	app.Get("/auth/oidc/callback", OIDCCallbackService)
+
+	cases := map[string]string{
+		"access_denied": "sso login failed: access_denied",
+		"Your session expired, call +1-555-0100 to restore access": "sso login failed",
+	}
+	for param, want := range cases {
+		req := httptest.NewRequest("GET", "/auth/oidc/callback?error="+url.QueryEscape(param), nil)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, want, body["error"])
+	}
+}
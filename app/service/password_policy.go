@@ -0,0 +1,137 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+
+	"clean-arch/config"
+)
+
+// PasswordPolicy is the single place password rules are checked
+// (user creation, password change, password reset).
+type PasswordPolicy struct {
+	MinLength     int
+	RequireLower  bool
+	RequireUpper  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	banned        map[string]struct{}
+}
+
+// commonPasswords is always banned, on top of PASSWORD_BANNED_FILE.
+var commonPasswords = []string{
+	"123456", "12345678", "123456789", "1234567890", "password", "password1",
+	"password123", "qwerty", "qwerty123", "abc123", "111111", "123123",
+	"admin", "admin123", "welcome", "welcome1", "letmein", "iloveyou",
+	"secret", "changeme", "p@ssw0rd", "passw0rd", "mahasiswa", "mahasiswa123",
+	"dosen123", "bismillah", "indonesia", "rahasia", "rahasia123", "12345678910",
+}
+
+var (
+	policy     *PasswordPolicy
+	policyOnce sync.Once
+)
+
+// currentPasswordPolicy builds the policy from env once.
+func currentPasswordPolicy() *PasswordPolicy {
+	policyOnce.Do(func() {
+		policy = newPasswordPolicy(config.LoadEnv())
+	})
+	return policy
+}
+
+func newPasswordPolicy(env *config.Env) *PasswordPolicy {
+	p := &PasswordPolicy{MinLength: env.PasswordMinLength, banned: map[string]struct{}{}}
+	for _, class := range strings.Split(env.PasswordRequireClasses, ",") {
+		switch strings.TrimSpace(class) {
+		case "lower":
+			p.RequireLower = true
+		case "upper":
+			p.RequireUpper = true
+		case "digit":
+			p.RequireDigit = true
+		case "symbol":
+			p.RequireSymbol = true
+		}
+	}
+	for _, pw := range commonPasswords {
+		p.banned[pw] = struct{}{}
+	}
+	if env.PasswordBannedFile != "" {
+		if err := p.loadBannedFile(env.PasswordBannedFile); err != nil {
+			log.Printf("[password] failed to load banned list %s: %v", env.PasswordBannedFile, err)
+		}
+	}
+	return p
+}
+
+// loadBannedFile adds one password per line (blank lines and # comments skipped).
+func (p *PasswordPolicy) loadBannedFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.banned[strings.ToLower(line)] = struct{}{}
+	}
+	return sc.Err()
+}
+
+// Validate returns the list of rules the password breaks (empty when valid).
+// username/email are used to reject passwords that merely repeat them.
+func (p *PasswordPolicy) Validate(password, username, email string) []string {
+	var out []string
+	if len([]rune(password)) < p.MinLength {
+		out = append(out, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	if p.RequireLower && !lower {
+		out = append(out, "must contain a lowercase letter")
+	}
+	if p.RequireUpper && !upper {
+		out = append(out, "must contain an uppercase letter")
+	}
+	if p.RequireDigit && !digit {
+		out = append(out, "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		out = append(out, "must contain a symbol")
+	}
+
+	lowered := strings.ToLower(password)
+	if _, ok := p.banned[lowered]; ok {
+		out = append(out, "is too common or known to be breached")
+	}
+	if username != "" && strings.Contains(lowered, strings.ToLower(username)) {
+		out = append(out, "must not contain the username")
+	}
+	if local, _, ok := strings.Cut(email, "@"); ok && len(local) >= 3 && strings.Contains(lowered, strings.ToLower(local)) {
+		out = append(out, "must not contain the email name")
+	}
+	return out
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"clean-arch/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	dir := t.TempDir()
+	banned := filepath.Join(dir, "banned.txt")
+	_ = os.WriteFile(banned, []byte("# breached\nKampusHebat2024\n"), 0o600)
+
+	p := newPasswordPolicy(&config.Env{
+		PasswordMinLength:      10,
+		PasswordRequireClasses: "lower,upper,digit,symbol",
+		PasswordBannedFile:     banned,
+	})
+
+	assert.Empty(t, p.Validate("Gunung-Merapi-77", "budi", "budi@kampus.ac.id"))
+	assert.Contains(t, p.Validate("Ab1!", "", ""), "must be at least 10 characters")
+	assert.Contains(t, p.Validate("alllowercase1!", "", ""), "must contain an uppercase letter")
+	assert.Contains(t, p.Validate("Password123", "", ""), "must contain a symbol")
+	assert.Contains(t, p.Validate("kampushebat2024", "", ""), "is too common or known to be breached")
+	assert.Contains(t, p.Validate("Xbudisantoso-9", "budisantoso", ""), "must not contain the username")
+}
+
+func TestPasswordPolicy_CommonPasswordsAlwaysBanned(t *testing.T) {
+	p := newPasswordPolicy(&config.Env{PasswordMinLength: 1})
+	assert.Contains(t, p.Validate("Password123", "", ""), "is too common or known to be breached")
+}
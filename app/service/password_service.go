@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"clean-arch/app/model"
+	"clean-arch/app/repository"
+	"clean-arch/config"
+	"clean-arch/mailer"
+	"clean-arch/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// forgotPasswordReply is the only answer /auth/forgot-password ever gives,
+// so the endpoint cannot be used to find out which accounts exist.
+const forgotPasswordReply = "if the account exists, a reset link has been sent"
+
+// ForgotPasswordService
+// @Summary Request password reset
+// @Tags Auth
+// @Description Email a single-use password reset link. Always answers 202, whether or not the account exists.
+// @Accept json
+// @Produce json
+// @Param body body object true "Forgot body" example({"email":"mhs@kampus.ac.id"})
+// @Success 202 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /auth/forgot-password [post]
+func ForgotPasswordService(c *fiber.Ctx) error {
+	var body struct {
+		Email      string `json:"email"`
+		Identifier string `json:"identifier"` // alias: username or email
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	ident := strings.TrimSpace(body.Email)
+	if ident == "" {
+		ident = strings.TrimSpace(body.Identifier)
+	}
+	if ident == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "email required"})
+	}
+
+	// token creation and delivery run in the background so the response time
+	// does not depend on whether the account exists
+	go sendPasswordReset(ident)
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": forgotPasswordReply})
+}
+
+// sendPasswordReset issues a reset token for an active account and emails it.
+func sendPasswordReset(ident string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	u, err := repository.GetUserByUsernameOrEmail(ctx, ident)
+	if err != nil {
+		log.Printf("[password] reset lookup error: %v", err)
+		return
+	}
+	if u == nil || !u.IsActive || u.IsServiceAccount || u.Email == "" {
+		return
+	}
+
+	raw, err := newOpaqueToken()
+	if err != nil {
+		log.Printf("[password] reset token error: %v", err)
+		return
+	}
+	env := config.LoadEnv()
+	ttl := time.Duration(env.PasswordResetTTLMinutes) * time.Minute
+	if ttl <= 0 {
+		ttl = 30 * time.Minute
+	}
+	t := &model.PasswordResetToken{
+		UserID:    u.ID,
+		TokenHash: hashToken(raw),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := repository.CreatePasswordResetToken(ctx, t); err != nil {
+		log.Printf("[password] store reset token error: %v", err)
+		return
+	}
+
+	link := env.PasswordResetURL + "?token=" + url.QueryEscape(raw)
+	msg := mailer.Message{
+		To:      u.Email,
+		Subject: "Reset password",
+		Body: fmt.Sprintf("Halo %s,\n\nGunakan tautan berikut untuk mengatur ulang password Anda (berlaku %d menit):\n\n%s\n\nAbaikan email ini jika Anda tidak memintanya.\n",
+			u.FullName, int(ttl.Minutes()), link),
+	}
+	if err := mailer.Send(ctx, msg); err != nil {
+		log.Printf("[password] send reset mail to user %s error: %v", u.ID, err)
+	}
+}
+
+// ResetPasswordService
+// @Summary Reset password
+// @Tags Auth
+// @Description Set a new password with a reset token. The token is single-use and every existing session is revoked.
+// @Accept json
+// @Produce json
+// @Param body body object true "Reset body" example({"token":"...","new_password":"..."})
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/reset-password [post]
+func ResetPasswordService(c *fiber.Ctx) error {
+	var body struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if body.Token == "" || body.NewPassword == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "token and new_password required"})
+	}
+	ctx := context.Background()
+
+	t, err := repository.GetPasswordResetTokenByHash(ctx, hashToken(body.Token))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
+	}
+	if t == nil || t.UsedAt != nil || time.Now().After(t.ExpiresAt) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid or expired token"})
+	}
+
+	u, err := repository.GetUserByID(ctx, t.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
+	}
+	if u == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid or expired token"})
+	}
+	if problems := currentPasswordPolicy().Validate(body.NewPassword, u.Username, u.Email); len(problems) > 0 {
+		return passwordPolicyError(c, problems)
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(body.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to hash password"})
+	}
+
+	ok, err := repository.ConsumePasswordResetToken(ctx, t.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
+	}
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid or expired token"})
+	}
+
+	if err := repository.UpdateUserPassword(ctx, t.UserID, string(hashed)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := revokeUserSessions(ctx, t.UserID); err != nil {
+		log.Printf("[password] revoke sessions for user %s error: %v", t.UserID, err)
+	}
+
+	return c.JSON(fiber.Map{"message": "password updated"})
+}
+
+// ChangePasswordService
+// @Summary Change own password
+// @Tags Auth
+// @Description Change the caller's password. Requires the current password; every other session is revoked and a fresh token pair is returned.
+// @Accept json
+// @Produce json
+// @Param body body object true "Change body" example({"current_password":"...","new_password":"..."})
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security Bearer
+// @Router /auth/password [put]
+func ChangePasswordService(c *fiber.Ctx) error {
+	uid, _ := c.Locals(middleware.LocalsUserID).(string)
+	if uid == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthenticated"})
+	}
+	var body struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if body.CurrentPassword == "" || body.NewPassword == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "current_password and new_password required"})
+	}
+	ctx := context.Background()
+
+	u, err := repository.GetUserByID(ctx, uid)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if u == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(body.CurrentPassword)); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "current password is incorrect"})
+	}
+	if body.NewPassword == body.CurrentPassword {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "new password must differ from the current one"})
+	}
+	if problems := currentPasswordPolicy().Validate(body.NewPassword, u.Username, u.Email); len(problems) > 0 {
+		return passwordPolicyError(c, problems)
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(body.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to hash password"})
+	}
+	if err := repository.UpdateUserPassword(ctx, u.ID, string(hashed)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// revoke everything, then hand the caller a fresh pair so only this session survives
+	if err := revokeUserSessions(ctx, u.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	sid, err := startSession(c, ctx, u.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal"})
+	}
+	tokenStr, _, err := generateAccessToken(ctx, u, sid)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed generate token"})
+	}
+	refreshStr, err := issueRefreshToken(ctx, u.ID, sid)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed generate token"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":       "password updated",
+		"token":         tokenStr,
+		"refresh_token": refreshStr,
+	})
+}
+
+// passwordPolicyError answers 400 with the list of broken rules.
+func passwordPolicyError(c *fiber.Ctx, problems []string) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error":   "password does not meet policy",
+		"details": problems,
+	})
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"clean-arch/app/model"
+	"clean-arch/app/repository"
+	"clean-arch/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// parsePermissionName splits "resource.action" (e.g. "achievements.verify").
+// Wildcard grants are names too: "achievements.*" and "*" (everything).
+func parsePermissionName(name string) (resource, action string, ok bool) {
+	if name == "*" {
+		return "*", "*", true
+	}
+	i := strings.Index(name, ".")
+	if i <= 0 || i == len(name)-1 || strings.ContainsAny(name, " \t") {
+		return "", "", false
+	}
+	return name[:i], name[i+1:], true
+}
+
+// invalidateRoles drops cached permissions of roles touched by a change.
+func invalidateRoles(roleIDs []string) {
+	for _, id := range roleIDs {
+		middleware.InvalidateCachedPerms(id)
+	}
+}
+
+// ListPermissionsService
+// @Summary List permissions
+// @Tags Permissions
+// @Description List permissions ordered by name.
+// @Produce json
+// @Param limit query int false "Page size (default 100)"
+// @Param offset query int false "Offset"
+// @Success 200 {array} model.Permission
+// @Failure 500 {object} map[string]string
+// @Security Bearer
+// @Router /permissions [get]
+func ListPermissionsService(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 100)
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	offset := c.QueryInt("offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+	perms, err := repository.ListPermissions(context.Background(), limit, offset)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(perms)
+}
+
+// GetPermissionService
+// @Summary Get permission
+// @Tags Permissions
+// @Produce json
+// @Param id path string true "Permission ID"
+// @Success 200 {object} model.Permission
+// @Failure 404 {object} map[string]string
+// @Security Bearer
+// @Router /permissions/{id} [get]
+func GetPermissionService(c *fiber.Ctx) error {
+	p, err := repository.GetPermissionByID(context.Background(), c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if p == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "permission not found"})
+	}
+	return c.JSON(p)
+}
+
+// CreatePermissionService
+// @Summary Create permission
+// @Tags Permissions
+// @Description Create a permission. Resource and action default to the two halves of the name.
+// @Accept json
+// @Produce json
+// @Param body body object true "Permission body" example({"name":"reports.export","description":"Export laporan"})
+// @Success 201 {object} model.Permission
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security Bearer
+// @Router /permissions [post]
+func CreatePermissionService(c *fiber.Ctx) error {
+	var body struct {
+		Name        string `json:"name"`
+		Resource    string `json:"resource"`
+		Action      string `json:"action"`
+		Description string `json:"description"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	resource, action, ok := parsePermissionName(body.Name)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "name must look like resource.action"})
+	}
+	if body.Resource == "" {
+		body.Resource = resource
+	}
+	if body.Action == "" {
+		body.Action = action
+	}
+	ctx := context.Background()
+	existing, err := repository.GetPermissionByName(ctx, body.Name)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if existing != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "permission already exists", "id": existing.ID})
+	}
+	p := &model.Permission{Name: body.Name, Resource: body.Resource, Action: body.Action, Description: body.Description}
+	if err := repository.CreatePermission(ctx, p); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusCreated).JSON(p)
+}
+
+// UpdatePermissionService
+// @Summary Update permission
+// @Tags Permissions
+// @Description Update a permission. Renaming it bumps every role that holds it, so stale tokens are re-checked.
+// @Accept json
+// @Produce json
+// @Param id path string true "Permission ID"
+// @Param body body object true "Fields to change" example({"description":"..."})
+// @Success 200 {object} model.Permission
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security Bearer
+// @Router /permissions/{id} [put]
+func UpdatePermissionService(c *fiber.Ctx) error {
+	var body struct {
+		Name        *string `json:"name"`
+		Resource    *string `json:"resource"`
+		Action      *string `json:"action"`
+		Description *string `json:"description"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	ctx := context.Background()
+	p, err := repository.GetPermissionByID(ctx, c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if p == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "permission not found"})
+	}
+
+	if body.Name != nil && strings.TrimSpace(*body.Name) != p.Name {
+		name := strings.TrimSpace(*body.Name)
+		resource, action, ok := parsePermissionName(name)
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "name must look like resource.action"})
+		}
+		other, err := repository.GetPermissionByName(ctx, name)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if other != nil {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "permission already exists", "id": other.ID})
+		}
+		p.Name, p.Resource, p.Action = name, resource, action
+	}
+	if body.Resource != nil {
+		p.Resource = *body.Resource
+	}
+	if body.Action != nil {
+		p.Action = *body.Action
+	}
+	if body.Description != nil {
+		p.Description = *body.Description
+	}
+
+	roles, err := repository.UpdatePermission(ctx, p)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "permission not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	invalidateRoles(roles)
+	return c.JSON(p)
+}
+
+// DeletePermissionService
+// @Summary Delete permission
+// @Tags Permissions
+// @Description Delete a permission and remove it from every role.
+// @Param id path string true "Permission ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Security Bearer
+// @Router /permissions/{id} [delete]
+func DeletePermissionService(c *fiber.Ctx) error {
+	roles, err := repository.DeletePermission(context.Background(), c.Params("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "permission not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	invalidateRoles(roles)
+	return c.JSON(fiber.Map{"message": "permission deleted", "roles_affected": len(roles)})
+}
+
+// PermCacheStatsService
+// @Summary Permission cache statistics
+// @Tags Permissions
+// @Description This instance's role permission cache: size, hit/miss/eviction counts and change-listener state.
+// @Produce json
+// @Success 200 {object} middleware.PermCacheStats
+// @Security Bearer
+// @Router /authz/cache [get]
+func PermCacheStatsService(c *fiber.Ctx) error {
+	return c.JSON(middleware.GetPermCacheStats())
+}
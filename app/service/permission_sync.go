@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"clean-arch/app/model"
+	"clean-arch/app/repository"
+	"clean-arch/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Permission sync modes (PERMISSION_SYNC).
+const (
+	PermissionSyncUpsert = "upsert" // insert missing permissions, fail on malformed ones (the CLI sync)
+	PermissionSyncStrict = "strict" // default: upsert, and fail when a route's permission is granted to no role
+	PermissionSyncCheck  = "check"  // no writes; fail on anything missing, malformed or ungranted
+	PermissionSyncOff    = "off"
+)
+
+// PermissionSyncReport compares the route manifest with the permissions table.
+type PermissionSyncReport struct {
+	Created   []string `json:"created"`   // required by a route, inserted now
+	Missing   []string `json:"missing"`   // required by a route, absent (not inserted)
+	Invalid   []string `json:"invalid"`   // route permissions that aren't resource.action
+	Ungranted []string `json:"ungranted"` // required by a route, granted to no role
+	Unknown   []string `json:"unknown"`   // in the table, required by no route
+}
+
+// Mismatches lists the problems that fail a sync. Ungranted permissions
+// count when strict: such a route answers 403 to everyone, which is what a
+// misspelt permission looks like. Only upsert (used to create permissions
+// before granting them) lets them pass.
+func (r *PermissionSyncReport) Mismatches(strict bool) []string {
+	var out []string
+	for _, p := range r.Invalid {
+		out = append(out, "invalid permission name "+p)
+	}
+	for _, p := range r.Missing {
+		out = append(out, "permission "+p+" is not in the permissions table")
+	}
+	if strict {
+		for _, p := range r.Ungranted {
+			out = append(out, "permission "+p+" is granted to no role (grant it, or fix the route if it is misspelt)")
+		}
+	}
+	return out
+}
+
+// routePermissions maps each required permission to the routes needing it.
+func routePermissions(endpoints []model.Endpoint) map[string][]string {
+	out := map[string][]string{}
+	for _, e := range endpoints {
+		for _, p := range e.RequiredPermissions() {
+			out[p] = append(out[p], e.Method+" "+e.Path)
+		}
+	}
+	return out
+}
+
+// SyncPermissions compares the permissions required by endpoints with the
+// permissions table and role grants. With apply it inserts the missing ones.
+func SyncPermissions(ctx context.Context, endpoints []model.Endpoint, apply bool) (*PermissionSyncReport, error) {
+	required := routePermissions(endpoints)
+	report := &PermissionSyncReport{}
+
+	existing, err := repository.ListPermissions(ctx, 100000, 0)
+	if err != nil {
+		return nil, err
+	}
+	inTable := map[string]bool{}
+	for _, p := range existing {
+		inTable[p.Name] = true
+	}
+
+	names := make([]string, 0, len(required))
+	for name := range required {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		resource, action, ok := parsePermissionName(name)
+		if !ok || strings.Contains(name, "*") {
+			report.Invalid = append(report.Invalid, name)
+			continue
+		}
+		if inTable[name] {
+			continue
+		}
+		if !apply {
+			report.Missing = append(report.Missing, name)
+			continue
+		}
+		p := &model.Permission{
+			Name:        name,
+			Resource:    resource,
+			Action:      action,
+			Description: "required by " + strings.Join(required[name], ", "),
+		}
+		if err := repository.CreatePermission(ctx, p); err != nil {
+			return nil, fmt.Errorf("create permission %s: %w", name, err)
+		}
+		report.Created = append(report.Created, name)
+	}
+
+	// what roles hold today (inheritance and patterns included)
+	roles, err := repository.ListRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var granted []string
+	for _, r := range roles {
+		perms, _, err := repository.LoadRolePermissions(ctx, r.ID)
+		if err != nil {
+			return nil, err
+		}
+		granted = append(granted, perms...)
+	}
+	for _, name := range names {
+		if !middleware.HasPermission(granted, name) {
+			report.Ungranted = append(report.Ungranted, name)
+		}
+	}
+
+	// table entries no route needs; patterns count as used when they cover a route
+	for _, p := range existing {
+		used := false
+		for _, name := range names {
+			if middleware.HasPermission([]string{p.Name}, name) {
+				used = true
+				break
+			}
+		}
+		if !used {
+			report.Unknown = append(report.Unknown, p.Name)
+		}
+	}
+	return report, nil
+}
+
+// CheckPermissions runs SyncPermissions in the given mode, logs what it
+// found and returns an error on mismatches.
+func CheckPermissions(ctx context.Context, endpoints []model.Endpoint, mode string) (*PermissionSyncReport, error) {
+	if mode == PermissionSyncOff {
+		return &PermissionSyncReport{}, nil
+	}
+	report, err := SyncPermissions(ctx, endpoints, mode != PermissionSyncCheck)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range report.Created {
+		log.Printf("[permissions] created %s", p)
+	}
+	for _, p := range report.Ungranted {
+		log.Printf("[permissions] WARNING: %s is required by a route but granted to no role", p)
+	}
+	for _, p := range report.Unknown {
+		log.Printf("[permissions] WARNING: %s is not required by any route", p)
+	}
+	if problems := report.Mismatches(mode != PermissionSyncUpsert); len(problems) > 0 {
+		return report, fmt.Errorf("permission mismatch: %s", strings.Join(problems, "; "))
+	}
+	return report, nil
+}
+
+// ListEndpointsService
+// @Summary List endpoints
+// @Tags Permissions
+// @Description Every registered route with the permission it requires. permission filters to routes that grant (pattern allowed, e.g. achievements.*) would open.
+// @Produce json
+// @Param permission query string false "Permission or pattern"
+// @Success 200 {array} model.Endpoint
+// @Security Bearer
+// @Router /endpoints [get]
+func ListEndpointsService(c *fiber.Ctx, endpoints []model.Endpoint) error {
+	filter := c.Query("permission")
+	if filter == "" {
+		return c.JSON(endpoints)
+	}
+	out := []model.Endpoint{}
+	for _, e := range endpoints {
+		for _, p := range e.RequiredPermissions() {
+			if middleware.HasPermission([]string{filter}, p) {
+				out = append(out, e)
+				break
+			}
+		}
+	}
+	return c.JSON(out)
+}
@@ -2,10 +2,14 @@
 
 import (
 	"context"
+	"errors"
+	"strings"
 
 	"clean-arch/app/model"
 	"clean-arch/app/repository"
+	"clean-arch/middleware"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
 // CreateRoleService
@@ -28,6 +32,15 @@ func CreateRoleService(c *fiber.Ctx) error {
 	if err := c.BodyParser(&body); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "name required"})
+	}
+	if existing, err := repository.GetRoleByName(context.Background(), body.Name); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	} else if existing != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "role already exists"})
+	}
 	r := &model.Role{Name: body.Name, Desc: body.Desc}
 	if err := repository.CreateRole(context.Background(), r); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
@@ -61,3 +74,442 @@ func GetRoleByNameService(c *fiber.Ctx) error {
 	}
 	return c.JSON(r)
 }
+
+// systemRoles are built in and referenced by name elsewhere (seed data,
+// reports, OIDC group mapping); they can't be deleted or renamed.
+var systemRoles = []string{"admin", "mahasiswa", "dosen_wali"}
+
+func isSystemRole(name string) bool {
+	for _, s := range systemRoles {
+		if strings.EqualFold(s, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// revokeMovedUsers forces users whose role changed to refresh their tokens
+// (access tokens carry role_id).
+func revokeMovedUsers(ctx context.Context, userIDs []string) error {
+	for _, uid := range userIDs {
+		if err := middleware.RevokeUserTokens(ctx, uid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListRolesService
+// @Summary List roles
+// @Tags Roles
+// @Description List roles with the number of users holding each.
+// @Produce json
+// @Success 200 {array} model.Role
+// @Failure 500 {object} map[string]string
+// @Security Bearer
+// @Router /roles [get]
+func ListRolesService(c *fiber.Ctx) error {
+	roles, err := repository.ListRoles(context.Background())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(roles)
+}
+
+// UpdateRoleService
+// @Summary Update role
+// @Tags Roles
+// @Description Update a role's name or description. System roles keep their name.
+// @Accept json
+// @Produce json
+// @Param id path string true "Role ID"
+// @Param body body object true "Role body" example({"name":"role-lab","description":"Peran lab"})
+// @Success 200 {object} model.Role
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security Bearer
+// @Router /roles/{id} [put]
+func UpdateRoleService(c *fiber.Ctx) error {
+	var body struct {
+		Name *string `json:"name"`
+		Desc *string `json:"description"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	ctx := context.Background()
+	r, err := repository.GetRoleByID(ctx, c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if r == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role not found"})
+	}
+	if body.Name != nil {
+		name := strings.TrimSpace(*body.Name)
+		if name == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "name required"})
+		}
+		if name != r.Name {
+			if isSystemRole(r.Name) {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "system roles cannot be renamed"})
+			}
+			other, err := repository.GetRoleByName(ctx, name)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			}
+			if other != nil {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "role already exists"})
+			}
+			r.Name = name
+		}
+	}
+	if body.Desc != nil {
+		r.Desc = *body.Desc
+	}
+	ok, err := repository.UpdateRole(ctx, r)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role not found"})
+	}
+	return c.JSON(r)
+}
+
+// DeleteRoleService
+// @Summary Delete role
+// @Tags Roles
+// @Description Delete a role. While users hold it a replacement role is required; they are moved in the same transaction. System roles cannot be deleted.
+// @Param id path string true "Role ID"
+// @Param replacement query string false "Role ID to move current holders to"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security Bearer
+// @Router /roles/{id} [delete]
+func DeleteRoleService(c *fiber.Ctx) error {
+	ctx := context.Background()
+	r, err := repository.GetRoleByID(ctx, c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if r == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role not found"})
+	}
+	if isSystemRole(r.Name) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "system roles cannot be deleted"})
+	}
+	replacement := c.Query("replacement")
+	if replacement != "" {
+		if replacement == r.ID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "replacement must be a different role"})
+		}
+		rep, err := repository.GetRoleByID(ctx, replacement)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		if rep == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "replacement role not found"})
+		}
+	}
+
+	moved, bumped, found, err := repository.DeleteRole(ctx, r.ID, replacement)
+	if errors.Is(err, repository.ErrRoleInUse) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "role is assigned to users; pass ?replacement=<roleId>"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role not found"})
+	}
+	invalidateRoles(bumped)
+	if err := revokeMovedUsers(ctx, moved); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "role deleted", "users_moved": len(moved)})
+}
+
+// ReassignRoleUsersService
+// @Summary Reassign role holders
+// @Tags Roles
+// @Description Move users from this role to another in one transaction. Without userIds every holder is moved.
+// @Accept json
+// @Produce json
+// @Param id path string true "Source role ID"
+// @Param body body object true "Target" example({"roleId":"...","userIds":["..."]})
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security Bearer
+// @Router /roles/{id}/reassign [post]
+func ReassignRoleUsersService(c *fiber.Ctx) error {
+	var body struct {
+		RoleID  string   `json:"roleId"`
+		UserIDs []string `json:"userIds"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.RoleID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "roleId required"})
+	}
+	ctx := context.Background()
+	from, err := repository.GetRoleByID(ctx, c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if from == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role not found"})
+	}
+	if body.RoleID == from.ID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "target must be a different role"})
+	}
+	to, err := repository.GetRoleByID(ctx, body.RoleID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if to == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "target role not found"})
+	}
+
+	moved, err := repository.ReassignRoleUsers(ctx, from.ID, to.ID, body.UserIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := revokeMovedUsers(ctx, moved); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "users reassigned", "users_moved": len(moved)})
+}
+
+// roleAndPermission resolves the :id role and a permission given by id or
+// name. It writes the error response itself and returns ok=false on failure.
+func roleAndPermission(c *fiber.Ctx, ctx context.Context, permRef string) (*model.Role, *model.Permission, bool) {
+	r, err := repository.GetRoleByID(ctx, c.Params("id"))
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return nil, nil, false
+	}
+	if r == nil {
+		c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role not found"})
+		return nil, nil, false
+	}
+	var p *model.Permission
+	if _, perr := uuid.Parse(permRef); perr == nil {
+		p, err = repository.GetPermissionByID(ctx, permRef)
+	} else {
+		p, err = repository.GetPermissionByName(ctx, permRef)
+	}
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return nil, nil, false
+	}
+	if p == nil {
+		c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "permission not found"})
+		return nil, nil, false
+	}
+	return r, p, true
+}
+
+// ListRolePermissionsService
+// @Summary List a role's permissions
+// @Tags Roles
+// @Description Permissions granted directly to the role. With effective=true, the names the role actually holds (inherited included).
+// @Produce json
+// @Param id path string true "Role ID"
+// @Param effective query bool false "Include inherited permissions"
+// @Success 200 {array} model.Permission
+// @Failure 404 {object} map[string]string
+// @Security Bearer
+// @Router /roles/{id}/permissions [get]
+func ListRolePermissionsService(c *fiber.Ctx) error {
+	ctx := context.Background()
+	r, err := repository.GetRoleByID(ctx, c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if r == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role not found"})
+	}
+	if c.QueryBool("effective") {
+		names, version, err := repository.LoadRolePermissions(ctx, r.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"role": r.Name, "perm_version": version, "permissions": names})
+	}
+	perms, err := repository.ListRolePermissionDetails(ctx, r.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(perms)
+}
+
+// GrantRolePermissionService
+// @Summary Grant permission to role
+// @Tags Roles
+// @Description Grant a permission (by id or name) to a role. Idempotent.
+// @Accept json
+// @Produce json
+// @Param id path string true "Role ID"
+// @Param body body object true "Permission" example({"permission":"achievements.verify"})
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security Bearer
+// @Router /roles/{id}/permissions [post]
+func GrantRolePermissionService(c *fiber.Ctx) error {
+	var body struct {
+		Permission string `json:"permission"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.Permission == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "permission required"})
+	}
+	ctx := context.Background()
+	r, p, ok := roleAndPermission(c, ctx, body.Permission)
+	if !ok {
+		return nil
+	}
+	if err := grantRolePermission(ctx, r.ID, p.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "permission granted", "permission": p.Name})
+}
+
+// RevokeRolePermissionService
+// @Summary Revoke permission from role
+// @Tags Roles
+// @Param id path string true "Role ID"
+// @Param permId path string true "Permission ID or name"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security Bearer
+// @Router /roles/{id}/permissions/{permId} [delete]
+func RevokeRolePermissionService(c *fiber.Ctx) error {
+	ctx := context.Background()
+	r, p, ok := roleAndPermission(c, ctx, c.Params("permId"))
+	if !ok {
+		return nil
+	}
+	if err := revokeRolePermission(ctx, r.ID, p.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "permission revoked", "permission": p.Name})
+}
+
+// grantRolePermission adds a permission to a role. The repository bumps the
+// perm_version of the role and its heirs so tokens issued before the change
+// stop being trusted.
+func grantRolePermission(ctx context.Context, roleID, permissionID string) error {
+	bumped, err := repository.AssignPermissionToRole(ctx, roleID, permissionID)
+	if err != nil {
+		return err
+	}
+	invalidateRoles(bumped)
+	return nil
+}
+
+// revokeRolePermission removes a permission from a role (bumps perm_version).
+func revokeRolePermission(ctx context.Context, roleID, permissionID string) error {
+	bumped, err := repository.RevokePermissionFromRole(ctx, roleID, permissionID)
+	if err != nil {
+		return err
+	}
+	invalidateRoles(bumped)
+	return nil
+}
+
+// ListRoleParentsService
+// @Summary List inherited roles
+// @Tags Roles
+// @Description Roles this role inherits permissions from (direct parents only).
+// @Produce json
+// @Param id path string true "Role ID"
+// @Success 200 {array} model.Role
+// @Failure 404 {object} map[string]string
+// @Security Bearer
+// @Router /roles/{id}/parents [get]
+func ListRoleParentsService(c *fiber.Ctx) error {
+	ctx := context.Background()
+	r, err := repository.GetRoleByID(ctx, c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if r == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role not found"})
+	}
+	parents, err := repository.ListRoleParents(ctx, r.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(parents)
+}
+
+// AddRoleParentService
+// @Summary Inherit from role
+// @Tags Roles
+// @Description Make the role inherit every permission of another role. Cycles are rejected.
+// @Accept json
+// @Produce json
+// @Param id path string true "Role ID"
+// @Param body body object true "Parent role" example({"roleId":"..."})
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Security Bearer
+// @Router /roles/{id}/parents [post]
+func AddRoleParentService(c *fiber.Ctx) error {
+	var body struct {
+		RoleID string `json:"roleId"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.RoleID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "roleId required"})
+	}
+	ctx := context.Background()
+	r, err := repository.GetRoleByID(ctx, c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if r == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role not found"})
+	}
+	parent, err := repository.GetRoleByID(ctx, body.RoleID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if parent == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "parent role not found"})
+	}
+	bumped, err := repository.AddRoleParent(ctx, r.ID, parent.ID)
+	if errors.Is(err, repository.ErrRoleCycle) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "role " + parent.Name + " already inherits from " + r.Name})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	invalidateRoles(bumped)
+	return c.JSON(fiber.Map{"message": "role now inherits " + parent.Name})
+}
+
+// RemoveRoleParentService
+// @Summary Stop inheriting from role
+// @Tags Roles
+// @Param id path string true "Role ID"
+// @Param parentId path string true "Parent role ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security Bearer
+// @Router /roles/{id}/parents/{parentId} [delete]
+func RemoveRoleParentService(c *fiber.Ctx) error {
+	bumped, err := repository.RemoveRoleParent(context.Background(), c.Params("id"), c.Params("parentId"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(bumped) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role does not inherit from that role"})
+	}
+	invalidateRoles(bumped)
+	return c.JSON(fiber.Map{"message": "inheritance removed"})
+}
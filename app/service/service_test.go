@@ -1,13 +1,64 @@
 package service
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"clean-arch/app/model"
+	"clean-arch/config"
+	"clean-arch/database"
+	"clean-arch/middleware"
+
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// mockPostgres swaps database.PostgresDB for a sqlmock for the test.
+// Expectations are matched in order against regexps of the SQL.
+func mockPostgres(t *testing.T) sqlmock.Sqlmock {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	prev := database.PostgresDB
+	database.PostgresDB = db
+	t.Cleanup(func() {
+		database.PostgresDB = prev
+		db.Close()
+	})
+	return mock
+}
+
+// referenceRows is the row set GetAchievementReference* scan.
+func referenceRows(refs ...model.AchievementReference) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "student_id", "mongo_achievement_id", "status", "submitted_at",
+		"verified_at", "verified_by", "rejection_note", "verified_version", "created_at", "updated_at"})
+	for _, r := range refs {
+		rows.AddRow(r.ID, r.StudentID, r.MongoAchievementID, r.Status, r.SubmittedAt,
+			r.VerifiedAt, r.VerifiedBy, r.RejectionNote, r.VerifiedVersion, r.CreatedAt, r.UpdatedAt)
+	}
+	return rows
+}
+
+// asSubject presets the policy subject so handlers skip the role/student lookup.
+func asSubject(s *middleware.Subject) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals(middleware.LocalsUserID, s.UserID)
+		c.Locals(middleware.LocalsSubject, s)
+		return c.Next()
+	}
+}
+
+func initTestSigningKeys(t *testing.T) {
+	require.NoError(t, middleware.InitSigningKeys(&config.Env{JWTSecret: "test-secret"}))
+}
+
 // ==========================
 // STUDENT REPORT
 // ==========================
@@ -95,3 +146,460 @@ func TestCreateStudent_InvalidBody(t *testing.T) {
 
 	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
 }
+
+// ==========================
+// REFRESH TOKEN
+// ==========================
+
+func TestRefreshToken_MissingToken(t *testing.T) {
+	app := fiber.New()
+
+	app.Post("/auth/refresh", RefreshTokenService)
+
+	req := httptest.NewRequest("POST", "/auth/refresh", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, _ := app.Test(req)
+
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+}
+
+func TestChangePassword_NewTokenWorksImmediately(t *testing.T) {
+	initTestSigningKeys(t)
+	mock := mockPostgres(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte("Lama#Sandi2026"), bcrypt.MinCost)
+	require.NoError(t, err)
+	now := time.Now()
+
+	mock.ExpectQuery(`FROM users WHERE id=\$1`).WithArgs("u-1").WillReturnRows(sqlmock.NewRows(
+		[]string{"id", "username", "email", "password_hash", "full_name", "role_id", "is_active", "is_service_account", "created_at", "updated_at"}).
+		AddRow("u-1", "budi", "budi@kampus.ac.id", string(hash), "Budi", "r-1", true, false, now, now))
+	mock.ExpectExec(`UPDATE users SET password_hash`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO user_token_cutoffs`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`SELECT pg_notify`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE user_sessions SET revoked_at`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE refresh_tokens SET revoked_at`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO user_sessions`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT perm_version FROM roles`).WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(`INSERT INTO refresh_tokens`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE user_sessions SET last_seen_at`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	app := fiber.New()
+	app.Put("/auth/password", func(c *fiber.Ctx) error {
+		c.Locals(middleware.LocalsUserID, "u-1")
+		return ChangePasswordService(c)
+	})
+	app.Get("/profile", middleware.JWTMiddleware(), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	req := httptest.NewRequest("PUT", "/auth/password", strings.NewReader(`{"current_password":"Lama#Sandi2026","new_password":"Baru#Sandi2026x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	// no timeout: the new password is hashed at the full bcrypt cost
+	resp, err := app.Test(req, -1)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var out struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+
+	// same second as the revocation cutoff: the fresh token must still work
+	req = httptest.NewRequest("GET", "/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+out.Token)
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	// the session touch runs in the background
+	assert.Eventually(t, func() bool { return mock.ExpectationsWereMet() == nil }, time.Second, 10*time.Millisecond)
+}
+
+func TestHashToken_Deterministic(t *testing.T) {
+	raw, err := newOpaqueToken()
+	assert.NoError(t, err)
+	assert.Equal(t, hashToken(raw), hashToken(raw))
+	assert.Len(t, hashToken(raw), 64)
+}
+
+// ==========================
+// PASSWORD RESET
+// ==========================
+
+func TestForgotPassword_MissingEmail(t *testing.T) {
+	app := fiber.New()
+
+	app.Post("/auth/forgot-password", ForgotPasswordService)
+
+	req := httptest.NewRequest("POST", "/auth/forgot-password", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, _ := app.Test(req)
+
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+}
+
+func TestResetPassword_MissingFields(t *testing.T) {
+	app := fiber.New()
+
+	app.Post("/auth/reset-password", ResetPasswordService)
+
+	req := httptest.NewRequest("POST", "/auth/reset-password", strings.NewReader(`{"token":"abc"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, _ := app.Test(req)
+
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+}
+
+func TestCreateUser_WeakPassword(t *testing.T) {
+	app := fiber.New()
+
+	app.Post("/users", CreateUserService)
+
+	req := httptest.NewRequest("POST", "/users", strings.NewReader(`{"username":"budi","email":"budi@kampus.ac.id","password":"123456"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, _ := app.Test(req)
+
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+}
+
+func TestMFAVerify_MissingCode(t *testing.T) {
+	app := fiber.New()
+
+	app.Post("/auth/mfa/verify", MFAVerifyService)
+
+	req := httptest.NewRequest("POST", "/auth/mfa/verify", strings.NewReader(`{"mfa_token":"abc"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, _ := app.Test(req)
+
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+}
+
+// expectMFAPendingUser expects the user and lockout lookups that precede the
+// pending token claim in MFAVerifyService.
+func expectMFAPendingUser(mock sqlmock.Sqlmock) {
+	now := time.Now()
+	mock.ExpectQuery(`FROM users WHERE id=`).WithArgs("u-1").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "username", "email", "password_hash", "full_name", "role_id",
+			"is_active", "is_service_account", "created_at", "updated_at"}).
+			AddRow("u-1", "budi", "budi@example.com", "x", "Budi", "r-1", true, false, now, now))
+	mock.ExpectQuery(`FROM login_attempts`).WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+}
+
+// postMFAVerify sends a fresh pending token for user u-1 with a code that can
+// never match (TOTP codes are digits only).
+func postMFAVerify(t *testing.T) int {
+	initTestSigningKeys(t)
+	pending, err := generateMFAPendingToken("u-1")
+	require.NoError(t, err)
+
+	app := fiber.New()
+	app.Post("/auth/mfa/verify", MFAVerifyService)
+	req := httptest.NewRequest("POST", "/auth/mfa/verify", strings.NewReader(`{"mfa_token":"`+pending+`","code":"abcdef"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp.StatusCode
+}
+
+func TestMFAVerify_ClaimedTokenRefusedBeforeCodeCheck(t *testing.T) {
+	mock := mockPostgres(t)
+	expectMFAPendingUser(mock)
+	// a concurrent request already took the pending token
+	mock.ExpectExec(`INSERT INTO revoked_tokens`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Equal(t, fiber.StatusUnauthorized, postMFAVerify(t))
+	// the code was never looked at (no user_mfa query)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMFAVerify_WrongCodeReleasesClaim(t *testing.T) {
+	mock := mockPostgres(t)
+	expectMFAPendingUser(mock)
+	mock.ExpectExec(`INSERT INTO revoked_tokens`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`FROM user_mfa WHERE user_id`).WithArgs("u-1").WillReturnRows(
+		sqlmock.NewRows([]string{"user_id", "secret", "enabled", "last_used_step", "created_at", "enabled_at"}).
+			AddRow("u-1", "JBSWY3DPEHPK3PXP", true, 0, time.Now(), time.Now()))
+	mock.ExpectExec(`DELETE FROM revoked_tokens WHERE jti`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO login_attempts`).WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(1))
+	mock.ExpectQuery(`INSERT INTO login_attempts`).WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(1))
+
+	assert.Equal(t, fiber.StatusUnauthorized, postMFAVerify(t))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRecoveryCodes_Normalized(t *testing.T) {
+	codes, hashes, err := newRecoveryCodes()
+	assert.NoError(t, err)
+	assert.Len(t, codes, recoveryCodeCount)
+	assert.Equal(t, hashes[0], hashToken(normalizeRecoveryCode(" "+strings.ToUpper(codes[0])+" ")))
+}
+
+func TestCreateAPIToken_RejectedForAPITokenCaller(t *testing.T) {
+	app := fiber.New()
+
+	app.Post("/auth/tokens", func(c *fiber.Ctx) error {
+		c.Locals(middleware.LocalsUserID, "user-1")
+		c.Locals(middleware.LocalsAPITokenID, "tok-1")
+		return CreateMyAPITokenService(c)
+	})
+
+	req := httptest.NewRequest("POST", "/auth/tokens", strings.NewReader(`{"name":"x","permissions":["reports.read"]}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, _ := app.Test(req)
+
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+}
+
+func TestCreateUser_InviteRejectsPassword(t *testing.T) {
+	app := fiber.New()
+
+	app.Post("/users", CreateUserService)
+
+	req := httptest.NewRequest("POST", "/users", strings.NewReader(`{"username":"budi","email":"budi@kampus.ac.id","password":"Rahasia123","invite":true}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, _ := app.Test(req)
+
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+}
+
+func TestAcceptInvitation_MissingFields(t *testing.T) {
+	app := fiber.New()
+
+	app.Post("/auth/accept-invitation", AcceptInvitationService)
+
+	req := httptest.NewRequest("POST", "/auth/accept-invitation", strings.NewReader(`{"token":"abc"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, _ := app.Test(req)
+
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+}
+
+func TestInviteUser_RemovesUserWhenInvitationFails(t *testing.T) {
+	mock := mockPostgres(t)
+	mock.ExpectExec(`INSERT INTO users`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin().WillReturnError(sql.ErrConnDone)
+	mock.ExpectExec(`DELETE FROM users WHERE id`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	_, _, _, err := inviteUser(context.Background(), "2101001", "a@kampus.ac.id", "A", "r-1", "u-admin")
+	assert.ErrorIs(t, err, sql.ErrConnDone)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestParsePermissionName(t *testing.T) {
+	res, act, ok := parsePermissionName("achievements.verify")
+	assert.True(t, ok)
+	assert.Equal(t, "achievements", res)
+	assert.Equal(t, "verify", act)
+
+	_, _, ok = parsePermissionName("*")
+	assert.True(t, ok)
+
+	for _, bad := range []string{"", "achievements", ".verify", "achievements.", "a b.c"} {
+		_, _, ok := parsePermissionName(bad)
+		assert.False(t, ok, bad)
+	}
+}
+
+func TestPermissionSyncMismatches(t *testing.T) {
+	report := &PermissionSyncReport{Created: []string{"achievments.read"}, Ungranted: []string{"achievments.read"}}
+	// a misspelt route permission is created but nobody holds it
+	assert.Len(t, report.Mismatches(true), 1)
+	assert.Empty(t, report.Mismatches(false))
+}
+
+func TestCreatePermission_InvalidName(t *testing.T) {
+	app := fiber.New()
+
+	app.Post("/permissions", CreatePermissionService)
+
+	req := httptest.NewRequest("POST", "/permissions", strings.NewReader(`{"name":"reports"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, _ := app.Test(req)
+
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+}
+
+func TestCreateRole_EmptyName(t *testing.T) {
+	app := fiber.New()
+
+	app.Post("/roles", CreateRoleService)
+
+	req := httptest.NewRequest("POST", "/roles", strings.NewReader(`{"name":"   "}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, _ := app.Test(req)
+
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+}
+
+func TestIsSystemRole(t *testing.T) {
+	assert.True(t, isSystemRole("admin"))
+	assert.True(t, isSystemRole("Dosen_Wali"))
+	assert.False(t, isSystemRole("role-lab"))
+}
+
+func TestRequestRevision_RequiresKeyedComments(t *testing.T) {
+	app := fiber.New()
+	app.Post("/achievements/:id/request-revision", func(c *fiber.Ctx) error {
+		return RequestRevisionService(c, nil)
+	})
+
+	for _, body := range []string{
+		`{"comments":[]}`,
+		`{"comments":[{"comment":"fix it"}]}`,
+		`{"comments":[{"field":"title","attachmentId":"att-1","comment":"fix it"}]}`,
+		`{"comments":[{"field":"studentId","comment":"fix it"}]}`,
+		`{"comments":[{"field":"title","comment":"  "}]}`,
+	} {
+		req := httptest.NewRequest("POST", "/achievements/abc/request-revision", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, _ := app.Test(req)
+		assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode, body)
+	}
+}
+
+func TestIsReviewableField(t *testing.T) {
+	assert.True(t, isReviewableField("title"))
+	assert.True(t, isReviewableField("details.rank"))
+	assert.False(t, isReviewableField("details."))
+	assert.False(t, isReviewableField("studentId"))
+}
+
+func TestAchievementHistory_ReturnsEventArray(t *testing.T) {
+	mock := mockPostgres(t)
+	now := time.Now()
+	ref := model.AchievementReference{ID: "ref-1", StudentID: "s-1", MongoAchievementID: "m-1", Status: model.StatusSubmitted, UpdatedAt: now}
+	mock.ExpectQuery(`FROM achievement_references WHERE mongo_achievement_id`).WillReturnRows(referenceRows(ref))
+	mock.ExpectQuery(`FROM achievement_references WHERE mongo_achievement_id`).WillReturnRows(referenceRows(ref))
+	mock.ExpectQuery(`FROM achievement_status_events`).WithArgs("ref-1").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "reference_id", "from_status", "to_status", "actor_id", "full_name", "note", "created_at"}).
+			AddRow("e-1", "ref-1", nil, model.StatusDraft, "u-1", "Budi", nil, now).
+			AddRow("e-2", "ref-1", model.StatusDraft, model.StatusSubmitted, "u-1", "Budi", nil, now))
+
+	app := fiber.New()
+	app.Get("/achievements/:id/history", asSubject(&middleware.Subject{UserID: "u-admin", Admin: true}), func(c *fiber.Ctx) error {
+		return GetAchievementHistoryService(c, nil)
+	})
+	resp, err := app.Test(httptest.NewRequest("GET", "/achievements/m-1/history", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	// a plain array, as before the events table existed
+	var events []model.AchievementStatusEvent
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&events))
+	require.Len(t, events, 2)
+	assert.Equal(t, model.StatusSubmitted, events[1].ToStatus)
+	assert.Equal(t, model.StatusDraft, events[1].FromStatus)
+	assert.Equal(t, "Budi", events[1].ActorName)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStatusTimeline(t *testing.T) {
+	note := "bukti kurang"
+	verifier := "u-lecturer"
+	ref := &model.AchievementReference{
+		ID:            "ref-1",
+		Status:        model.StatusRejected,
+		VerifiedBy:    &verifier,
+		RejectionNote: &note,
+		UpdatedAt:     time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC),
+	}
+
+	// no history rows: the current state stands in as the only event
+	events := statusTimeline(ref, nil)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "ref-1", events[0].ReferenceID)
+	assert.Equal(t, model.StatusRejected, events[0].ToStatus)
+	assert.Empty(t, events[0].FromStatus)
+	assert.Equal(t, &verifier, events[0].ActorID)
+	assert.Equal(t, &note, events[0].Note)
+	assert.Equal(t, ref.UpdatedAt, events[0].CreatedAt)
+
+	// recorded history is returned as is
+	recorded := []model.AchievementStatusEvent{
+		{ReferenceID: "ref-1", ToStatus: model.StatusDraft},
+		{ReferenceID: "ref-1", FromStatus: model.StatusDraft, ToStatus: model.StatusSubmitted},
+	}
+	assert.Equal(t, recorded, statusTimeline(ref, recorded))
+}
+
+func TestDiffAchievements(t *testing.T) {
+	from := model.Achievement{
+		Title:   "Juara 2",
+		Details: map[string]interface{}{"rank": 2, "event": "Gemastik"},
+		Tags:    []string{"lomba"},
+	}
+	to := model.Achievement{
+		Title:   "Juara 1",
+		Details: map[string]interface{}{"rank": 1, "event": "Gemastik", "level": "nasional"},
+		Tags:    []string{"lomba"},
+	}
+	to.UpdatedAt = from.UpdatedAt.Add(time.Hour)
+
+	changes := diffAchievements(from, to)
+	fields := []string{}
+	for _, ch := range changes {
+		fields = append(fields, ch.Field)
+	}
+	assert.Equal(t, []string{"details.level", "details.rank", "title"}, fields)
+	assert.Equal(t, "Juara 2", changes[2].From)
+	assert.Nil(t, changes[0].From)
+}
+
+func TestParseAchievementEdit(t *testing.T) {
+	set, bad := parseAchievementEdit([]byte(`{"title":"  Juara 1 ","tags":["lomba","lomba"," "]}`), studentEditableFields)
+	assert.Nil(t, bad)
+	assert.Equal(t, "Juara 1", set["title"])
+	assert.Equal(t, []string{"lomba"}, set["tags"])
+
+	// points, owner and soft-delete marker are not student-editable
+	_, bad = parseAchievementEdit([]byte(`{"title":"x","points":50,"studentId":"s-2","deletedAt":null}`), studentEditableFields)
+	assert.Equal(t, []string{"deletedAt", "points", "studentId"}, bad["fields"])
+
+	_, bad = parseAchievementEdit([]byte(`{"tags":"lomba"}`), studentEditableFields)
+	assert.NotNil(t, bad)
+
+	_, bad = parseAchievementEdit([]byte(`{}`), studentEditableFields)
+	assert.NotNil(t, bad)
+
+	set, bad = parseAchievementEdit([]byte(`{"points":30,"achievementType":"competition"}`), overrideEditableFields)
+	assert.Nil(t, bad)
+	assert.Equal(t, 30, set["points"])
+}
+
+func TestPreviewAchievementEdit(t *testing.T) {
+	before := model.Achievement{StudentID: "s-1", Title: "Juara 2", Tags: []string{"lomba"}}
+	set, bad := parseAchievementEdit([]byte(`{"points":30,"title":"Juara 1"}`), overrideEditableFields)
+	assert.Nil(t, bad)
+
+	after, err := previewAchievementEdit(before, set)
+	assert.NoError(t, err)
+	assert.Equal(t, "s-1", after.StudentID)
+	assert.Equal(t, []string{"lomba"}, after.Tags)
+
+	fields := []string{}
+	for _, ch := range diffAchievements(before, after) {
+		fields = append(fields, ch.Field)
+	}
+	assert.Equal(t, []string{"points", "title"}, fields)
+}
+
+func TestUpdateAchievement_RejectsPoints(t *testing.T) {
+	app := fiber.New()
+	app.Put("/achievements/:id", func(c *fiber.Ctx) error {
+		return UpdateAchievementService(c, nil)
+	})
+
+	req := httptest.NewRequest("PUT", "/achievements/abc", strings.NewReader(`{"points":100}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, _ := app.Test(req)
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+}
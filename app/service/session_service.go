@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"clean-arch/app/model"
+	"clean-arch/app/repository"
+	"clean-arch/config"
+	"clean-arch/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// user agents are stored as sent, up to this many bytes
+const maxUserAgentLen = 512
+
+// startSession records a new login for the request's device and returns its id.
+func startSession(c *fiber.Ctx, ctx context.Context, userID string) (string, error) {
+	ua := c.Get(fiber.HeaderUserAgent)
+	if len(ua) > maxUserAgentLen {
+		ua = ua[:maxUserAgentLen]
+	}
+	s := &model.UserSession{UserID: userID, UserAgent: ua, IP: middleware.ClientIP(c)}
+	if err := repository.CreateSession(ctx, s); err != nil {
+		return "", err
+	}
+	return s.ID, nil
+}
+
+// revokeSession ends a session of the user: its access tokens are refused
+// from now on and its refresh token family is revoked.
+func revokeSession(ctx context.Context, userID, sid string) (bool, error) {
+	if _, err := uuid.Parse(sid); err != nil {
+		return false, nil
+	}
+	ok, err := middleware.RevokeSession(ctx, userID, sid)
+	if err != nil || !ok {
+		return ok, err
+	}
+	return true, repository.RevokeRefreshTokenFamily(ctx, sid)
+}
+
+// listSessions returns the user's live sessions; sessions idle for longer
+// than the refresh token lifetime cannot be resumed and are left out.
+func listSessions(ctx context.Context, userID, currentSID string) ([]model.UserSession, error) {
+	hours := config.LoadEnv().RefreshExpiresHours
+	if hours <= 0 {
+		hours = 720
+	}
+	sessions, err := repository.ListUserSessions(ctx, userID, time.Now().Add(-time.Duration(hours)*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSID
+	}
+	return sessions, nil
+}
+
+// ListMySessionsService
+// @Summary List own sessions
+// @Tags Auth
+// @Description Devices the caller is logged in on (user agent, ip, created and last-seen time).
+// @Produce json
+// @Success 200 {array} model.UserSession
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security Bearer
+// @Router /auth/sessions [get]
+func ListMySessionsService(c *fiber.Ctx) error {
+	uid, _ := c.Locals(middleware.LocalsUserID).(string)
+	if uid == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthenticated"})
+	}
+	sid, _ := c.Locals(middleware.LocalsSessionID).(string)
+	sessions, err := listSessions(context.Background(), uid, sid)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(sessions)
+}
+
+// RevokeMySessionService
+// @Summary Revoke own session
+// @Tags Auth
+// @Description Log out one of the caller's devices.
+// @Param id path string true "Session ID"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security Bearer
+// @Router /auth/sessions/{id} [delete]
+func RevokeMySessionService(c *fiber.Ctx) error {
+	uid, _ := c.Locals(middleware.LocalsUserID).(string)
+	if uid == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthenticated"})
+	}
+	ok, err := revokeSession(context.Background(), uid, c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+	}
+	return c.JSON(fiber.Map{"message": "session revoked"})
+}
+
+// ListUserSessionsService
+// @Summary List a user's sessions
+// @Tags Users
+// @Description Live sessions of any user (admin).
+// @Param id path string true "User ID"
+// @Success 200 {array} model.UserSession
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security Bearer
+// @Router /users/{id}/sessions [get]
+func ListUserSessionsService(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "id required"})
+	}
+	ctx := context.Background()
+	u, err := repository.GetUserByID(ctx, id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if u == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+	}
+	sid, _ := c.Locals(middleware.LocalsSessionID).(string)
+	sessions, err := listSessions(ctx, u.ID, sid)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(sessions)
+}
+
+// RevokeUserSessionService
+// @Summary Revoke a user's session
+// @Tags Users
+// @Description End one session of any user, e.g. a compromised device (admin).
+// @Param id path string true "User ID"
+// @Param sid path string true "Session ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security Bearer
+// @Router /users/{id}/sessions/{sid} [delete]
+func RevokeUserSessionService(c *fiber.Ctx) error {
+	ok, err := revokeSession(context.Background(), c.Params("id"), c.Params("sid"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+	}
+	return c.JSON(fiber.Map{"message": "session revoked"})
+}
+
+// RevokeAllUserSessionsService
+// @Summary Revoke all sessions of a user
+// @Tags Users
+// @Description Log a user out everywhere (admin).
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security Bearer
+// @Router /users/{id}/sessions [delete]
+func RevokeAllUserSessionsService(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "id required"})
+	}
+	ctx := context.Background()
+	u, err := repository.GetUserByID(ctx, id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if u == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+	}
+	if err := revokeUserSessions(ctx, u.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "all sessions revoked"})
+}
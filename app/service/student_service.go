@@ -7,6 +7,7 @@ import (
 	"clean-arch/app/model"
 	"clean-arch/app/repository"
 	"clean-arch/database"
+	"clean-arch/middleware"
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
@@ -96,6 +97,9 @@ func GetStudentAchievementsService(c *fiber.Ctx) error {
 	if studentID == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "student id required"})
 	}
+	if !authorizeAchievement(c, middleware.ActionView, studentID) {
+		return nil
+	}
 	q := `SELECT mongo_achievement_id FROM achievement_references WHERE student_id=$1`
 	rows, err := database.PostgresDB.QueryContext(context.Background(), q, studentID)
 	if err != nil {
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RFC 6238 appendix B, SHA1 seed, truncated to 6 digits
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for ts, want := range vectors {
+		got, err := totpCode(secret, ts/totpPeriod)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, "t=%d", ts)
+	}
+}
+
+func TestVerifyTOTP_AcceptsDriftOnly(t *testing.T) {
+	secret, err := newTOTPSecret()
+	require.NoError(t, err)
+	now := time.Unix(1700000000, 0)
+
+	prev, _ := totpCode(secret, now.Unix()/totpPeriod-1)
+	step, ok := verifyTOTP(secret, prev, now)
+	assert.True(t, ok)
+	assert.Equal(t, now.Unix()/totpPeriod-1, step)
+
+	old, _ := totpCode(secret, now.Unix()/totpPeriod-3)
+	_, ok = verifyTOTP(secret, old, now)
+	assert.False(t, ok)
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := totpProvisioningURI("Prestasi", "budi@kampus.ac.id", "ABC")
+	assert.Equal(t, "otpauth://totp/Prestasi:budi@kampus.ac.id?algorithm=SHA1&digits=6&issuer=Prestasi&period=30&secret=ABC", uri)
+}
@@ -6,6 +6,7 @@ import (
 
 	"clean-arch/app/model"
 	"clean-arch/app/repository"
+	"clean-arch/middleware"
 	"github.com/gofiber/fiber/v2"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -13,11 +14,11 @@ import (
 // CreateUserService
 // @Summary Create user (admin)
 // @Tags Users
-// @Description Create a new user (admin only).
+// @Description Create a new user (admin only). With "invite": true no password is given: the user is created pending and receives an activation link.
 // @Accept json
 // @Produce json
 // @Param body body object true "User body" example({"username":"newuser","email":"a@b.com","password":"secret","fullName":"New User","roleId":"role-mahasiswa"})
-// @Success 201 {object} map[string]string
+// @Success 201 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Security Bearer
@@ -29,6 +30,7 @@ func CreateUserService(c *fiber.Ctx) error {
 		Password string `json:"password"`
 		FullName string `json:"fullName"`
 		RoleID   string `json:"roleId"`
+		Invite   bool   `json:"invite"`
 	}
 
 	if err := c.BodyParser(&body); err != nil {
@@ -36,11 +38,19 @@ func CreateUserService(c *fiber.Ctx) error {
 			JSON(fiber.Map{"error": err.Error()})
 	}
 
+	if body.Invite {
+		return createInvitedUser(c, body.Username, body.Email, body.Password, body.FullName, body.RoleID)
+	}
+
 	if body.Username == "" || body.Email == "" || body.Password == "" {
 		return c.Status(fiber.StatusBadRequest).
 			JSON(fiber.Map{"error": "username, email, password required"})
 	}
 
+	if problems := currentPasswordPolicy().Validate(body.Password, body.Username, body.Email); len(problems) > 0 {
+		return passwordPolicyError(c, problems)
+	}
+
 	hashed, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).
@@ -65,6 +75,35 @@ func CreateUserService(c *fiber.Ctx) error {
 		JSON(fiber.Map{"userId": user.ID})
 }
 
+// createInvitedUser is CreateUserService's "invite" branch: the admin picks
+// no password, the user sets one through the emailed link.
+func createInvitedUser(c *fiber.Ctx, username, email, password, fullName, roleID string) error {
+	if username == "" || email == "" {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "username, email required"})
+	}
+	if password != "" {
+		return c.Status(fiber.StatusBadRequest).
+			JSON(fiber.Map{"error": "password must be empty when inviting"})
+	}
+
+	createdBy, _ := c.Locals(middleware.LocalsUserID).(string)
+	user, inv, mailSent, err := inviteUser(context.Background(), username, email, fullName, roleID, createdBy)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).
+			JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(fiber.StatusCreated).
+		JSON(fiber.Map{
+			"userId": user.ID,
+			"invitation": fiber.Map{
+				"expires_at": inv.ExpiresAt,
+				"mail_sent":  mailSent,
+			},
+		})
+}
+
 // GetUserByIDService
 // @Summary Get user by id
 // @Tags Users
@@ -176,16 +215,30 @@ func UpdateUserService(c *fiber.Ctx) error {
 	if payload.FullName != "" {
 		u.FullName = payload.FullName
 	}
+	roleChanged := false
 	if payload.RoleID != "" {
+		roleChanged = payload.RoleID != u.RoleID
 		u.RoleID = payload.RoleID
 	}
+	deactivated := false
 	if payload.IsActive != nil {
+		deactivated = u.IsActive && !*payload.IsActive
 		u.IsActive = *payload.IsActive
 	}
 	u.UpdatedAt = time.Now()
 	if err := repository.UpdateUser(context.Background(), u); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
+	// deactivation must end live sessions right away, not at token expiry
+	if deactivated {
+		if err := revokeUserSessions(context.Background(), u.ID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+	} else if roleChanged {
+		if err := middleware.RevokeUserTokens(context.Background(), u.ID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
 	return c.JSON(fiber.Map{"message": "updated"})
 }
 
@@ -208,10 +261,47 @@ func AssignRoleService(c *fiber.Ctx) error {
 	if u == nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
 	}
+	roleChanged := u.RoleID != body.RoleID
 	u.RoleID = body.RoleID
 	u.UpdatedAt = time.Now()
 	if err := repository.UpdateUser(context.Background(), u); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
+	// access tokens carry role_id; force a refresh so the new role is picked up
+	if roleChanged {
+		if err := middleware.RevokeUserTokens(context.Background(), u.ID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
 	return c.JSON(fiber.Map{"message": "role updated"})
 }
+
+// UnlockUserService
+// @Summary Unlock user login
+// @Tags Users
+// @Description Clear failed-login counters and lockout for a user's username and email (admin).
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Security Bearer
+// @Router /users/{id}/unlock [post]
+func UnlockUserService(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "id required"})
+	}
+	u, err := repository.GetUserByID(context.Background(), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	if u == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+	}
+	keys := []string{identifierKey(u.Username), identifierKey(u.Email)}
+	if err := repository.ClearLoginAttempts(context.Background(), keys); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "user unlocked"})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	svc "clean-arch/app/service"
+	"clean-arch/route"
+)
+
+const permissionsUsage = `usage: permissions <command>
+  list    print every route with its required permission
+  sync    insert permissions required by routes but missing from the table
+  check   compare without writing; exit 1 on any mismatch (CI / deploy gate)`
+
+// runPermissionsCommand implements "permissions <command>" and returns the
+// process exit code.
+func runPermissionsCommand(ctx context.Context, args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, permissionsUsage)
+		return 2
+	}
+	endpoints := route.Manifest()
+
+	var mode string
+	switch args[0] {
+	case "list":
+		return printJSON(endpoints)
+	case "sync":
+		mode = svc.PermissionSyncUpsert
+	case "check":
+		mode = svc.PermissionSyncCheck
+	default:
+		fmt.Fprintln(os.Stderr, permissionsUsage)
+		return 2
+	}
+
+	report, err := svc.CheckPermissions(ctx, endpoints, mode)
+	if report != nil {
+		printJSON(report)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func printJSON(v interface{}) int {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
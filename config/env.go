@@ -13,8 +13,11 @@ import (
 type Env struct {
 	AppPort string
 
-	JWTSecret       string
-	JWTExpiresHours int
+	JWTSecret           string
+	JWTKeysDir          string
+	JWTActiveKID        string
+	JWTExpiresHours     int
+	RefreshExpiresHours int
 
 	PGHost     string
 	PGPort     string
@@ -25,6 +28,84 @@ type Env struct {
 
 	MongoURI string
 	MongoDB  string
+
+	// outgoing mail: MAIL_DRIVER is "smtp" or "outbox" (writes .eml files)
+	MailDriver    string
+	MailFrom      string
+	MailOutboxDir string
+	SMTPHost      string
+	SMTPPort      string
+	SMTPUsername  string
+	SMTPPassword  string
+
+	PasswordResetURL        string
+	PasswordResetTTLMinutes int
+
+	// password policy: PASSWORD_REQUIRE_CLASSES is a comma list of
+	// lower, upper, digit, symbol; PASSWORD_BANNED_FILE has one password per line
+	PasswordMinLength      int
+	PasswordRequireClasses string
+	PasswordBannedFile     string
+
+	// login throttling: after N failures the key is locked for
+	// base * 2^(failures-N) seconds, capped at max
+	LoginMaxAttempts      int
+	LoginMaxAttemptsPerIP int
+	LoginLockoutBaseSecs  int
+	LoginLockoutMaxSecs   int
+
+	// reverse proxies allowed to report the client IP (comma list of IPs or
+	// CIDRs) and the header they append it to; empty = use the socket peer
+	TrustedProxies string
+	ProxyHeader    string
+
+	// issuer shown in authenticator apps for TOTP enrollments
+	MFAIssuer string
+
+	// personal access tokens: lifetime when none is asked for, and the cap
+	APITokenDefaultDays int
+	APITokenMaxDays     int
+
+	// OpenID Connect SSO (disabled while OIDCIssuer is empty).
+	// OIDCGroupRoleMap is "group=role,group=role"; the first matching group wins.
+	OIDCIssuer        string
+	OIDCClientID      string
+	OIDCClientSecret  string
+	OIDCRedirectURL   string
+	OIDCScopes        string
+	OIDCGroupsClaim   string
+	OIDCGroupRoleMap  string
+	OIDCDefaultRole   string
+	OIDCAutoProvision bool
+	// With OIDCTrustIdPMFA an SSO login whose ID token shows a second factor
+	// (an amr value from OIDCMFAAMR, or acr equal to OIDCMFAACR) skips the
+	// local TOTP step; otherwise SSO logins go through it like passwords.
+	OIDCTrustIdPMFA bool
+	OIDCMFAAMR      string
+	OIDCMFAACR      string
+
+	// lifetime of "log in as" tokens (no refresh token is issued)
+	ImpersonationTTLMinutes int
+
+	// invitation (account activation) links
+	InvitationURL      string
+	InvitationTTLHours int
+
+	// startup check of route permissions against the permissions table:
+	// strict (default), upsert, check or off
+	PermissionSync string
+
+	// role permission cache: TTL, shorter TTL while the NOTIFY listener is
+	// down, max cached roles, and whether to listen for change events
+	PermCacheTTLSecs         int
+	PermCacheFallbackTTLSecs int
+	PermCacheMaxEntries      int
+	PermCacheListen          bool
+
+	// token revocations: listen for other instances' events and reload the
+	// store from Postgres every RevocationReloadSecs (0 = never)
+	RevocationListen     bool
+	RevocationReloadSecs int
 }
 
 var (
@@ -39,8 +120,12 @@ func LoadEnv() *Env {
 
 		cfg = &Env{
 			AppPort:         getEnv("APP_PORT", "8080"),
-			JWTSecret:       getEnv("JWT_SECRET", "change-this-secret"),
+			JWTSecret:       getEnv("JWT_SECRET", ""),
+			JWTKeysDir:      getEnv("JWT_KEYS_DIR", ""),
+			JWTActiveKID:    getEnv("JWT_ACTIVE_KID", ""),
 			JWTExpiresHours: getEnvInt("JWT_EXPIRES_HOURS", 24),
+			// refresh tokens default to 30 days
+			RefreshExpiresHours: getEnvInt("REFRESH_EXPIRES_HOURS", 720),
 
 			PGHost:     getEnv("PG_HOST", "localhost"),
 			PGPort:     getEnv("PG_PORT", "5432"),
@@ -51,10 +136,64 @@ func LoadEnv() *Env {
 
 			MongoURI: getEnv("MONGO_URI", "mongodb://localhost:27017"),
 			MongoDB:  getEnv("MONGO_DBNAME", "prestasi_db"),
+
+			MailDriver:    getEnv("MAIL_DRIVER", "outbox"),
+			MailFrom:      getEnv("MAIL_FROM", "no-reply@localhost"),
+			MailOutboxDir: getEnv("MAIL_OUTBOX_DIR", "outbox"),
+			SMTPHost:      getEnv("SMTP_HOST", ""),
+			SMTPPort:      getEnv("SMTP_PORT", "587"),
+			SMTPUsername:  getEnv("SMTP_USERNAME", ""),
+			SMTPPassword:  getEnv("SMTP_PASSWORD", ""),
+
+			PasswordResetURL:        getEnv("PASSWORD_RESET_URL", "http://localhost:3000/reset-password"),
+			PasswordResetTTLMinutes: getEnvInt("PASSWORD_RESET_TTL_MINUTES", 30),
+
+			PasswordMinLength:      getEnvInt("PASSWORD_MIN_LENGTH", 8),
+			PasswordRequireClasses: getEnv("PASSWORD_REQUIRE_CLASSES", "lower,upper,digit"),
+			PasswordBannedFile:     getEnv("PASSWORD_BANNED_FILE", ""),
+
+			LoginMaxAttempts:      getEnvInt("LOGIN_MAX_ATTEMPTS", 5),
+			LoginMaxAttemptsPerIP: getEnvInt("LOGIN_MAX_ATTEMPTS_PER_IP", 20),
+			LoginLockoutBaseSecs:  getEnvInt("LOGIN_LOCKOUT_BASE_SECONDS", 30),
+			LoginLockoutMaxSecs:   getEnvInt("LOGIN_LOCKOUT_MAX_SECONDS", 3600),
+			TrustedProxies:        getEnv("TRUSTED_PROXIES", ""),
+			ProxyHeader:           getEnv("PROXY_HEADER", "X-Forwarded-For"),
+
+			MFAIssuer: getEnv("MFA_ISSUER", "Prestasi Mahasiswa"),
+
+			APITokenDefaultDays: getEnvInt("API_TOKEN_DEFAULT_DAYS", 90),
+			APITokenMaxDays:     getEnvInt("API_TOKEN_MAX_DAYS", 365),
+
+			OIDCIssuer:        getEnv("OIDC_ISSUER", ""),
+			OIDCClientID:      getEnv("OIDC_CLIENT_ID", ""),
+			OIDCClientSecret:  getEnv("OIDC_CLIENT_SECRET", ""),
+			OIDCRedirectURL:   getEnv("OIDC_REDIRECT_URL", "http://localhost:8080/api/v1/auth/oidc/callback"),
+			OIDCScopes:        getEnv("OIDC_SCOPES", "openid,email,profile"),
+			OIDCGroupsClaim:   getEnv("OIDC_GROUPS_CLAIM", "groups"),
+			OIDCGroupRoleMap:  getEnv("OIDC_GROUP_ROLE_MAP", ""),
+			OIDCDefaultRole:   getEnv("OIDC_DEFAULT_ROLE", ""),
+			OIDCAutoProvision: getEnv("OIDC_AUTO_PROVISION", "true") == "true",
+			OIDCTrustIdPMFA:   getEnv("OIDC_TRUST_IDP_MFA", "false") == "true",
+			OIDCMFAAMR:        getEnv("OIDC_MFA_AMR", "mfa,otp"),
+			OIDCMFAACR:        getEnv("OIDC_MFA_ACR", ""),
+
+			ImpersonationTTLMinutes: getEnvInt("IMPERSONATION_TTL_MINUTES", 30),
+
+			InvitationURL:      getEnv("INVITATION_URL", "http://localhost:3000/accept-invitation"),
+			InvitationTTLHours: getEnvInt("INVITATION_TTL_HOURS", 72),
+
+			PermissionSync: getEnv("PERMISSION_SYNC", "strict"),
+
+			PermCacheTTLSecs:         getEnvInt("PERM_CACHE_TTL_SECONDS", 300),
+			PermCacheFallbackTTLSecs: getEnvInt("PERM_CACHE_FALLBACK_TTL_SECONDS", 30),
+			PermCacheMaxEntries:      getEnvInt("PERM_CACHE_MAX_ENTRIES", 1000),
+			PermCacheListen:          getEnv("PERM_CACHE_LISTEN", "true") == "true",
+			RevocationListen:         getEnv("REVOCATION_LISTEN", "true") == "true",
+			RevocationReloadSecs:     getEnvInt("REVOCATION_RELOAD_SECONDS", 60),
 		}
 
-		if cfg.JWTSecret == "" {
-			log.Println("WARNING: JWT_SECRET is empty; change for production")
+		if cfg.JWTSecret == "" && cfg.JWTKeysDir == "" {
+			log.Println("WARNING: neither JWT_KEYS_DIR nor JWT_SECRET is set; change for production")
 		}
 	})
 	return cfg
@@ -7,6 +7,7 @@ import (
 
 	"clean-arch/config"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -45,6 +46,24 @@ func ConnectMongo(ctx context.Context, env *config.Env) error {
 	return nil
 }
 
+// EnsureMongoIndexes creates the indexes the repositories rely on on the
+// global MongoDB.
+func EnsureMongoIndexes(ctx context.Context) error {
+	if MongoDB == nil {
+		return fmt.Errorf("mongo not connected")
+	}
+	// one snapshot per (achievement, version); concurrent writers of the
+	// same version number collide here and retry
+	_, err := MongoDB.Collection("achievement_versions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "achievementId", Value: 1}, {Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("achievement_versions index: %w", err)
+	}
+	return nil
+}
+
 // CloseMongo disconnects the global Mongo client
 func CloseMongo(ctx context.Context) error {
 	if MongoClient == nil {
@@ -21,12 +21,7 @@ func ConnectPostgres(env *config.Env) error {
 		return fmt.Errorf("config env is nil")
 	}
 
-	dsn := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		env.PGHost, env.PGPort, env.PGUser, env.PGPassword, env.PGDatabase, env.PGSSLMode,
-	)
-
-	db, err := sql.Open("postgres", dsn)
+	db, err := sql.Open("postgres", PostgresDSN(env))
 	if err != nil {
 		return err
 	}
@@ -46,6 +41,14 @@ func ConnectPostgres(env *config.Env) error {
 	return nil
 }
 
+// PostgresDSN builds the lib/pq connection string (also used by LISTEN connections).
+func PostgresDSN(env *config.Env) string {
+	return fmt.Sprintf(
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		env.PGHost, env.PGPort, env.PGUser, env.PGPassword, env.PGDatabase, env.PGSSLMode,
+	)
+}
+
 // ConnectPostgresReturn is an alternative that returns the *sql.DB in case you prefer DI.
 // It also assigns PostgresDB global for backwards compatibility.
 func ConnectPostgresReturn(env *config.Env) (*sql.DB, error) {
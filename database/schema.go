@@ -0,0 +1,247 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// postgresSchema lists idempotent DDL for tables that were added after the
+// initial SRS schema (users, roles, students, ... are provisioned separately).
+// Statements run in order on every start, so only append to this list.
+var postgresSchema = []string{
+	// refresh tokens (opaque, stored as sha256 hex). family_id groups every
+	// rotation of one login so a replayed token can revoke the whole chain.
+	`CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id          UUID PRIMARY KEY,
+		user_id     UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		family_id   UUID NOT NULL,
+		token_hash  VARCHAR(64) NOT NULL UNIQUE,
+		expires_at  TIMESTAMP NOT NULL,
+		used_at     TIMESTAMP,
+		revoked_at  TIMESTAMP,
+		created_at  TIMESTAMP NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_id)`,
+
+	// access-token revocation: single tokens by jti, or every token of a
+	// user issued before revoked_before (deactivation, password change, ...)
+	`CREATE TABLE IF NOT EXISTS revoked_tokens (
+		jti         VARCHAR(64) PRIMARY KEY,
+		user_id     UUID NOT NULL,
+		expires_at  TIMESTAMP NOT NULL,
+		revoked_at  TIMESTAMP NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS user_token_cutoffs (
+		user_id         UUID PRIMARY KEY,
+		revoked_before  TIMESTAMP NOT NULL
+	)`,
+
+	// bumped on every role-permission change; tokens carry it as "pv"
+	`ALTER TABLE roles ADD COLUMN IF NOT EXISTS perm_version INTEGER NOT NULL DEFAULT 1`,
+
+	// single-use password reset tokens (sha256 hex of the emailed token)
+	`CREATE TABLE IF NOT EXISTS password_reset_tokens (
+		id          UUID PRIMARY KEY,
+		user_id     UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		token_hash  VARCHAR(64) NOT NULL UNIQUE,
+		expires_at  TIMESTAMP NOT NULL,
+		used_at     TIMESTAMP,
+		created_at  TIMESTAMP NOT NULL DEFAULT NOW()
+	)`,
+
+	// failed-login tracking per identifier ("id:<name>") and per client ip ("ip:<addr>")
+	`CREATE TABLE IF NOT EXISTS login_attempts (
+		key              VARCHAR(320) PRIMARY KEY,
+		failures         INTEGER NOT NULL DEFAULT 0,
+		last_failure_at  TIMESTAMP NOT NULL,
+		locked_until     TIMESTAMP
+	)`,
+
+	// TOTP (RFC 6238) second factor; last_used_step blocks code replay
+	`CREATE TABLE IF NOT EXISTS user_mfa (
+		user_id         UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+		secret          VARCHAR(64) NOT NULL,
+		enabled         BOOLEAN NOT NULL DEFAULT FALSE,
+		last_used_step  BIGINT NOT NULL DEFAULT 0,
+		created_at      TIMESTAMP NOT NULL DEFAULT NOW(),
+		enabled_at      TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+		id          UUID PRIMARY KEY,
+		user_id     UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		code_hash   VARCHAR(64) NOT NULL,
+		used_at     TIMESTAMP,
+		created_at  TIMESTAMP NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user ON mfa_recovery_codes(user_id)`,
+	`ALTER TABLE roles ADD COLUMN IF NOT EXISTS mfa_required BOOLEAN NOT NULL DEFAULT FALSE`,
+
+	// one row per login; the id doubles as the refresh token family id and
+	// is carried in access tokens as "sid"
+	`CREATE TABLE IF NOT EXISTS user_sessions (
+		id            UUID PRIMARY KEY,
+		user_id       UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		user_agent    TEXT NOT NULL DEFAULT '',
+		ip            VARCHAR(64) NOT NULL DEFAULT '',
+		created_at    TIMESTAMP NOT NULL DEFAULT NOW(),
+		last_seen_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+		revoked_at    TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_user_sessions_user ON user_sessions(user_id)`,
+
+	// personal access tokens / service accounts; permissions is the token's
+	// own subset of the owner's role permissions
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS is_service_account BOOLEAN NOT NULL DEFAULT FALSE`,
+	`CREATE TABLE IF NOT EXISTS api_tokens (
+		id            UUID PRIMARY KEY,
+		user_id       UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name          VARCHAR(100) NOT NULL,
+		token_prefix  VARCHAR(16) NOT NULL,
+		token_hash    VARCHAR(64) NOT NULL UNIQUE,
+		permissions   TEXT[] NOT NULL DEFAULT '{}',
+		expires_at    TIMESTAMP NOT NULL,
+		last_used_at  TIMESTAMP,
+		revoked_at    TIMESTAMP,
+		created_by    UUID,
+		created_at    TIMESTAMP NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_api_tokens_user ON api_tokens(user_id)`,
+
+	// OIDC single sign-on: pending logins (state -> PKCE verifier + nonce)
+	// and the link between an IdP subject and a local user
+	`CREATE TABLE IF NOT EXISTS oidc_login_states (
+		state_hash     VARCHAR(64) PRIMARY KEY,
+		code_verifier  VARCHAR(128) NOT NULL,
+		nonce          VARCHAR(128) NOT NULL,
+		expires_at     TIMESTAMP NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS user_identities (
+		id          UUID PRIMARY KEY,
+		user_id     UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		issuer      TEXT NOT NULL,
+		subject     TEXT NOT NULL,
+		email       TEXT NOT NULL DEFAULT '',
+		created_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+		UNIQUE (issuer, subject)
+	)`,
+
+	// admin impersonation: token issuance and every mutating request made
+	// with an impersonation token
+	`CREATE TABLE IF NOT EXISTS impersonation_audit (
+		id          UUID PRIMARY KEY,
+		actor_id    UUID NOT NULL,
+		target_id   UUID NOT NULL,
+		token_id    VARCHAR(64) NOT NULL,
+		method      VARCHAR(16) NOT NULL,
+		path        TEXT NOT NULL,
+		status      INT NOT NULL,
+		created_at  TIMESTAMP NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_impersonation_audit_actor ON impersonation_audit(actor_id, created_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_impersonation_audit_target ON impersonation_audit(target_id, created_at)`,
+
+	// invitations: users created without a password activate their account
+	// by setting one through a single-use link
+	`CREATE TABLE IF NOT EXISTS user_invitations (
+		id           UUID PRIMARY KEY,
+		user_id      UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		token_hash   VARCHAR(64) NOT NULL UNIQUE,
+		expires_at   TIMESTAMP NOT NULL,
+		accepted_at  TIMESTAMP,
+		revoked_at   TIMESTAMP,
+		created_by   UUID,
+		created_at   TIMESTAMP NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_user_invitations_user ON user_invitations(user_id)`,
+
+	// role inheritance: role_id gets every permission of parent_role_id
+	// (transitively). Cycles are rejected when an edge is added.
+	`CREATE TABLE IF NOT EXISTS role_inherits (
+		role_id         UUID NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+		parent_role_id  UUID NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+		created_at      TIMESTAMP NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (role_id, parent_role_id),
+		CHECK (role_id <> parent_role_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_role_inherits_parent ON role_inherits(parent_role_id)`,
+
+	// append-only history of achievement_references.status; one row per
+	// transition, written in the same transaction as the status change
+	`CREATE TABLE IF NOT EXISTS achievement_status_events (
+		id            UUID PRIMARY KEY,
+		reference_id  UUID NOT NULL,
+		from_status   VARCHAR(20),
+		to_status     VARCHAR(20) NOT NULL,
+		actor_id      UUID,
+		note          TEXT,
+		created_at    TIMESTAMP NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_achievement_status_events_ref ON achievement_status_events(reference_id, created_at)`,
+
+	// reviewer comments from a revision request, keyed to a field or an
+	// attachment; open until the student resolves them
+	`CREATE TABLE IF NOT EXISTS achievement_review_comments (
+		id             UUID PRIMARY KEY,
+		reference_id   UUID NOT NULL,
+		field          VARCHAR(100),
+		attachment_id  VARCHAR(100),
+		comment        TEXT NOT NULL,
+		author_id      UUID NOT NULL,
+		created_at     TIMESTAMP NOT NULL DEFAULT NOW(),
+		resolved_at    TIMESTAMP,
+		resolved_by    UUID,
+		resolution     TEXT,
+		CHECK ((field IS NULL) <> (attachment_id IS NULL))
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_achievement_review_comments_ref ON achievement_review_comments(reference_id, created_at)`,
+
+	// version of the achievement_versions snapshot approved on verify
+	`ALTER TABLE achievement_references ADD COLUMN IF NOT EXISTS verified_version INTEGER`,
+
+	// admin edits of achievement documents outside the student workflow:
+	// who, why, what changed and the resulting version
+	`CREATE TABLE IF NOT EXISTS achievement_override_audit (
+		id              UUID PRIMARY KEY,
+		achievement_id  VARCHAR(24) NOT NULL,
+		actor_id        UUID NOT NULL,
+		reason          TEXT NOT NULL,
+		changes         JSONB NOT NULL,
+		version         INT NOT NULL,
+		created_at      TIMESTAMP NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_achievement_override_audit_achievement ON achievement_override_audit(achievement_id, created_at)`,
+	// the audit row is written before the override; version stays NULL until it is applied
+	`ALTER TABLE achievement_override_audit ALTER COLUMN version DROP NOT NULL`,
+
+	// one reference per Mongo achievement; ownership is resolved through it.
+	// /refs used to allow several, and their status history and review
+	// comments hang off the reference id, so duplicates are not dropped
+	// here: startup stops and names them until all but one are removed.
+	`DO $$
+	DECLARE dups TEXT;
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'idx_achievement_references_mongo') THEN
+			SELECT string_agg(mongo_achievement_id, ', ') INTO dups FROM (
+				SELECT mongo_achievement_id FROM achievement_references
+				GROUP BY mongo_achievement_id HAVING COUNT(*) > 1
+			) d;
+			IF dups IS NOT NULL THEN
+				RAISE EXCEPTION 'achievement_references has several rows for mongo_achievement_id %; keep one reference per achievement, then restart', dups;
+			END IF;
+		END IF;
+	END $$`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_achievement_references_mongo ON achievement_references(mongo_achievement_id)`,
+}
+
+// EnsurePostgresSchema applies postgresSchema on the global PostgresDB.
+func EnsurePostgresSchema(ctx context.Context) error {
+	if PostgresDB == nil {
+		return fmt.Errorf("postgres not connected")
+	}
+	for i, stmt := range postgresSchema {
+		if _, err := PostgresDB.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("schema statement %d: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"clean-arch/config"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers messages. Implementations must be safe for concurrent use.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPSender sends through an SMTP server with PLAIN auth (STARTTLS when offered).
+type SMTPSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	return smtp.SendMail(s.Host+":"+s.Port, auth, s.From, []string{msg.To}, render(s.From, msg))
+}
+
+// OutboxSender writes each message as an .eml file into Dir (local testing).
+type OutboxSender struct {
+	Dir  string
+	From string
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+func (s *OutboxSender) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000000"), unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	return os.WriteFile(filepath.Join(s.Dir, name), render(s.From, msg), 0o600)
+}
+
+// headerValue strips CR/LF so header values cannot inject extra headers.
+var headerValue = strings.NewReplacer("\r", "", "\n", "")
+
+// render builds an RFC 5322 message.
+func render(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue.Replace(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue.Replace(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue.Replace(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+var (
+	defaultSender Sender = &OutboxSender{Dir: "outbox", From: "no-reply@localhost"}
+	senderMu      sync.RWMutex
+)
+
+// Init selects the default sender from MAIL_DRIVER (smtp | outbox).
+func Init(env *config.Env) error {
+	var s Sender
+	switch env.MailDriver {
+	case "smtp":
+		if env.SMTPHost == "" {
+			return fmt.Errorf("MAIL_DRIVER=smtp requires SMTP_HOST")
+		}
+		s = &SMTPSender{Host: env.SMTPHost, Port: env.SMTPPort, Username: env.SMTPUsername, Password: env.SMTPPassword, From: env.MailFrom}
+	case "outbox", "":
+		s = &OutboxSender{Dir: env.MailOutboxDir, From: env.MailFrom}
+	default:
+		return fmt.Errorf("unknown MAIL_DRIVER %q", env.MailDriver)
+	}
+	SetSender(s)
+	log.Printf("[mail] using %s driver", env.MailDriver)
+	return nil
+}
+
+// SetSender replaces the default sender (tests, custom transports).
+func SetSender(s Sender) {
+	senderMu.Lock()
+	defaultSender = s
+	senderMu.Unlock()
+}
+
+// Send delivers msg through the default sender.
+func Send(ctx context.Context, msg Message) error {
+	senderMu.RLock()
+	s := defaultSender
+	senderMu.RUnlock()
+	return s.Send(ctx, msg)
+}
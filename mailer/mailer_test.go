@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboxSender_WritesMessage(t *testing.T) {
+	dir := t.TempDir()
+	s := &OutboxSender{Dir: dir, From: "no-reply@kampus.ac.id"}
+
+	err := s.Send(context.Background(), Message{
+		To:      "mhs@kampus.ac.id",
+		Subject: "Reset password\r\nBcc: attacker@example.com",
+		Body:    "line one\nline two",
+	})
+	require.NoError(t, err)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.Len(t, files, 1)
+	raw, _ := os.ReadFile(files[0])
+	msg := string(raw)
+
+	assert.Contains(t, msg, "To: mhs@kampus.ac.id\r\n")
+	assert.Contains(t, msg, "line one\r\nline two")
+	// CR/LF in headers must not create new header lines
+	assert.False(t, strings.Contains(msg, "\r\nBcc:"))
+}
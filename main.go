@@ -21,10 +21,15 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	svc "clean-arch/app/service"
 	"clean-arch/config"
 	"clean-arch/database"
+	"clean-arch/mailer"
+	"clean-arch/middleware"
 	"clean-arch/route"
 
 	"github.com/gofiber/fiber/v2"
@@ -48,6 +53,40 @@ func main() {
 	if err := database.ConnectPostgres(env); err != nil {
 		log.Fatalf("failed to connect to postgres: %v", err)
 	}
+	// create tables added after the SRS schema (idempotent)
+	if err := database.EnsurePostgresSchema(ctx); err != nil {
+		log.Fatalf("failed to ensure postgres schema: %v", err)
+	}
+	// "permissions <command>": route permission tooling, no server
+	if len(os.Args) > 1 && os.Args[1] == "permissions" {
+		code := runPermissionsCommand(ctx, os.Args[2:])
+		_ = database.PostgresDB.Close()
+		os.Exit(code)
+	}
+	// JWT signing keys (JWT_KEYS_DIR / JWT_ACTIVE_KID / legacy JWT_SECRET)
+	if err := middleware.InitSigningKeys(env); err != nil {
+		log.Fatalf("failed to load jwt signing keys: %v", err)
+	}
+	// role permission cache, evicted on change events from any instance
+	middleware.ConfigurePermCache(
+		time.Duration(env.PermCacheTTLSecs)*time.Second,
+		time.Duration(env.PermCacheFallbackTTLSecs)*time.Second,
+		env.PermCacheMaxEntries,
+	)
+	if env.PermCacheListen {
+		if err := middleware.StartPermCacheListener(ctx, database.PostgresDSN(env)); err != nil {
+			log.Printf("perm cache listener not started, relying on TTL: %v", err)
+		}
+	}
+	// warm the access-token revocation store
+	if err := middleware.LoadRevocations(ctx, time.Duration(env.JWTExpiresHours)*time.Hour); err != nil {
+		log.Fatalf("failed to load token revocations: %v", err)
+	}
+	// and keep it in step with revocations made on other instances
+	if err := middleware.StartRevocationSync(ctx, database.PostgresDSN(env), env.RevocationListen,
+		time.Duration(env.RevocationReloadSecs)*time.Second); err != nil {
+		log.Printf("revocation listener not started, periodic reload only: %v", err)
+	}
 	// ensure Postgres closed on exit
 	defer func() {
 		if database.PostgresDB != nil {
@@ -65,6 +104,14 @@ func main() {
 			_ = database.MongoClient.Disconnect(ctx)
 		}
 	}()
+	if err := database.EnsureMongoIndexes(ctx); err != nil {
+		log.Fatalf("failed to ensure mongo indexes: %v", err)
+	}
+
+	// outgoing mail (password reset, ...)
+	if err := mailer.Init(env); err != nil {
+		log.Fatalf("failed to init mailer: %v", err)
+	}
 
 	// create fiber app
 	app := fiber.New(fiber.Config{
@@ -72,6 +119,10 @@ func main() {
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	})
+	// client addresses come from the proxy header only via the listed proxies
+	if err := middleware.SetTrustedProxies(splitList(env.TrustedProxies), env.ProxyHeader); err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
 
 	// health check
 	app.Get("/health", func(c *fiber.Ctx) error {
@@ -86,6 +137,11 @@ func main() {
 	// Replace old RegisterPsqlRoutes + RegisterMongoRoutes with RegisterAPIRoutes
 	route.RegisterAPIRoutes(app)
 
+	// route permissions vs the permissions table (PERMISSION_SYNC)
+	if _, err := svc.CheckPermissions(ctx, route.Endpoints(), env.PermissionSync); err != nil {
+		log.Fatalf("permission check failed: %v", err)
+	}
+
 	// start server (graceful shutdown support)
 	port := env.AppPort
 	if port == "" {
@@ -99,6 +155,18 @@ func main() {
 		serverErr <- app.Listen(addr)
 	}()
 
+	// SIGHUP re-reads JWT_KEYS_DIR (key files and its "active" kid file) so
+	// keys can be rotated without a restart; env vars are not re-read
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := middleware.InitSigningKeys(env); err != nil {
+				log.Printf("jwt key reload failed, keeping previous keys: %v", err)
+			}
+		}
+	}()
+
 	// Wait for SIGINT or server error
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt)
@@ -130,3 +198,14 @@ func main() {
 
 	log.Println("server stopped")
 }
+
+// splitList parses a comma separated env value, skipping empty items.
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"clean-arch/app/repository"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// APITokenPrefix marks personal access tokens; anything else in the
+// Authorization header is treated as a JWT.
+const APITokenPrefix = "pbe_pat_"
+
+// LocalsAPITokenID is set (to the api_tokens id) when the request was
+// authenticated with a personal access token instead of a JWT.
+const LocalsAPITokenID = "api_token_id"
+
+var (
+	// last_used_at is written at most once per apiTokenTouchEvery per token
+	apiTokenTouches    = map[string]time.Time{}
+	apiTokenTouchMu    sync.Mutex
+	apiTokenTouchEvery = time.Minute
+)
+
+// IsAPIToken reports whether a bearer credential is a personal access token.
+func IsAPIToken(raw string) bool {
+	return strings.HasPrefix(raw, APITokenPrefix)
+}
+
+// authenticateAPIToken is JWTMiddleware's branch for personal access tokens.
+// The token must be live and its owner active; the token's own permission
+// list is stored in locals and intersected with the owner's role by
+// RequirePermission.
+func authenticateAPIToken(c *fiber.Ctx, raw string) error {
+	ctx := context.Background()
+	sum := sha256.Sum256([]byte(raw))
+	t, err := repository.GetAPITokenByHash(ctx, hex.EncodeToString(sum[:]))
+	if err != nil {
+		log.Printf("[auth] api token lookup error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server error"})
+	}
+	if t == nil || t.RevokedAt != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
+	}
+	if time.Now().After(t.ExpiresAt) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "token expired"})
+	}
+
+	u, err := repository.GetUserByID(ctx, t.UserID)
+	if err != nil {
+		log.Printf("[auth] api token owner lookup error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server error"})
+	}
+	if u == nil || !u.IsActive {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "token revoked"})
+	}
+
+	c.Locals(LocalsAPITokenID, t.ID)
+	c.Locals(LocalsTokenExpiry, t.ExpiresAt)
+	c.Locals(LocalsUserID, u.ID)
+	c.Locals(LocalsUsername, u.Username)
+	c.Locals(LocalsRoleID, u.RoleID)
+	perms := t.Permissions
+	if perms == nil {
+		perms = []string{}
+	}
+	c.Locals(LocalsPermissions, perms)
+
+	touchAPIToken(t.ID)
+	return c.Next()
+}
+
+// touchAPIToken updates last_used_at in the background, throttled per token.
+func touchAPIToken(id string) {
+	now := time.Now()
+	apiTokenTouchMu.Lock()
+	if now.Sub(apiTokenTouches[id]) < apiTokenTouchEvery {
+		apiTokenTouchMu.Unlock()
+		return
+	}
+	apiTokenTouches[id] = now
+	for k, at := range apiTokenTouches {
+		if now.Sub(at) > apiTokenTouchEvery {
+			delete(apiTokenTouches, k)
+		}
+	}
+	apiTokenTouchMu.Unlock()
+
+	go func() {
+		if err := repository.TouchAPIToken(context.Background(), id, now); err != nil {
+			log.Printf("[auth] touch api token %s error: %v", id, err)
+		}
+	}()
+}
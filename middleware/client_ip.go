@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Reverse proxies allowed to report the client address, and the header they
+// report it in (see SetTrustedProxies).
+var (
+	trustedProxyNets []*net.IPNet
+	proxyHeader      string
+)
+
+// SetTrustedProxies configures ClientIP (call once at startup). Each entry
+// is an IP or a CIDR; with no entries the socket peer is always used.
+func SetTrustedProxies(proxies []string, header string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			if ip := net.ParseIP(p); ip != nil && ip.To4() != nil {
+				p += "/32"
+			} else {
+				p += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return fmt.Errorf("trusted proxy %q: %w", p, err)
+		}
+		nets = append(nets, n)
+	}
+	trustedProxyNets = nets
+	proxyHeader = header
+	return nil
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, n := range trustedProxyNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client. A proxy header is only read
+// when the peer is a trusted proxy, and then from the right: proxies append
+// to X-Forwarded-For, so everything left of the first address that is not a
+// trusted proxy was written by the client and cannot be believed.
+func ClientIP(c *fiber.Ctx) string {
+	peer := c.Context().RemoteIP()
+	if proxyHeader == "" || !isTrustedProxy(peer) {
+		return peer.String()
+	}
+	hops := strings.Split(c.Get(proxyHeader), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		if !isTrustedProxy(ip) {
+			return ip.String()
+		}
+	}
+	return peer.String()
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func clientIPFor(peer, xff string) string {
+	app := fiber.New()
+	fctx := &fasthttp.RequestCtx{}
+	fctx.SetRemoteAddr(&net.TCPAddr{IP: net.ParseIP(peer), Port: 40000})
+	if xff != "" {
+		fctx.Request.Header.Set("X-Forwarded-For", xff)
+	}
+	c := app.AcquireCtx(fctx)
+	defer app.ReleaseCtx(c)
+	return ClientIP(c)
+}
+
+func TestClientIP(t *testing.T) {
+	require.NoError(t, SetTrustedProxies([]string{"10.0.0.0/8", "192.168.1.5"}, "X-Forwarded-For"))
+	defer SetTrustedProxies(nil, "")
+
+	// the proxy appended the real client; the leftmost entry is client-made
+	assert.Equal(t, "203.0.113.9", clientIPFor("10.0.0.2", "1.2.3.4, 203.0.113.9"))
+	// several trusted hops are skipped from the right
+	assert.Equal(t, "203.0.113.9", clientIPFor("192.168.1.5", "6.6.6.6, 203.0.113.9, 10.1.2.3"))
+	// an untrusted peer cannot set the header at all
+	assert.Equal(t, "198.51.100.7", clientIPFor("198.51.100.7", "1.2.3.4"))
+	// garbage stops the walk: fall back to the peer
+	assert.Equal(t, "10.0.0.2", clientIPFor("10.0.0.2", "not-an-ip"))
+	assert.Equal(t, "10.0.0.2", clientIPFor("10.0.0.2", ""))
+
+	assert.Error(t, SetTrustedProxies([]string{"10.0.0.0/99"}, "X-Forwarded-For"))
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"log"
+
+	"clean-arch/app/repository"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// While impersonating, LocalsUserID is the impersonated user and these hold
+// the admin acting on their behalf (the token's "act" claim, RFC 8693).
+const (
+	LocalsActorID       = "actor_id"
+	LocalsActorUsername = "actor_username"
+)
+
+// actorFromClaims reads the "act" claim ({"sub": ..., "username": ...}).
+func actorFromClaims(raw interface{}) (id, username string) {
+	act, ok := raw.(map[string]interface{})
+	if !ok {
+		return "", ""
+	}
+	id, _ = act["sub"].(string)
+	username, _ = act["username"].(string)
+	return id, username
+}
+
+// isMutating reports whether a request may change state.
+func isMutating(method string) bool {
+	switch method {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// auditImpersonatedRequest runs the rest of the chain and records every
+// mutating request made with an impersonation token, with both user ids.
+func auditImpersonatedRequest(c *fiber.Ctx, actorID, targetID, jti string) error {
+	err := c.Next()
+	if !isMutating(c.Method()) {
+		return err
+	}
+
+	status := c.Response().StatusCode()
+	if fe, ok := err.(*fiber.Error); ok {
+		status = fe.Code
+	}
+	method, path := c.Method(), c.Path()
+	log.Printf("[impersonation] actor=%s target=%s %s %s -> %d", actorID, targetID, method, path, status)
+	if aerr := repository.CreateImpersonationAudit(context.Background(), actorID, targetID, jti, method, path, status); aerr != nil {
+		log.Printf("[impersonation] audit write error: %v", aerr)
+	}
+	return err
+}
+
+// DenyImpersonation refuses the route to impersonation tokens (credential
+// and security settings stay with the real user).
+func DenyImpersonation(c *fiber.Ctx) error {
+	if actor, _ := c.Locals(LocalsActorID).(string); actor != "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "not allowed while impersonating"})
+	}
+	return c.Next()
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"clean-arch/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTMiddleware_ImpersonationToken(t *testing.T) {
+	require.NoError(t, InitSigningKeys(&config.Env{}))
+	now := time.Now()
+	token, err := SignToken(jwt.MapClaims{
+		"sub": "student-1",
+		"typ": TokenTypeAccess,
+		"jti": "imp-1",
+		"iat": now.Unix(),
+		"exp": now.Add(time.Minute).Unix(),
+		"act": map[string]interface{}{"sub": "admin-1", "username": "admin"},
+	})
+	require.NoError(t, err)
+
+	app := fiber.New()
+	app.Get("/whoami", JWTMiddleware(), func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"user": c.Locals(LocalsUserID), "actor": c.Locals(LocalsActorID)})
+	})
+	app.Get("/password", JWTMiddleware(), DenyImpersonation, func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	req := httptest.NewRequest("GET", "/whoami", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, _ := app.Test(req)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	var body map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "student-1", body["user"])
+	assert.Equal(t, "admin-1", body["actor"])
+
+	req = httptest.NewRequest("GET", "/password", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, _ = app.Test(req)
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+	// revoking the admin's tokens also ends the impersonation
+	revocationMu.Lock()
+	userCutoffs["admin-1"] = now.Add(time.Second)
+	revocationMu.Unlock()
+	defer func() {
+		revocationMu.Lock()
+		delete(userCutoffs, "admin-1")
+		revocationMu.Unlock()
+	}()
+	req = httptest.NewRequest("GET", "/whoami", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, _ = app.Test(req)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestJWTMiddleware_TokenType(t *testing.T) {
+	require.NoError(t, InitSigningKeys(&config.Env{}))
+	app := fiber.New()
+	app.Get("/me", JWTMiddleware(), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	cases := []struct {
+		name string
+		typ  interface{}
+		want int
+	}{
+		{"access", TokenTypeAccess, fiber.StatusOK},
+		{"legacy token without typ", nil, fiber.StatusOK},
+		{"mfa pending", TokenTypeMFAPending, fiber.StatusUnauthorized},
+		{"unknown", "refresh", fiber.StatusUnauthorized},
+	}
+	for i, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Now()
+			claims := jwt.MapClaims{
+				"sub": "user-1",
+				"jti": "typ-" + string(rune('a'+i)),
+				"iat": now.Unix(),
+				"exp": now.Add(time.Minute).Unix(),
+			}
+			if tc.typ != nil {
+				claims["typ"] = tc.typ
+			}
+			token, err := SignToken(claims)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest("GET", "/me", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, resp.StatusCode)
+		})
+	}
+}
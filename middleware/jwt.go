@@ -2,8 +2,8 @@ package middleware
 
 import (
 	"fmt"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
@@ -15,15 +15,24 @@ const (
 	LocalsUsername    = "username"
 	LocalsRoleID      = "role_id"
 	LocalsPermissions = "permissions"
+	LocalsTokenID     = "token_id"
+	LocalsTokenExpiry = "token_expiry"
+	LocalsPermVersion = "perm_version"
+	LocalsSessionID   = "session_id"
+)
+
+// ClaimIssuedAtMicros is the sub-second issue time (unix microseconds) that
+// per-user revocation cutoffs are compared with (see TokenIssuedAt).
+const ClaimIssuedAtMicros = "iat_us"
+
+// Token types ("typ" claim). Only access tokens are accepted by JWTMiddleware.
+const (
+	TokenTypeAccess     = "access"
+	TokenTypeMFAPending = "mfa_pending"
 )
 
 // JWTMiddleware extracts Bearer token, validates it, and stores claims in c.Locals
 func JWTMiddleware() fiber.Handler {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "change-this-secret"
-	}
-
 	return func(c *fiber.Ctx) error {
 		auth := c.Get("Authorization")
 		if auth == "" {
@@ -36,13 +45,12 @@ func JWTMiddleware() fiber.Handler {
 		}
 		tokenStr := parts[1]
 
-		token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-			// only HMAC supported
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrTokenUnverifiable
-			}
-			return []byte(secret), nil
-		})
+		// personal access tokens (integrations, service accounts) are opaque
+		if IsAPIToken(tokenStr) {
+			return authenticateAPIToken(c, tokenStr)
+		}
+
+		token, err := ParseToken(tokenStr)
 		if err != nil || !token.Valid {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
 		}
@@ -52,16 +60,53 @@ func JWTMiddleware() fiber.Handler {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token claims"})
 		}
 
-		// copy expected claims into locals
-		if sub, ok := claims["sub"].(string); ok {
-			c.Locals(LocalsUserID, sub)
+		// short-lived helper tokens (e.g. mfa pending) must not open the API.
+		// Access tokens signed before the claim existed have no typ; helper
+		// tokens always carried one, so those are still let through until
+		// they expire (JWT_EXPIRES_HOURS after the upgrade).
+		if typ, _ := claims["typ"].(string); typ != TokenTypeAccess && typ != "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token type"})
 		}
+
+		// every token must carry a jti so it can be revoked server-side
+		jti, _ := claims["jti"].(string)
+		sub, _ := claims["sub"].(string)
+		if jti == "" || sub == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token claims"})
+		}
+		issuedAt := TokenIssuedAt(claims)
+		var expiresAt time.Time
+		if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+			expiresAt = exp.Time
+		}
+		sid, _ := claims["sid"].(string)
+		if IsTokenRevoked(jti, sub, issuedAt) || IsSessionRevoked(sid) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "token revoked"})
+		}
+		// impersonation tokens also die with the acting admin's tokens
+		actorID, actorUsername := actorFromClaims(claims["act"])
+		if actorID != "" && IsTokenRevoked(jti, actorID, issuedAt) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "token revoked"})
+		}
+		c.Locals(LocalsTokenID, jti)
+		c.Locals(LocalsTokenExpiry, expiresAt)
+		if sid != "" {
+			c.Locals(LocalsSessionID, sid)
+			touchSession(sid, ClientIP(c))
+		}
+
+		// copy expected claims into locals
+		c.Locals(LocalsUserID, sub)
 		if un, ok := claims["username"].(string); ok {
 			c.Locals(LocalsUsername, un)
 		}
 		if rid, ok := claims["role_id"].(string); ok {
 			c.Locals(LocalsRoleID, rid)
 		}
+		// role permission version the token's permissions were taken at
+		if pv, ok := claims["pv"].(float64); ok {
+			c.Locals(LocalsPermVersion, int(pv))
+		}
 
 		// normalize permissions into []string and always set it (even empty)
 		var permsOut []string
@@ -93,6 +138,11 @@ func JWTMiddleware() fiber.Handler {
 		}
 		c.Locals(LocalsPermissions, permsOut)
 
+		if actorID != "" {
+			c.Locals(LocalsActorID, actorID)
+			c.Locals(LocalsActorUsername, actorUsername)
+			return auditImpersonatedRequest(c, actorID, sub, jti)
+		}
 		return c.Next()
 	}
 }
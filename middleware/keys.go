@@ -0,0 +1,231 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"clean-arch/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// legacyHMACKID is the kid used for the JWT_SECRET (HS256) key.
+const legacyHMACKID = "hs256"
+
+// activeKIDFile in JWT_KEYS_DIR names the signing kid; it is re-read on reload.
+const activeKIDFile = "active"
+
+// signingKey is one entry of the key set, selected by its kid.
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.PrivateKey // []byte for HMAC
+	public  crypto.PublicKey  // nil for HMAC (never published)
+}
+
+var (
+	keys      = map[string]*signingKey{}
+	activeKID string
+	keysMu    sync.RWMutex
+)
+
+// InitSigningKeys loads the signing key set.
+//
+// Every *.pem file in JWT_KEYS_DIR (PKCS#8 RSA or Ed25519, or PKCS#1 RSA) is a
+// verification key whose kid is the file name without extension. The key used
+// for new tokens is the kid named in JWT_KEYS_DIR/active if that file exists,
+// else JWT_ACTIVE_KID, else the last kid in sort order.
+// JWT_SECRET, when set, stays valid as an HS256 key so tokens issued before a
+// migration keep working; it only signs when no asymmetric key is configured.
+//
+// Rotation: add the new key file, write its kid to JWT_KEYS_DIR/active and
+// reload (SIGHUP); remove the old file once tokens signed with it have
+// expired. The environment is read once per process, so a changed
+// JWT_ACTIVE_KID only applies after a restart.
+func InitSigningKeys(env *config.Env) error {
+	loaded := map[string]*signingKey{}
+
+	if env.JWTKeysDir != "" {
+		files, err := filepath.Glob(filepath.Join(env.JWTKeysDir, "*.pem"))
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			k, err := loadPEMKey(f)
+			if err != nil {
+				return fmt.Errorf("load key %s: %w", f, err)
+			}
+			loaded[k.kid] = k
+		}
+	}
+
+	active := env.JWTActiveKID
+	if env.JWTKeysDir != "" {
+		raw, err := os.ReadFile(filepath.Join(env.JWTKeysDir, activeKIDFile))
+		if err == nil {
+			active = strings.TrimSpace(string(raw))
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if active == "" && len(loaded) > 0 {
+		kids := make([]string, 0, len(loaded))
+		for kid := range loaded {
+			kids = append(kids, kid)
+		}
+		sort.Strings(kids)
+		active = kids[len(kids)-1]
+	}
+
+	if env.JWTSecret != "" {
+		loaded[legacyHMACKID] = &signingKey{
+			kid:     legacyHMACKID,
+			method:  jwt.SigningMethodHS256,
+			private: []byte(env.JWTSecret),
+		}
+		if active == "" {
+			active = legacyHMACKID
+		}
+	}
+
+	if len(loaded) == 0 {
+		// nothing configured: tokens will not survive a restart
+		log.Println("WARNING: no JWT_KEYS_DIR or JWT_SECRET configured; using an ephemeral Ed25519 key")
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		loaded["ephemeral"] = &signingKey{kid: "ephemeral", method: jwt.SigningMethodEdDSA, private: priv, public: pub}
+		active = "ephemeral"
+	}
+
+	if _, ok := loaded[active]; !ok {
+		return fmt.Errorf("JWT_ACTIVE_KID %q not found in key set", active)
+	}
+
+	keysMu.Lock()
+	keys = loaded
+	activeKID = active
+	keysMu.Unlock()
+	log.Printf("[jwt] %d key(s) loaded, signing with kid=%s", len(loaded), active)
+	return nil
+}
+
+// loadPEMKey parses a private key file; the kid is the file name.
+func loadPEMKey(path string) (*signingKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block")
+	}
+	kid := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	var parsed interface{}
+	if block.Type == "RSA PRIVATE KEY" {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodRS256, private: k, public: &k.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodEdDSA, private: k, public: k.Public()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+}
+
+// SignToken signs claims with the active key and sets the kid header.
+func SignToken(claims jwt.Claims) (string, error) {
+	keysMu.RLock()
+	k := keys[activeKID]
+	keysMu.RUnlock()
+	if k == nil {
+		return "", fmt.Errorf("signing keys not initialized")
+	}
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.kid
+	return token.SignedString(k.private)
+}
+
+// verificationKey is the jwt.Keyfunc: the kid selects the key and the token
+// alg must match that key's alg (no alg confusion between HMAC and RSA).
+func verificationKey(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		// tokens issued before kids were introduced
+		kid = legacyHMACKID
+	}
+	keysMu.RLock()
+	k := keys[kid]
+	keysMu.RUnlock()
+	if k == nil || t.Method.Alg() != k.method.Alg() {
+		return nil, jwt.ErrTokenUnverifiable
+	}
+	if k.public == nil {
+		return k.private, nil
+	}
+	return k.public, nil
+}
+
+// ParseToken verifies a token string against the key set.
+func ParseToken(tokenStr string) (*jwt.Token, error) {
+	return jwt.Parse(tokenStr, verificationKey,
+		jwt.WithValidMethods([]string{"RS256", "EdDSA", "HS256"}))
+}
+
+// JWKSHandler serves the public keys (GET /.well-known/jwks.json).
+// HMAC keys are never published.
+func JWKSHandler(c *fiber.Ctx) error {
+	keysMu.RLock()
+	out := make([]fiber.Map, 0, len(keys))
+	for _, k := range keys {
+		switch pub := k.public.(type) {
+		case *rsa.PublicKey:
+			out = append(out, fiber.Map{
+				"kty": "RSA",
+				"kid": k.kid,
+				"use": "sig",
+				"alg": k.method.Alg(),
+				"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			out = append(out, fiber.Map{
+				"kty": "OKP",
+				"crv": "Ed25519",
+				"kid": k.kid,
+				"use": "sig",
+				"alg": k.method.Alg(),
+				"x":   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	keysMu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i]["kid"].(string) < out[j]["kid"].(string) })
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(fiber.Map{"keys": out})
+}
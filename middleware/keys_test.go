@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"clean-arch/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeKey(t *testing.T, dir, kid string, key interface{}) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, kid+".pem"), pemBytes, 0o600))
+}
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{"sub": "u1", "exp": time.Now().Add(time.Minute).Unix()}
+}
+
+func TestSigningKeys_RotationKeepsOldTokensValid(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	writeKey(t, dir, "2026-01", rsaKey)
+
+	require.NoError(t, InitSigningKeys(&config.Env{JWTKeysDir: dir}))
+	oldToken, err := SignToken(testClaims())
+	require.NoError(t, err)
+
+	// rotate: add a newer Ed25519 key, which becomes active by sort order
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	writeKey(t, dir, "2026-06", edKey)
+	require.NoError(t, InitSigningKeys(&config.Env{JWTKeysDir: dir}))
+
+	newToken, err := SignToken(testClaims())
+	require.NoError(t, err)
+
+	for _, s := range []string{oldToken, newToken} {
+		tok, err := ParseToken(s)
+		assert.NoError(t, err)
+		assert.True(t, tok.Valid)
+	}
+	tok, _ := ParseToken(newToken)
+	assert.Equal(t, "2026-06", tok.Header["kid"])
+	assert.Equal(t, "EdDSA", tok.Method.Alg())
+}
+
+func TestSigningKeys_ActiveFileReadOnReload(t *testing.T) {
+	dir := t.TempDir()
+	for _, kid := range []string{"2026-01", "2026-06"} {
+		_, edKey, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		writeKey(t, dir, kid, edKey)
+	}
+	env := &config.Env{JWTKeysDir: dir, JWTActiveKID: "2026-06"}
+	signingKID := func() interface{} {
+		s, err := SignToken(testClaims())
+		require.NoError(t, err)
+		tok, err := ParseToken(s)
+		require.NoError(t, err)
+		return tok.Header["kid"]
+	}
+	require.NoError(t, InitSigningKeys(env))
+	assert.Equal(t, "2026-06", signingKID())
+
+	// the active file overrides JWT_ACTIVE_KID and is picked up by a reload
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "active"), []byte("2026-01\n"), 0o600))
+	require.NoError(t, InitSigningKeys(env))
+	assert.Equal(t, "2026-01", signingKID())
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "active"), []byte("missing"), 0o600))
+	assert.Error(t, InitSigningKeys(env))
+	assert.Equal(t, "2026-01", signingKID())
+}
+
+func TestSigningKeys_RejectsAlgMismatch(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	writeKey(t, dir, "k1", rsaKey)
+	require.NoError(t, InitSigningKeys(&config.Env{JWTKeysDir: dir}))
+
+	// HS256 token claiming the RSA kid must not verify
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	forged.Header["kid"] = "k1"
+	s, err := forged.SignedString([]byte("anything"))
+	require.NoError(t, err)
+
+	_, err = ParseToken(s)
+	assert.Error(t, err)
+}
+
+func TestJWKSHandler_PublishesOnlyPublicKeys(t *testing.T) {
+	dir := t.TempDir()
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	writeKey(t, dir, "ed", edKey)
+	require.NoError(t, InitSigningKeys(&config.Env{JWTKeysDir: dir, JWTSecret: "legacy"}))
+
+	app := fiber.New()
+	app.Get("/.well-known/jwks.json", JWKSHandler)
+	resp, err := app.Test(httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	require.NoError(t, err)
+
+	var body struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Len(t, body.Keys, 1)
+	assert.Equal(t, "ed", body.Keys[0]["kid"])
+	assert.Equal(t, "OKP", body.Keys[0]["kty"])
+}
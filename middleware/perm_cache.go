@@ -1,46 +1,196 @@
 package middleware
 
 import (
+	"container/list"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type cacheItem struct {
-	perms  []string
-	expire time.Time
+	perms    []string // effective (inherited included), may hold patterns
+	set      permSet
+	version  int // roles.perm_version the perms were loaded at
+	loadedAt time.Time
 }
 
+type cacheEntry struct {
+	roleID string
+	item   cacheItem
+}
+
+// Listener states: with no listener the plain TTL applies; while a started
+// listener is down entries expire after the (shorter) fallback TTL.
+const (
+	listenerDisabled int32 = iota
+	listenerUp
+	listenerDown
+)
+
 var (
-	permCache   = map[string]cacheItem{}
-	permCacheMu sync.RWMutex
-	cacheTTL    = 5 * time.Minute
+	// bounded LRU: permCache indexes elements of permLRU (front = most recent)
+	permCache   = map[string]*list.Element{}
+	permLRU     = list.New()
+	permCacheMu sync.Mutex
+	// permCacheGen is bumped by every invalidation/flush; a load that started
+	// before one is not stored, so it cannot put back what was just dropped
+	permCacheGen uint64
+
+	cacheTTL         = 5 * time.Minute
+	cacheFallbackTTL = 30 * time.Second
+	cacheMaxEntries  = 1000
+
+	listenerState atomic.Int32
+
+	cacheHits          atomic.Uint64
+	cacheMisses        atomic.Uint64
+	cacheEvictions     atomic.Uint64
+	cacheInvalidations atomic.Uint64
 )
 
+// ConfigurePermCache sets the TTL, the TTL used while the change listener is
+// down, and the maximum number of cached roles. Zero values keep defaults.
+func ConfigurePermCache(ttl, fallbackTTL time.Duration, maxEntries int) {
+	permCacheMu.Lock()
+	defer permCacheMu.Unlock()
+	if ttl > 0 {
+		cacheTTL = ttl
+	}
+	if fallbackTTL > 0 {
+		cacheFallbackTTL = fallbackTTL
+	}
+	if maxEntries > 0 {
+		cacheMaxEntries = maxEntries
+	}
+}
+
+// currentTTL must be called with permCacheMu held.
+func currentTTL() time.Duration {
+	if listenerState.Load() == listenerDown && cacheFallbackTTL < cacheTTL {
+		return cacheFallbackTTL
+	}
+	return cacheTTL
+}
+
 // GetCachedPerms returns perms and true if present + not expired
 func GetCachedPerms(roleID string) ([]string, bool) {
-	permCacheMu.RLock()
-	defer permCacheMu.RUnlock()
-	it, ok := permCache[roleID]
+	it, ok := getCachedRole(roleID)
 	if !ok {
 		return nil, false
 	}
-	if time.Now().After(it.expire) {
-		return nil, false
-	}
 	return it.perms, true
 }
 
-func SetCachedPerms(roleID string, perms []string) {
+// getCachedRole returns the whole cache entry (perms + version) if not expired
+func getCachedRole(roleID string) (cacheItem, bool) {
+	permCacheMu.Lock()
+	defer permCacheMu.Unlock()
+	el, ok := permCache[roleID]
+	if !ok {
+		return cacheItem{}, false
+	}
+	it := el.Value.(*cacheEntry).item
+	if time.Since(it.loadedAt) > currentTTL() {
+		permLRU.Remove(el)
+		delete(permCache, roleID)
+		return cacheItem{}, false
+	}
+	permLRU.MoveToFront(el)
+	return it, true
+}
+
+func SetCachedPerms(roleID string, perms []string, version int) {
+	storeCachedRole(roleID, newCacheItem(perms, version), cacheGeneration())
+}
+
+// cacheGeneration is read before loading permissions and handed to storeCachedRole.
+func cacheGeneration() uint64 {
 	permCacheMu.Lock()
 	defer permCacheMu.Unlock()
-	permCache[roleID] = cacheItem{
-		perms:  perms,
-		expire: time.Now().Add(cacheTTL),
+	return permCacheGen
+}
+
+func newCacheItem(perms []string, version int) cacheItem {
+	return cacheItem{
+		perms:    perms,
+		set:      newPermSet(perms),
+		version:  version,
+		loadedAt: time.Now(),
+	}
+}
+
+// storeCachedRole caches it unless the cache was invalidated after gen was read.
+func storeCachedRole(roleID string, it cacheItem, gen uint64) {
+	permCacheMu.Lock()
+	defer permCacheMu.Unlock()
+	if gen != permCacheGen {
+		return
+	}
+	if el, ok := permCache[roleID]; ok {
+		el.Value.(*cacheEntry).item = it
+		permLRU.MoveToFront(el)
+		return
+	}
+	permCache[roleID] = permLRU.PushFront(&cacheEntry{roleID: roleID, item: it})
+	for permLRU.Len() > cacheMaxEntries {
+		oldest := permLRU.Back()
+		permLRU.Remove(oldest)
+		delete(permCache, oldest.Value.(*cacheEntry).roleID)
+		cacheEvictions.Add(1)
 	}
 }
 
 func InvalidateCachedPerms(roleID string) {
 	permCacheMu.Lock()
-	delete(permCache, roleID)
+	if el, ok := permCache[roleID]; ok {
+		permLRU.Remove(el)
+		delete(permCache, roleID)
+	}
+	permCacheGen++
 	permCacheMu.Unlock()
+	cacheInvalidations.Add(1)
+}
+
+// FlushPermCache drops every entry (change events may have been missed).
+func FlushPermCache() {
+	permCacheMu.Lock()
+	permCache = map[string]*list.Element{}
+	permLRU.Init()
+	permCacheGen++
+	permCacheMu.Unlock()
+}
+
+// PermCacheStats is a snapshot of the permission cache counters.
+type PermCacheStats struct {
+	Entries       int    `json:"entries"`
+	MaxEntries    int    `json:"max_entries"`
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Evictions     uint64 `json:"evictions"`
+	Invalidations uint64 `json:"invalidations"`
+	Listener      string `json:"listener"` // disabled, up or down
+	TTLSeconds    int    `json:"ttl_seconds"`
+}
+
+// GetPermCacheStats returns the current cache counters.
+func GetPermCacheStats() PermCacheStats {
+	permCacheMu.Lock()
+	defer permCacheMu.Unlock()
+	state := "disabled"
+	switch listenerState.Load() {
+	case listenerUp:
+		state = "up"
+	case listenerDown:
+		state = "down"
+	}
+	return PermCacheStats{
+		Entries:       permLRU.Len(),
+		MaxEntries:    cacheMaxEntries,
+		Hits:          cacheHits.Load(),
+		Misses:        cacheMisses.Load(),
+		Evictions:     cacheEvictions.Load(),
+		Invalidations: cacheInvalidations.Load(),
+		Listener:      state,
+		TTLSeconds:    int(currentTTL() / time.Second),
+	}
 }
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPermCache_BoundedLRU(t *testing.T) {
+	FlushPermCache()
+	defer FlushPermCache()
+	prev := cacheMaxEntries
+	cacheMaxEntries = 2
+	defer func() { cacheMaxEntries = prev }()
+
+	before := GetPermCacheStats().Evictions
+	SetCachedPerms("role-a", []string{"a.read"}, 1)
+	SetCachedPerms("role-b", []string{"b.read"}, 1)
+	_, _ = GetCachedPerms("role-a") // role-b is now least recently used
+	SetCachedPerms("role-c", []string{"c.read"}, 1)
+
+	_, okA := GetCachedPerms("role-a")
+	_, okB := GetCachedPerms("role-b")
+	_, okC := GetCachedPerms("role-c")
+	assert.True(t, okA)
+	assert.False(t, okB)
+	assert.True(t, okC)
+	assert.Equal(t, 2, GetPermCacheStats().Entries)
+	assert.Equal(t, before+1, GetPermCacheStats().Evictions)
+}
+
+func TestPermCache_FallbackTTLWhileListenerDown(t *testing.T) {
+	FlushPermCache()
+	defer FlushPermCache()
+	defer listenerState.Store(listenerDisabled)
+
+	SetCachedPerms("role-1", []string{"users.list"}, 1)
+	permCacheMu.Lock()
+	permCache["role-1"].Value.(*cacheEntry).item.loadedAt = time.Now().Add(-time.Minute)
+	permCacheMu.Unlock()
+
+	listenerState.Store(listenerUp)
+	_, ok := GetCachedPerms("role-1")
+	assert.True(t, ok, "within the normal TTL")
+
+	listenerState.Store(listenerDown)
+	_, ok = GetCachedPerms("role-1")
+	assert.False(t, ok, "older than the fallback TTL")
+}
+
+func TestPermCache_StaleLoadDroppedAfterInvalidation(t *testing.T) {
+	FlushPermCache()
+	defer FlushPermCache()
+
+	// a load starts, the role changes and is invalidated, then the load finishes
+	gen := cacheGeneration()
+	InvalidateCachedPerms("role-1")
+	storeCachedRole("role-1", newCacheItem([]string{"users.delete"}, 1), gen)
+	_, ok := GetCachedPerms("role-1")
+	assert.False(t, ok, "the stale load must not be cached")
+
+	storeCachedRole("role-1", newCacheItem([]string{"users.list"}, 2), cacheGeneration())
+	perms, ok := GetCachedPerms("role-1")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"users.list"}, perms)
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"clean-arch/app/repository"
+
+	"github.com/lib/pq"
+)
+
+// StartPermCacheListener subscribes to role permission change events
+// (Postgres NOTIFY on repository.PermChangeChannel, published by every
+// instance) and evicts the affected roles from permCache. While the
+// connection is down entries fall back to the short TTL; after a reconnect
+// the whole cache is dropped since events may have been missed. It runs
+// until ctx is done.
+func StartPermCacheListener(ctx context.Context, dsn string) error {
+	l := pq.NewListener(dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		switch ev {
+		case pq.ListenerEventConnected, pq.ListenerEventReconnected:
+			listenerState.Store(listenerUp)
+		case pq.ListenerEventDisconnected, pq.ListenerEventConnectionAttemptFailed:
+			if listenerState.Swap(listenerDown) != listenerDown {
+				log.Printf("[perm-cache] change listener down, falling back to %s TTL: %v", cacheFallbackTTL, err)
+			}
+		}
+	})
+	if err := l.Listen(repository.PermChangeChannel); err != nil {
+		_ = l.Close()
+		return err
+	}
+	listenerState.Store(listenerUp)
+
+	go func() {
+		defer func() {
+			_ = l.Close()
+			listenerState.Store(listenerDisabled)
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case n := <-l.Notify:
+				if n == nil {
+					// reconnected: anything published meanwhile is lost
+					FlushPermCache()
+					continue
+				}
+				InvalidateCachedPerms(n.Extra)
+			case <-time.After(90 * time.Second):
+				// detect a silently dead connection
+				go func() { _ = l.Ping() }()
+			}
+		}
+	}()
+	return nil
+}
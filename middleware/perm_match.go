@@ -0,0 +1,64 @@
+package middleware
+
+import "strings"
+
+// permMatches reports whether a granted permission covers perm. Grants are
+// exact names ("achievements.verify"), resource wildcards ("achievements.*",
+// which also covers deeper names like "achievements.ref.view") or "*".
+func permMatches(granted, perm string) bool {
+	if granted == perm || granted == "*" {
+		return true
+	}
+	if strings.HasSuffix(granted, ".*") {
+		return strings.HasPrefix(perm, granted[:len(granted)-1])
+	}
+	return false
+}
+
+// HasPermission reports whether any of the granted permissions (patterns
+// included) covers perm.
+func HasPermission(granted []string, perm string) bool {
+	for _, g := range granted {
+		if permMatches(g, perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// permSet is a role's effective permissions compiled for lookups.
+type permSet struct {
+	all      bool
+	exact    map[string]struct{}
+	prefixes []string // "achievements." for "achievements.*"
+}
+
+func newPermSet(perms []string) permSet {
+	s := permSet{exact: make(map[string]struct{}, len(perms))}
+	for _, p := range perms {
+		switch {
+		case p == "*":
+			s.all = true
+		case strings.HasSuffix(p, ".*"):
+			s.prefixes = append(s.prefixes, p[:len(p)-1])
+		default:
+			s.exact[p] = struct{}{}
+		}
+	}
+	return s
+}
+
+func (s permSet) has(perm string) bool {
+	if s.all {
+		return true
+	}
+	if _, ok := s.exact[perm]; ok {
+		return true
+	}
+	for _, p := range s.prefixes {
+		if strings.HasPrefix(perm, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+
+	"clean-arch/app/model"
+	"clean-arch/app/repository"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// LocalsSubject caches the resolved policy subject for the request.
+const LocalsSubject = "policy_subject"
+
+// AdminRoleName is the system role that passes every relationship check.
+const AdminRoleName = "admin"
+
+// Achievement actions checked by the policy. RequirePermission decides
+// whether the caller may perform the action at all; the policy decides on
+// which students' achievements.
+const (
+	ActionView   = "view"   // read, history, attachments
+	ActionEdit   = "edit"   // update, submit, delete, add attachments
+	ActionVerify = "verify" // verify / reject
+)
+
+// Subject is the caller as seen by the achievement policy.
+type Subject struct {
+	UserID    string
+	Admin     bool
+	StudentID string // students.id when the caller has a student profile
+}
+
+// CurrentSubject resolves (once per request) who is asking.
+func CurrentSubject(c *fiber.Ctx) (*Subject, error) {
+	if s, ok := c.Locals(LocalsSubject).(*Subject); ok {
+		return s, nil
+	}
+	userID, _ := c.Locals(LocalsUserID).(string)
+	roleID, _ := c.Locals(LocalsRoleID).(string)
+	ctx := context.Background()
+
+	s := &Subject{UserID: userID}
+	if roleID != "" {
+		r, err := repository.GetRoleByID(ctx, roleID)
+		if err != nil {
+			return nil, err
+		}
+		s.Admin = r != nil && r.Name == AdminRoleName
+	}
+	if userID != "" {
+		st, err := repository.GetStudentByUserID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if st != nil {
+			s.StudentID = st.ID
+		}
+	}
+	c.Locals(LocalsSubject, s)
+	return s, nil
+}
+
+// CanActOnAchievement applies the relationship rules to an achievement
+// owned by student: admins may do anything, a student views and edits only
+// their own, and a lecturer views and verifies only their advisees'
+// (students.advisor_id is the lecturer's user id). Nobody verifies their
+// own achievement.
+func (s *Subject) CanActOnAchievement(action string, owner *model.Student) bool {
+	if s.Admin {
+		return true
+	}
+	if owner == nil || s.UserID == "" {
+		return false
+	}
+	isOwner := s.StudentID != "" && s.StudentID == owner.ID
+	isAdvisor := owner.AdvisorID != nil && *owner.AdvisorID == s.UserID
+	switch action {
+	case ActionView:
+		return isOwner || isAdvisor
+	case ActionEdit:
+		return isOwner
+	case ActionVerify:
+		return isAdvisor && !isOwner
+	}
+	return false
+}
+
+// AchievementScope returns the students whose achievements the subject may
+// list. all is true for admins (no filter needed).
+func (s *Subject) AchievementScope(ctx context.Context) (all bool, studentIDs []string, err error) {
+	if s.Admin {
+		return true, nil, nil
+	}
+	studentIDs = []string{}
+	if s.StudentID != "" {
+		studentIDs = append(studentIDs, s.StudentID)
+	}
+	if s.UserID != "" {
+		advisees, err := repository.ListStudentsByAdvisor(ctx, s.UserID)
+		if err != nil {
+			return false, nil, err
+		}
+		for _, st := range advisees {
+			studentIDs = append(studentIDs, st.ID)
+		}
+	}
+	return false, studentIDs, nil
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"testing"
+
+	"clean-arch/app/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanActOnAchievement(t *testing.T) {
+	advisor := "lecturer-user-1"
+	owner := &model.Student{ID: "stud-1", UserID: "student-user-1", AdvisorID: &advisor}
+
+	student := &Subject{UserID: "student-user-1", StudentID: "stud-1"}
+	assert.True(t, student.CanActOnAchievement(ActionView, owner))
+	assert.True(t, student.CanActOnAchievement(ActionEdit, owner))
+	assert.False(t, student.CanActOnAchievement(ActionVerify, owner))
+
+	other := &Subject{UserID: "student-user-2", StudentID: "stud-2"}
+	assert.False(t, other.CanActOnAchievement(ActionView, owner))
+	assert.False(t, other.CanActOnAchievement(ActionEdit, owner))
+
+	lecturer := &Subject{UserID: advisor}
+	assert.True(t, lecturer.CanActOnAchievement(ActionView, owner))
+	assert.True(t, lecturer.CanActOnAchievement(ActionVerify, owner))
+	assert.False(t, lecturer.CanActOnAchievement(ActionEdit, owner))
+
+	otherLecturer := &Subject{UserID: "lecturer-user-2"}
+	assert.False(t, otherLecturer.CanActOnAchievement(ActionVerify, owner))
+
+	admin := &Subject{UserID: "admin-1", Admin: true}
+	assert.True(t, admin.CanActOnAchievement(ActionVerify, owner))
+	assert.True(t, admin.CanActOnAchievement(ActionEdit, nil))
+}
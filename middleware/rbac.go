@@ -2,65 +2,214 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
 	"log"
 
 	"clean-arch/app/repository"
 	"github.com/gofiber/fiber/v2"
 )
 
-func hasPerm(perms []string, perm string) bool {
-	for _, p := range perms {
-		if p == perm {
-			return true
+// LocalsDecision holds the *Decision of the last permission check.
+const LocalsDecision = "authz_decision"
+
+// Decision sources: what the granted permissions were read from.
+const (
+	SourceToken    = "token"     // permissions claim of an access token stamped with the current perm_version
+	SourceAPIToken = "api_token" // personal access token scope, capped by the role
+	SourceCache    = "cache"     // this instance's permCache
+	SourceDatabase = "database"  // role_permissions (cache miss or stale)
+)
+
+// Decision modes.
+const (
+	ModeAll = "all"
+	ModeAny = "any"
+)
+
+// Decision is the structured record of one permission check.
+type Decision struct {
+	UserID       string            `json:"user_id"`
+	RoleID       string            `json:"role_id"`
+	Needed       []string          `json:"needed"`
+	Mode         string            `json:"mode"`
+	Source       string            `json:"source"`
+	TokenVersion int               `json:"token_version"`
+	RoleVersion  int               `json:"role_version"`
+	Matched      map[string]string `json:"matched,omitempty"` // needed permission -> grant that covered it
+	Missing      []string          `json:"missing,omitempty"`
+	Allowed      bool              `json:"allowed"`
+	Reason       string            `json:"reason,omitempty"`
+}
+
+// matchingGrant returns the first grant covering perm ("" if none).
+func matchingGrant(granted []string, perm string) string {
+	for _, g := range granted {
+		if permMatches(g, perm) {
+			return g
 		}
 	}
-	return false
+	return ""
 }
 
-// RequirePermission returns a fiber.Handler that enforces the given permission string.
-func RequirePermission(perm string) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		// 1) fast path: permissions present in token
-		if v := c.Locals(LocalsPermissions); v != nil {
-			if perms, ok := v.([]string); ok {
-				if hasPerm(perms, perm) {
-					return c.Next()
-				}
+// loadRolePerms returns the role's current permissions from the cache, and
+// reloads from the repository when the cache is missing or older than the
+// token's stamp (the role changed after this instance cached it).
+func loadRolePerms(roleID string, tokenVersion int) (cacheItem, string, error) {
+	if it, ok := getCachedRole(roleID); ok && tokenVersion <= it.version {
+		cacheHits.Add(1)
+		return it, SourceCache, nil
+	}
+	cacheMisses.Add(1)
+	gen := cacheGeneration()
+	perms, version, err := repository.LoadRolePermissions(context.Background(), roleID)
+	if err != nil {
+		return cacheItem{}, "", err
+	}
+	it := newCacheItem(perms, version)
+	storeCachedRole(roleID, it, gen)
+	return it, SourceDatabase, nil
+}
+
+// evaluate fills d from the caller's token permissions and the role's
+// current permissions. tokenPerms is the token's claim (or a PAT's scope
+// when apiToken is set).
+func evaluate(d *Decision, current cacheItem, roleSource string, tokenPerms []string, apiToken bool) {
+	d.RoleVersion = current.version
+	d.Matched = map[string]string{}
+	tokenTrusted := !apiToken && d.TokenVersion == current.version
+	fromRole, fromToken := false, false
+
+	for _, perm := range d.Needed {
+		switch {
+		case apiToken:
+			// the token's own list, capped by what the owner's role grants right now
+			if g := matchingGrant(tokenPerms, perm); g != "" && current.set.has(perm) {
+				d.Matched[perm] = g
+				continue
 			}
+		case tokenTrusted && matchingGrant(tokenPerms, perm) != "":
+			// fast path: permissions in token, trusted only while its stamp is current
+			d.Matched[perm] = matchingGrant(tokenPerms, perm)
+			fromToken = true
+			continue
+		case current.set.has(perm):
+			d.Matched[perm] = matchingGrant(current.perms, perm)
+			fromRole = true
+			continue
+		}
+		d.Missing = append(d.Missing, perm)
+	}
+
+	switch {
+	case apiToken:
+		d.Source = SourceAPIToken
+	case fromToken && !fromRole:
+		d.Source = SourceToken
+	default:
+		d.Source = roleSource
+	}
+
+	if d.Mode == ModeAny {
+		d.Allowed = len(d.Matched) > 0
+	} else {
+		d.Allowed = len(d.Missing) == 0
+	}
+	if d.Allowed {
+		return
+	}
+	switch {
+	case apiToken && len(d.Missing) > 0 && matchingGrant(tokenPerms, d.Missing[0]) != "":
+		d.Reason = "granted to the api token but no longer to the owner's role"
+	case apiToken:
+		d.Reason = "not in the api token's scope"
+	case d.TokenVersion < current.version && len(d.Missing) > 0 && matchingGrant(tokenPerms, d.Missing[0]) != "":
+		d.Reason = "token permissions are stale and the role no longer grants it"
+	default:
+		d.Reason = "not granted to the role"
+	}
+}
+
+// requirePermissions builds the handler behind RequirePermission,
+// RequireAnyPermission and RequireAllPermissions. An empty list is a
+// programming error (all-of-nothing would allow everyone), so it panics
+// while the routes are registered.
+func requirePermissions(mode string, perms []string) fiber.Handler {
+	if len(perms) == 0 {
+		panic("rbac: " + mode + "-of permission check built with no permissions")
+	}
+	for _, p := range perms {
+		if p == "" {
+			panic("rbac: empty permission name")
 		}
+	}
+	return func(c *fiber.Ctx) error {
+		userID, _ := c.Locals(LocalsUserID).(string)
+		tokenVersion, _ := c.Locals(LocalsPermVersion).(int)
+		d := &Decision{UserID: userID, Needed: perms, Mode: mode, TokenVersion: tokenVersion}
+		c.Locals(LocalsDecision, d)
 
-		// 2) get role id from locals
+		// 1) get role id from locals
 		rv := c.Locals(LocalsRoleID)
 		if rv == nil {
+			d.Reason = "missing role info"
 			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "missing role info"})
 		}
 		roleID, ok := rv.(string)
 		if !ok || roleID == "" {
+			d.Reason = "invalid role info"
 			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "invalid role info"})
 		}
+		d.RoleID = roleID
 
-		// 3) check cache
-		if cp, ok := GetCachedPerms(roleID); ok {
-			if hasPerm(cp, perm) {
-				return c.Next()
-			}
-			log.Printf("[rbac] deny (cache) role=%s need=%s", roleID, perm)
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "insufficient permissions"})
-		}
-
-		// 4) fallback load from repository
-		perms, err := repository.ListPermissionsByRole(context.Background(), roleID)
+		// 2) current role permissions (cache, or repository on miss / newer token)
+		current, source, err := loadRolePerms(roleID, tokenVersion)
 		if err != nil {
 			log.Printf("[rbac] failed load perms role=%s err=%v", roleID, err)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server error"})
 		}
-		// cache result for next calls
-		SetCachedPerms(roleID, perms)
 
-		if hasPerm(perms, perm) {
+		// 3) token claims / PAT scope vs role permissions
+		tokenPerms, _ := c.Locals(LocalsPermissions).([]string)
+		_, isAPIToken := c.Locals(LocalsAPITokenID).(string)
+		evaluate(d, current, source, tokenPerms, isAPIToken)
+		if d.Allowed {
 			return c.Next()
 		}
-		log.Printf("[rbac] deny role=%s need=%s", roleID, perm)
+		if b, err := json.Marshal(d); err == nil {
+			log.Printf("[rbac] deny %s", b)
+		}
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "insufficient permissions"})
 	}
 }
+
+// RequirePermission returns a fiber.Handler that enforces the given permission string.
+func RequirePermission(perm string) fiber.Handler {
+	return requirePermissions(ModeAll, []string{perm})
+}
+
+// RequireAnyPermission passes when at least one of perms is granted.
+func RequireAnyPermission(perms ...string) fiber.Handler {
+	return requirePermissions(ModeAny, perms)
+}
+
+// RequireAllPermissions passes only when every one of perms is granted.
+func RequireAllPermissions(perms ...string) fiber.Handler {
+	return requirePermissions(ModeAll, perms)
+}
+
+// ExplainRolePermissions replays a check for a role without a token: once
+// against this instance's cache (nil when the role isn't cached) and once
+// against the database.
+func ExplainRolePermissions(ctx context.Context, userID, roleID, mode string, perms []string) (cached, fresh *Decision, err error) {
+	if it, ok := getCachedRole(roleID); ok {
+		cached = &Decision{UserID: userID, RoleID: roleID, Needed: perms, Mode: mode, TokenVersion: it.version}
+		evaluate(cached, it, SourceCache, nil, false)
+	}
+	granted, version, err := repository.LoadRolePermissions(ctx, roleID)
+	if err != nil {
+		return nil, nil, err
+	}
+	fresh = &Decision{UserID: userID, RoleID: roleID, Needed: perms, Mode: mode, TokenVersion: version}
+	evaluate(fresh, newCacheItem(granted, version), SourceDatabase, nil, false)
+	return cached, fresh, nil
+}
@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func permApp(tokenPerms []string, tokenVersion int, need string) *fiber.App {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		c.Locals(LocalsRoleID, "role-1")
+		c.Locals(LocalsPermissions, tokenPerms)
+		c.Locals(LocalsPermVersion, tokenVersion)
+		return c.Next()
+	}, RequirePermission(need), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	return app
+}
+
+func TestRequirePermission_StaleTokenPermsIgnored(t *testing.T) {
+	// role is at version 3 and no longer grants users.delete
+	SetCachedPerms("role-1", []string{"users.list"}, 3)
+	defer InvalidateCachedPerms("role-1")
+
+	// token issued at version 2 still lists users.delete
+	resp, _ := permApp([]string{"users.list", "users.delete"}, 2, "users.delete").Test(httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+	resp, _ = permApp([]string{"users.list", "users.delete"}, 2, "users.list").Test(httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
+
+func TestRequirePermission_CurrentTokenTrusted(t *testing.T) {
+	SetCachedPerms("role-1", []string{"users.list"}, 3)
+	defer InvalidateCachedPerms("role-1")
+
+	resp, _ := permApp([]string{"users.list"}, 3, "users.list").Test(httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
+
+func TestRequirePermission_APITokenCappedByRole(t *testing.T) {
+	SetCachedPerms("role-1", []string{"reports.read"}, 0)
+	defer InvalidateCachedPerms("role-1")
+
+	app := fiber.New()
+	app.Get("/:need", func(c *fiber.Ctx) error {
+		c.Locals(LocalsRoleID, "role-1")
+		c.Locals(LocalsAPITokenID, "tok-1")
+		c.Locals(LocalsPermissions, []string{"reports.read", "users.delete"})
+		return c.Next()
+	}, func(c *fiber.Ctx) error {
+		return RequirePermission(c.Params("need"))(c)
+	}, func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/reports.read", nil))
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	// listed on the token but no longer granted to the owner's role
+	resp, _ = app.Test(httptest.NewRequest("GET", "/users.delete", nil))
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+	// granted to the role but not to the token
+	SetCachedPerms("role-1", []string{"reports.read", "users.list"}, 0)
+	resp, _ = app.Test(httptest.NewRequest("GET", "/users.list", nil))
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+}
+
+func TestRequirePermission_WildcardGrants(t *testing.T) {
+	SetCachedPerms("role-1", []string{"achievements.*", "users.list"}, 3)
+	defer InvalidateCachedPerms("role-1")
+
+	resp, _ := permApp(nil, 2, "achievements.verify").Test(httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	resp, _ = permApp(nil, 2, "users.delete").Test(httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+
+	SetCachedPerms("role-1", []string{"*"}, 3)
+	resp, _ = permApp(nil, 2, "users.delete").Test(httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
+
+func TestHasPermission_Patterns(t *testing.T) {
+	assert.True(t, HasPermission([]string{"achievements.*"}, "achievements.verify"))
+	assert.True(t, HasPermission([]string{"achievements.*"}, "achievements.*"))
+	assert.False(t, HasPermission([]string{"achievements.*"}, "achievementsx.verify"))
+	assert.False(t, HasPermission([]string{"achievements.*"}, "achievements"))
+	assert.True(t, HasPermission([]string{"*"}, "anything.at_all"))
+	assert.False(t, HasPermission([]string{"users.list"}, "users.*"))
+}
+
+func TestRequireAnyAndAllPermissions(t *testing.T) {
+	SetCachedPerms("role-1", []string{"achievements.verify"}, 3)
+	defer InvalidateCachedPerms("role-1")
+
+	run := func(h fiber.Handler) (int, *Decision) {
+		var d *Decision
+		app := fiber.New()
+		app.Get("/", func(c *fiber.Ctx) error {
+			c.Locals(LocalsRoleID, "role-1")
+			c.Locals(LocalsPermVersion, 3)
+			err := c.Next()
+			d, _ = c.Locals(LocalsDecision).(*Decision)
+			return err
+		}, h, func(c *fiber.Ctx) error {
+			return c.SendStatus(fiber.StatusOK)
+		})
+		resp, _ := app.Test(httptest.NewRequest("GET", "/", nil))
+		return resp.StatusCode, d
+	}
+
+	status, d := run(RequireAnyPermission("achievements.reject", "achievements.verify"))
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, SourceCache, d.Source)
+	assert.Equal(t, "achievements.verify", d.Matched["achievements.verify"])
+
+	status, d = run(RequireAllPermissions("achievements.reject", "achievements.verify"))
+	assert.Equal(t, fiber.StatusForbidden, status)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, []string{"achievements.reject"}, d.Missing)
+	assert.Equal(t, "not granted to the role", d.Reason)
+}
+
+func TestRequirePermissions_EmptyListPanics(t *testing.T) {
+	assert.Panics(t, func() { RequireAllPermissions() })
+	assert.Panics(t, func() { RequireAnyPermission() })
+	assert.Panics(t, func() { RequireAllPermissions("users.list", "") })
+	assert.NotPanics(t, func() { RequireAllPermissions("users.list") })
+}
+
+func TestRequirePermission_DecisionSource(t *testing.T) {
+	SetCachedPerms("role-1", []string{"users.list"}, 3)
+	defer InvalidateCachedPerms("role-1")
+
+	var d *Decision
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		c.Locals(LocalsRoleID, "role-1")
+		c.Locals(LocalsPermissions, []string{"users.*"})
+		c.Locals(LocalsPermVersion, 3)
+		err := c.Next()
+		d, _ = c.Locals(LocalsDecision).(*Decision)
+		return err
+	}, RequirePermission("users.list"), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	resp, _ := app.Test(httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, SourceToken, d.Source)
+	assert.Equal(t, "users.*", d.Matched["users.list"])
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"clean-arch/app/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Revocation store: Postgres is the source of truth, the maps below are the
+// in-memory fast path consulted by JWTMiddleware on every request.
+var (
+	revokedJTIs   = map[string]time.Time{} // jti -> token expiry
+	userCutoffs   = map[string]time.Time{} // user id -> tokens issued before are revoked
+	revocationMu  sync.RWMutex
+	lastRevPurge  time.Time
+	revPurgeEvery = 10 * time.Minute
+	maxTokenAge   time.Duration
+)
+
+// LoadRevocations fills the in-memory store from Postgres: at startup and on
+// every periodic reload (StartRevocationSync). Loaded entries are merged so
+// revocations recorded locally meanwhile are kept. maxAge is the
+// access-token lifetime; older cutoffs can no longer match.
+func LoadRevocations(ctx context.Context, maxAge time.Duration) error {
+	jtis, err := repository.ListActiveRevokedTokens(ctx)
+	if err != nil {
+		return err
+	}
+	cutoffs, err := repository.ListUserTokenCutoffs(ctx, time.Now().Add(-maxAge))
+	if err != nil {
+		return err
+	}
+
+	revocationMu.Lock()
+	for jti, exp := range jtis {
+		revokedJTIs[jti] = exp
+	}
+	for uid, cutoff := range cutoffs {
+		if cutoff.After(userCutoffs[uid]) {
+			userCutoffs[uid] = cutoff
+		}
+	}
+	maxTokenAge = maxAge
+	revocationMu.Unlock()
+	return loadRevokedSessions(ctx, time.Now().Add(-maxAge))
+}
+
+// TokenIssuedAt returns a token's issue time: the iat_us claim (microseconds)
+// when present, else the second-precision iat. A token without iat_us issued
+// in the same second as a user cutoff counts as issued before it.
+func TokenIssuedAt(claims jwt.MapClaims) time.Time {
+	if us, ok := claims[ClaimIssuedAtMicros].(float64); ok {
+		return time.UnixMicro(int64(us))
+	}
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		return iat.Time
+	}
+	return time.Time{}
+}
+
+// RevokeToken revokes a single access token until its expiry.
+func RevokeToken(ctx context.Context, jti, userID string, expiresAt time.Time) error {
+	if err := repository.RevokeAccessToken(ctx, jti, userID, expiresAt); err != nil {
+		return err
+	}
+	revocationMu.Lock()
+	revokedJTIs[jti] = expiresAt
+	revocationMu.Unlock()
+	publishRevocation(ctx, "jti", jti, expiresAt)
+	purgeRevocations()
+	return nil
+}
+
+// RevokeUserTokens revokes every access token of the user issued until now.
+func RevokeUserTokens(ctx context.Context, userID string) error {
+	// compared with the iat_us claim, so a token issued right after this
+	// call (e.g. the fresh one after a password change) stays valid; the
+	// precision matches what Postgres stores
+	now := time.Now().Truncate(time.Microsecond)
+	if err := repository.SetUserTokenCutoff(ctx, userID, now); err != nil {
+		return err
+	}
+	revocationMu.Lock()
+	if now.After(userCutoffs[userID]) {
+		userCutoffs[userID] = now
+	}
+	revocationMu.Unlock()
+	publishRevocation(ctx, "user", userID, now)
+	return nil
+}
+
+// IsTokenRevoked reports whether a token (by jti, owner and issue time) was
+// revoked. issuedAt comes from TokenIssuedAt.
+func IsTokenRevoked(jti, userID string, issuedAt time.Time) bool {
+	revocationMu.RLock()
+	defer revocationMu.RUnlock()
+	if _, ok := revokedJTIs[jti]; ok {
+		return true
+	}
+	if cutoff, ok := userCutoffs[userID]; ok && issuedAt.Before(cutoff) {
+		return true
+	}
+	return false
+}
+
+// purgeRevocations drops expired jtis from memory and Postgres, at most every revPurgeEvery.
+func purgeRevocations() {
+	now := time.Now()
+	revocationMu.Lock()
+	if now.Sub(lastRevPurge) < revPurgeEvery {
+		revocationMu.Unlock()
+		return
+	}
+	lastRevPurge = now
+	for jti, exp := range revokedJTIs {
+		if now.After(exp) {
+			delete(revokedJTIs, jti)
+		}
+	}
+	maxAge := maxTokenAge
+	revocationMu.Unlock()
+	purgeSessions(now, maxAge)
+
+	go func() {
+		_ = repository.PurgeExpiredRevocations(context.Background())
+	}()
+}
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"clean-arch/app/repository"
+
+	"github.com/lib/pq"
+)
+
+// publishRevocation tells the other instances about a revocation already
+// stored in Postgres. A lost event is caught up by the periodic reload.
+func publishRevocation(ctx context.Context, kind, id string, at time.Time) {
+	payload := kind + "|" + id + "|" + strconv.FormatInt(at.UnixMicro(), 10)
+	if err := repository.NotifyRevocation(ctx, payload); err != nil {
+		log.Printf("[revocation] notify %s error: %v", kind, err)
+	}
+}
+
+// applyRevocationEvent records a revocation published by any instance.
+func applyRevocationEvent(payload string) {
+	parts := strings.Split(payload, "|")
+	if len(parts) != 3 || parts[1] == "" {
+		return
+	}
+	micros, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return
+	}
+	at := time.UnixMicro(micros)
+	switch parts[0] {
+	case "jti":
+		revocationMu.Lock()
+		revokedJTIs[parts[1]] = at
+		revocationMu.Unlock()
+	case "user":
+		revocationMu.Lock()
+		if at.After(userCutoffs[parts[1]]) {
+			userCutoffs[parts[1]] = at
+		}
+		revocationMu.Unlock()
+	case "session":
+		sessionMu.Lock()
+		revokedSessions[parts[1]] = at
+		sessionMu.Unlock()
+	}
+}
+
+// StartRevocationSync keeps this instance's revocation store in step with
+// the others. With listen it applies the NOTIFY events on
+// repository.RevocationChannel as they arrive and reloads everything after a
+// reconnect; every reloadEvery (if > 0) it reloads the store from Postgres
+// as a backstop for lost events. If the listener cannot start the error is
+// returned and only the periodic reload runs. It runs until ctx is done.
+func StartRevocationSync(ctx context.Context, dsn string, listen bool, reloadEvery time.Duration) error {
+	var l *pq.Listener
+	var listenErr error
+	if listen {
+		l = pq.NewListener(dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+			if ev == pq.ListenerEventDisconnected || ev == pq.ListenerEventConnectionAttemptFailed {
+				log.Printf("[revocation] listener down, relying on periodic reload: %v", err)
+			}
+		})
+		if listenErr = l.Listen(repository.RevocationChannel); listenErr != nil {
+			_ = l.Close()
+			l = nil
+		}
+	}
+
+	go func() {
+		var notify <-chan *pq.Notification
+		if l != nil {
+			notify = l.Notify
+			defer l.Close()
+		}
+		var tick <-chan time.Time
+		if reloadEvery > 0 {
+			t := time.NewTicker(reloadEvery)
+			defer t.Stop()
+			tick = t.C
+		}
+		reload := func() {
+			if err := LoadRevocations(ctx, maxAge()); err != nil {
+				log.Printf("[revocation] reload error: %v", err)
+			}
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case n := <-notify:
+				if n == nil {
+					// reconnected: anything published meanwhile is lost
+					reload()
+					continue
+				}
+				applyRevocationEvent(n.Extra)
+			case <-tick:
+				reload()
+			case <-time.After(90 * time.Second):
+				if l != nil {
+					// detect a silently dead connection
+					go func() { _ = l.Ping() }()
+				}
+			}
+		}
+	}()
+	return listenErr
+}
+
+// maxAge is the access-token lifetime given to the last LoadRevocations.
+func maxAge() time.Duration {
+	revocationMu.RLock()
+	defer revocationMu.RUnlock()
+	return maxTokenAge
+}
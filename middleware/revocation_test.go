@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTokenRevoked(t *testing.T) {
+	now := time.Now().Truncate(time.Microsecond)
+
+	revocationMu.Lock()
+	revokedJTIs = map[string]time.Time{"jti-revoked": now.Add(time.Hour)}
+	userCutoffs = map[string]time.Time{"user-1": now}
+	revocationMu.Unlock()
+
+	assert.True(t, IsTokenRevoked("jti-revoked", "user-2", now))
+	assert.True(t, IsTokenRevoked("jti-old", "user-1", now.Add(-time.Microsecond)))
+	// a token issued right after the cutoff (same second) stays valid
+	assert.False(t, IsTokenRevoked("jti-new", "user-1", now))
+	assert.False(t, IsTokenRevoked("jti-later", "user-1", now.Add(time.Millisecond)))
+	assert.False(t, IsTokenRevoked("jti-other", "user-2", now.Add(-time.Hour)))
+}
+
+func TestTokenIssuedAt(t *testing.T) {
+	issued := time.Date(2026, 5, 1, 10, 0, 0, 750_000_000, time.UTC)
+	claims := jwt.MapClaims{"iat": float64(issued.Unix()), ClaimIssuedAtMicros: float64(issued.UnixMicro())}
+	assert.True(t, issued.Equal(TokenIssuedAt(claims)))
+
+	// tokens without iat_us fall back to the start of their second
+	delete(claims, ClaimIssuedAtMicros)
+	assert.True(t, issued.Truncate(time.Second).Equal(TokenIssuedAt(claims)))
+	assert.True(t, TokenIssuedAt(jwt.MapClaims{}).IsZero())
+}
+
+func TestIsSessionRevoked(t *testing.T) {
+	now := time.Now()
+
+	sessionMu.Lock()
+	revokedSessions = map[string]time.Time{"sid-revoked": now.Add(-2 * time.Hour), "sid-recent": now}
+	sessionMu.Unlock()
+
+	assert.True(t, IsSessionRevoked("sid-revoked"))
+	assert.False(t, IsSessionRevoked("sid-live"))
+	assert.False(t, IsSessionRevoked(""))
+
+	purgeSessions(now, time.Hour)
+	assert.False(t, IsSessionRevoked("sid-revoked"))
+	assert.True(t, IsSessionRevoked("sid-recent"))
+}
+
+func TestTouchSession_PurgesStaleEntries(t *testing.T) {
+	now := time.Now()
+	revocationMu.Lock()
+	maxTokenAge = time.Hour
+	revocationMu.Unlock()
+	sessionMu.Lock()
+	revokedSessions = map[string]time.Time{"sid-old": now.Add(-2 * time.Hour), "sid-recent": now}
+	sessionMu.Unlock()
+	sessionTouchMu.Lock()
+	// stamp within the throttle so no last_seen_at write is started
+	sessionTouches = map[string]time.Time{"sid-idle": now.Add(-time.Hour), "sid-active": now}
+	lastSessionPurge = now.Add(-revPurgeEvery)
+	sessionTouchMu.Unlock()
+
+	touchSession("sid-active", "10.0.0.1")
+
+	assert.False(t, IsSessionRevoked("sid-old"))
+	assert.True(t, IsSessionRevoked("sid-recent"))
+	sessionTouchMu.Lock()
+	defer sessionTouchMu.Unlock()
+	assert.NotContains(t, sessionTouches, "sid-idle")
+	assert.Contains(t, sessionTouches, "sid-active")
+}
+
+func TestApplyRevocationEvent(t *testing.T) {
+	now := time.Now().Truncate(time.Microsecond)
+	micros := func(t time.Time) string { return strconv.FormatInt(t.UnixMicro(), 10) }
+	revocationMu.Lock()
+	revokedJTIs = map[string]time.Time{}
+	userCutoffs = map[string]time.Time{"user-1": now}
+	revocationMu.Unlock()
+
+	applyRevocationEvent("jti|jti-remote|" + micros(now.Add(time.Hour)))
+	applyRevocationEvent("user|user-2|" + micros(now))
+	// an older cutoff never moves a newer one back
+	applyRevocationEvent("user|user-1|" + micros(now.Add(-time.Hour)))
+	applyRevocationEvent("session|sid-remote|" + micros(now))
+	applyRevocationEvent("garbage")
+
+	before := now.Add(-time.Microsecond)
+	assert.True(t, IsTokenRevoked("jti-remote", "user-3", now))
+	assert.True(t, IsTokenRevoked("jti-x", "user-2", before))
+	assert.False(t, IsTokenRevoked("jti-x", "user-2", now))
+	assert.True(t, IsTokenRevoked("jti-y", "user-1", before))
+	assert.True(t, IsSessionRevoked("sid-remote"))
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"clean-arch/app/repository"
+)
+
+// Revoked sessions (sid -> revoked at). Access tokens of a revoked session
+// are refused even though their jti was never listed individually.
+var (
+	revokedSessions = map[string]time.Time{}
+	sessionMu       sync.RWMutex
+
+	// last_seen_at is written at most once per sessionTouchEvery per session
+	sessionTouches    = map[string]time.Time{}
+	sessionTouchMu    sync.Mutex
+	sessionTouchEvery = time.Minute
+
+	// the touch path also purges both maps, at most once per revPurgeEvery,
+	// so they shrink on instances that never revoke a token themselves
+	lastSessionPurge time.Time
+)
+
+// loadRevokedSessions merges Postgres into the in-memory set (called by LoadRevocations).
+func loadRevokedSessions(ctx context.Context, since time.Time) error {
+	sessions, err := repository.ListRevokedSessions(ctx, since)
+	if err != nil {
+		return err
+	}
+	sessionMu.Lock()
+	for sid, at := range sessions {
+		revokedSessions[sid] = at
+	}
+	sessionMu.Unlock()
+	return nil
+}
+
+// RevokeSession ends one session of the user. It returns false when the
+// session does not exist, belongs to someone else or was already revoked.
+func RevokeSession(ctx context.Context, userID, sid string) (bool, error) {
+	ok, err := repository.RevokeSession(ctx, userID, sid)
+	if err != nil || !ok {
+		return ok, err
+	}
+	now := time.Now()
+	sessionMu.Lock()
+	revokedSessions[sid] = now
+	sessionMu.Unlock()
+	publishRevocation(ctx, "session", sid, now)
+	return true, nil
+}
+
+// IsSessionRevoked reports whether the session a token belongs to was ended.
+// Tokens without a session (empty sid) are never matched.
+func IsSessionRevoked(sid string) bool {
+	if sid == "" {
+		return false
+	}
+	sessionMu.RLock()
+	defer sessionMu.RUnlock()
+	_, ok := revokedSessions[sid]
+	return ok
+}
+
+// touchSession updates last_seen_at in the background, throttled per session.
+func touchSession(sid, ip string) {
+	if sid == "" {
+		return
+	}
+	now := time.Now()
+	sessionTouchMu.Lock()
+	purgeDue := now.Sub(lastSessionPurge) >= revPurgeEvery
+	if purgeDue {
+		lastSessionPurge = now
+	}
+	touchDue := now.Sub(sessionTouches[sid]) >= sessionTouchEvery
+	if touchDue {
+		sessionTouches[sid] = now
+	}
+	sessionTouchMu.Unlock()
+	if purgeDue {
+		purgeSessions(now, maxAge())
+	}
+	if !touchDue {
+		return
+	}
+
+	go func() {
+		if err := repository.TouchSession(context.Background(), sid, ip, now); err != nil {
+			log.Printf("[session] touch %s error: %v", sid, err)
+		}
+	}()
+}
+
+// purgeSessions drops revoked sessions older than maxAge (kept while it is
+// unknown) and touch stamps older than sessionTouchEvery.
+func purgeSessions(now time.Time, maxAge time.Duration) {
+	if maxAge > 0 {
+		sessionMu.Lock()
+		for sid, at := range revokedSessions {
+			if now.Sub(at) > maxAge {
+				delete(revokedSessions, sid)
+			}
+		}
+		sessionMu.Unlock()
+	}
+
+	sessionTouchMu.Lock()
+	for sid, at := range sessionTouches {
+		if now.Sub(at) > sessionTouchEvery {
+			delete(sessionTouches, sid)
+		}
+	}
+	sessionTouchMu.Unlock()
+}
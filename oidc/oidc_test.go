@@ -0,0 +1,100 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"clean-arch/oidc"
+	"clean-arch/oidc/oidctest"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newProvider(t *testing.T) (*oidctest.Provider, *oidc.Provider) {
+	mock := oidctest.NewProvider("pbe-api")
+	t.Cleanup(mock.Close)
+
+	p, err := oidc.NewProvider(context.Background(), oidc.Config{
+		Issuer:      mock.Issuer(),
+		ClientID:    "pbe-api",
+		RedirectURL: "http://localhost:8080/api/v1/auth/oidc/callback",
+		Scopes:      []string{"email", "profile"},
+	}, nil)
+	require.NoError(t, err)
+	return mock, p
+}
+
+func TestAuthorizationCodeFlowWithPKCE(t *testing.T) {
+	mock, p := newProvider(t)
+	mock.SetUser(map[string]interface{}{
+		"sub":            "u-42",
+		"email":          "budi@kampus.ac.id",
+		"email_verified": true,
+		"groups":         []string{"staff", "dosen"},
+	})
+
+	verifier, _ := oidc.NewPKCEVerifier()
+	back, err := mock.Login(p.AuthCodeURL("state-1", "nonce-1", verifier))
+	require.NoError(t, err)
+	assert.Equal(t, "state-1", back.Query().Get("state"))
+
+	claims, err := p.Exchange(context.Background(), back.Query().Get("code"), verifier, "nonce-1")
+	require.NoError(t, err)
+	assert.Equal(t, "u-42", claims.Subject)
+	assert.Equal(t, "budi@kampus.ac.id", claims.Email)
+	assert.True(t, claims.EmailVerified)
+	assert.Equal(t, []string{"staff", "dosen"}, claims.Groups)
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	mock, p := newProvider(t)
+
+	verifier, _ := oidc.NewPKCEVerifier()
+	back, err := mock.Login(p.AuthCodeURL("s", "n", verifier))
+	require.NoError(t, err)
+
+	other, _ := oidc.NewPKCEVerifier()
+	_, err = p.Exchange(context.Background(), back.Query().Get("code"), other, "n")
+	assert.Error(t, err)
+}
+
+func TestExchangeRejectsNonceMismatch(t *testing.T) {
+	mock, p := newProvider(t)
+
+	verifier, _ := oidc.NewPKCEVerifier()
+	back, err := mock.Login(p.AuthCodeURL("s", "nonce-a", verifier))
+	require.NoError(t, err)
+
+	_, err = p.Exchange(context.Background(), back.Query().Get("code"), verifier, "nonce-b")
+	assert.True(t, errors.Is(err, oidc.ErrNonceMismatch))
+}
+
+func TestVerifyIDTokenChecksAudienceAndExpiry(t *testing.T) {
+	mock, p := newProvider(t)
+	now := time.Now()
+
+	wrongAud := mock.SignIDToken(jwt.MapClaims{
+		"iss": mock.Issuer(), "aud": "someone-else", "sub": "x",
+		"iat": now.Unix(), "exp": now.Add(time.Minute).Unix(),
+	})
+	_, err := p.VerifyIDToken(context.Background(), wrongAud, "")
+	assert.True(t, errors.Is(err, oidc.ErrInvalidIDToken))
+
+	expired := mock.SignIDToken(jwt.MapClaims{
+		"iss": mock.Issuer(), "aud": "pbe-api", "sub": "x",
+		"iat": now.Add(-time.Hour).Unix(), "exp": now.Add(-10 * time.Minute).Unix(),
+	})
+	_, err = p.VerifyIDToken(context.Background(), expired, "")
+	assert.True(t, errors.Is(err, oidc.ErrInvalidIDToken))
+
+	wrongIssuer := mock.SignIDToken(jwt.MapClaims{
+		"iss": "https://evil.example", "aud": "pbe-api", "sub": "x",
+		"iat": now.Unix(), "exp": now.Add(time.Minute).Unix(),
+	})
+	_, err = p.VerifyIDToken(context.Background(), wrongIssuer, "")
+	assert.True(t, errors.Is(err, oidc.ErrInvalidIDToken))
+}
@@ -0,0 +1,121 @@
+package route
+
+import (
+	"sort"
+	"sync"
+
+	"clean-arch/app/model"
+	"clean-arch/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	manifestMu sync.RWMutex
+	manifest   []model.Endpoint
+)
+
+// registry registers routes on a fiber router and records each one (with
+// its required permissions) in the manifest. A non-empty permission is
+// enforced with middleware.RequirePermission ahead of the handlers; Handle
+// takes an anyOf/allOf requirement for routes needing several.
+type registry struct {
+	router fiber.Router
+	prefix string
+	public bool
+}
+
+func newRegistry(router fiber.Router, prefix string, public bool) registry {
+	return registry{router: router, prefix: prefix, public: public}
+}
+
+// requirement is a set of permissions checked in middleware.ModeAny or ModeAll.
+type requirement struct {
+	mode  string
+	perms []string
+}
+
+// anyOf requires at least one of perms.
+func anyOf(perms ...string) requirement {
+	return requirement{mode: middleware.ModeAny, perms: perms}
+}
+
+// allOf requires every one of perms.
+func allOf(perms ...string) requirement {
+	return requirement{mode: middleware.ModeAll, perms: perms}
+}
+
+func (r registry) add(method, path, perm string, handlers ...fiber.Handler) {
+	if perm != "" {
+		handlers = append([]fiber.Handler{middleware.RequirePermission(perm)}, handlers...)
+	}
+	r.record(model.Endpoint{Method: method, Path: r.prefix + path, Permission: perm, Public: r.public}, path, handlers)
+}
+
+// Handle registers a route guarded by a multi-permission requirement.
+func (r registry) Handle(method, path string, req requirement, handlers ...fiber.Handler) {
+	guard := middleware.RequireAllPermissions(req.perms...)
+	if req.mode == middleware.ModeAny {
+		guard = middleware.RequireAnyPermission(req.perms...)
+	}
+	handlers = append([]fiber.Handler{guard}, handlers...)
+	r.record(model.Endpoint{
+		Method:         method,
+		Path:           r.prefix + path,
+		Permissions:    req.perms,
+		PermissionMode: req.mode,
+		Public:         r.public,
+	}, path, handlers)
+}
+
+func (r registry) record(e model.Endpoint, path string, handlers []fiber.Handler) {
+	r.router.Add(e.Method, path, handlers...)
+
+	manifestMu.Lock()
+	manifest = append(manifest, e)
+	manifestMu.Unlock()
+}
+
+func (r registry) Get(path, perm string, handlers ...fiber.Handler) {
+	r.add(fiber.MethodGet, path, perm, handlers...)
+}
+
+func (r registry) Post(path, perm string, handlers ...fiber.Handler) {
+	r.add(fiber.MethodPost, path, perm, handlers...)
+}
+
+func (r registry) Put(path, perm string, handlers ...fiber.Handler) {
+	r.add(fiber.MethodPut, path, perm, handlers...)
+}
+
+func (r registry) Delete(path, perm string, handlers ...fiber.Handler) {
+	r.add(fiber.MethodDelete, path, perm, handlers...)
+}
+
+// Endpoints returns the routes recorded by the last RegisterAPIRoutes call,
+// sorted by path and method.
+func Endpoints() []model.Endpoint {
+	manifestMu.RLock()
+	out := append([]model.Endpoint(nil), manifest...)
+	manifestMu.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Path != out[j].Path {
+			return out[i].Path < out[j].Path
+		}
+		return out[i].Method < out[j].Method
+	})
+	return out
+}
+
+// Manifest registers the API on a throwaway app and returns its endpoints,
+// for tools (the permissions CLI) that don't serve HTTP.
+func Manifest() []model.Endpoint {
+	RegisterAPIRoutes(fiber.New())
+	return Endpoints()
+}
+
+func resetManifest() {
+	manifestMu.Lock()
+	manifest = nil
+	manifestMu.Unlock()
+}
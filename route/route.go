@@ -9,113 +9,217 @@ import (
 )
 
 // RegisterAPIRoutes registers all API endpoints according to the SRS.
+// Routes go through registry so each one is recorded with the permission it
+// requires (see Endpoints); permission strings are never passed to
+// middleware.RequirePermission directly.
 func RegisterAPIRoutes(app *fiber.App) {
-	// Public group (no JWT) - only auth login & refresh
-	public := app.Group("/api/v1")
-	public.Post("/auth/login", svc.AuthenticateService)
-	public.Post("/auth/refresh", svc.RefreshTokenService) // optional: allow token refresh without middleware
+	resetManifest()
+
+	// Public JWKS so other services can verify our tokens
+	newRegistry(app, "", true).Get("/.well-known/jwks.json", "", middleware.JWKSHandler)
+
+	// Public group (no JWT) - auth login, refresh, password reset, mfa step, sso & invitations
+	public := newRegistry(app.Group("/api/v1"), "/api/v1", true)
+	public.Post("/auth/login", "", svc.AuthenticateService)
+	public.Post("/auth/refresh", "", svc.RefreshTokenService) // optional: allow token refresh without middleware
+	public.Post("/auth/forgot-password", "", svc.ForgotPasswordService)
+	public.Post("/auth/reset-password", "", svc.ResetPasswordService)
+	// second login step (mfa_token from /auth/login)
+	public.Post("/auth/mfa/verify", "", svc.MFAVerifyService)
+	public.Post("/auth/mfa/setup", "", svc.MFASetupService)
+	public.Post("/auth/mfa/setup/confirm", "", svc.MFASetupConfirmService)
+	// single sign-on against the campus identity provider (OIDC)
+	public.Get("/auth/oidc/login", "", svc.OIDCLoginService)
+	public.Get("/auth/oidc/callback", "", svc.OIDCCallbackService)
+	// invitation-based activation
+	public.Get("/auth/invitation", "", svc.GetInvitationService)
+	public.Post("/auth/accept-invitation", "", svc.AcceptInvitationService)
 
 	// Protected group (JWT required)
-	protected := app.Group("/api/v1", middleware.JWTMiddleware())
+	protected := newRegistry(app.Group("/api/v1", middleware.JWTMiddleware()), "/api/v1", false)
 
 	// ----------------------
 	// Auth (protected endpoints)
+	// - credential / security settings are refused to impersonation tokens
 	// ----------------------
-	protected.Post("/auth/logout", svc.LogoutService)
-	protected.Get("/auth/profile", svc.ProfileService)
+	protected.Post("/auth/logout", "", svc.LogoutService)
+	protected.Get("/auth/profile", "", svc.ProfileService)
+	protected.Put("/auth/password", "", middleware.DenyImpersonation, svc.ChangePasswordService)
+	protected.Post("/auth/mfa/enroll", "", middleware.DenyImpersonation, svc.MFAEnrollService)
+	protected.Post("/auth/mfa/confirm", "", middleware.DenyImpersonation, svc.MFAConfirmService)
+	protected.Post("/auth/mfa/disable", "", middleware.DenyImpersonation, svc.MFADisableService)
+	protected.Get("/auth/sessions", "", svc.ListMySessionsService)
+	protected.Delete("/auth/sessions/:id", "", middleware.DenyImpersonation, svc.RevokeMySessionService)
+	// personal access tokens ("Authorization: Bearer pbe_pat_...")
+	protected.Post("/auth/tokens", "", middleware.DenyImpersonation, svc.CreateMyAPITokenService)
+	protected.Get("/auth/tokens", "", svc.ListMyAPITokensService)
+	protected.Delete("/auth/tokens/:id", "", middleware.DenyImpersonation, svc.RevokeMyAPITokenService)
 
 	// ----------------------
 	// Users (Admin)
 	// ----------------------
 	// CRUD + assign role
-	protected.Get("/users", middleware.RequirePermission("users.list"), svc.ListUsersService)
-	protected.Get("/users/:id", middleware.RequirePermission("users.view"), svc.GetUserByIDService)
-	protected.Post("/users", middleware.RequirePermission("users.create"), svc.CreateUserService)
-	protected.Put("/users/:id", middleware.RequirePermission("users.update"), svc.UpdateUserService)
-	protected.Delete("/users/:id", middleware.RequirePermission("users.delete"), svc.DeleteUserService)
-	protected.Put("/users/:id/role", middleware.RequirePermission("users.assign_role"), svc.AssignRoleService)
+	protected.Get("/users", "users.list", svc.ListUsersService)
+	protected.Get("/users/:id", "users.view", svc.GetUserByIDService)
+	protected.Post("/users", "users.create", svc.CreateUserService)
+	protected.Put("/users/:id", "users.update", svc.UpdateUserService)
+	protected.Delete("/users/:id", "users.delete", svc.DeleteUserService)
+	protected.Put("/users/:id/role", "users.assign_role", svc.AssignRoleService)
+	protected.Post("/users/invitations", "users.create", svc.BulkInviteUsersService)
+	protected.Post("/users/:id/invitation", "users.create", svc.ResendInvitationService)
+	protected.Delete("/users/:id/invitation", "users.create", svc.RevokeInvitationService)
+	protected.Post("/users/:id/unlock", "users.unlock", svc.UnlockUserService)
+	protected.Get("/users/:id/sessions", "users.sessions", svc.ListUserSessionsService)
+	protected.Delete("/users/:id/sessions", "users.sessions", svc.RevokeAllUserSessionsService)
+	protected.Delete("/users/:id/sessions/:sid", "users.sessions", svc.RevokeUserSessionService)
+	// "log in as": short-lived token for the target, audited (no nesting)
+	protected.Post("/users/:id/impersonate", "users.impersonate", middleware.DenyImpersonation, svc.ImpersonateUserService)
+	protected.Get("/audit/impersonations", "users.impersonate", svc.ListImpersonationAuditService)
+
+	// ----------------------
+	// Service accounts (non-human users, API tokens only)
+	// ----------------------
+	protected.Post("/service-accounts", "service_accounts.manage", svc.CreateServiceAccountService)
+	protected.Get("/service-accounts", "service_accounts.manage", svc.ListServiceAccountsService)
+	protected.Post("/service-accounts/:id/tokens", "service_accounts.manage", svc.CreateServiceAccountTokenService)
+	protected.Get("/service-accounts/:id/tokens", "service_accounts.manage", svc.ListServiceAccountTokensService)
+	protected.Delete("/service-accounts/:id/tokens/:tid", "service_accounts.manage", svc.RevokeServiceAccountTokenService)
 
 	// ----------------------
 	// Roles
 	// ----------------------
-	protected.Post("/roles", middleware.RequirePermission("roles.create"), svc.CreateRoleService)
-	protected.Get("/roles/:name", middleware.RequirePermission("roles.view"), svc.GetRoleByNameService)
+	protected.Get("/roles", "roles.view", svc.ListRolesService)
+	protected.Post("/roles", "roles.create", svc.CreateRoleService)
+	protected.Get("/roles/:name", "roles.view", svc.GetRoleByNameService)
+	protected.Put("/roles/:id", "roles.update", svc.UpdateRoleService)
+	protected.Delete("/roles/:id", "roles.delete", svc.DeleteRoleService)
+	protected.Post("/roles/:id/reassign", "users.assign_role", svc.ReassignRoleUsersService)
+	protected.Put("/roles/:id/mfa", "roles.update", svc.SetRoleMFARequirementService)
+	protected.Get("/roles/:id/permissions", "roles.view", svc.ListRolePermissionsService)
+	protected.Post("/roles/:id/permissions", "roles.assign_permission", svc.GrantRolePermissionService)
+	protected.Delete("/roles/:id/permissions/:permId", "roles.assign_permission", svc.RevokeRolePermissionService)
+	protected.Get("/roles/:id/parents", "roles.view", svc.ListRoleParentsService)
+	protected.Post("/roles/:id/parents", "roles.assign_permission", svc.AddRoleParentService)
+	protected.Delete("/roles/:id/parents/:parentId", "roles.assign_permission", svc.RemoveRoleParentService)
+
+	// ----------------------
+	// Permissions
+	// ----------------------
+	protected.Get("/permissions", "permissions.list", svc.ListPermissionsService)
+	protected.Get("/permissions/:id", "permissions.list", svc.GetPermissionService)
+	protected.Post("/permissions", "permissions.create", svc.CreatePermissionService)
+	protected.Put("/permissions/:id", "permissions.update", svc.UpdatePermissionService)
+	protected.Delete("/permissions/:id", "permissions.delete", svc.DeletePermissionService)
+	protected.Get("/authz/cache", "permissions.list", svc.PermCacheStatsService)
+	protected.Get("/authz/explain", "permissions.list", svc.ExplainAuthzService)
+	// route manifest: every endpoint and the permission guarding it
+	protected.Get("/endpoints", "permissions.list", func(c *fiber.Ctx) error {
+		return svc.ListEndpointsService(c, Endpoints())
+	})
 
 	// ----------------------
 	// Achievements (Mongo) + reference workflow (Postgres)
 	// - Many handlers accept database.MongoDB (mongo.Database) parameter via closure
 	// ----------------------
-	protected.Get("/achievements", middleware.RequirePermission("achievements.list"), func(c *fiber.Ctx) error {
+	protected.Get("/achievements", "achievements.list", func(c *fiber.Ctx) error {
 		return svc.ListAchievementsService(c, database.MongoDB)
 	})
-	protected.Get("/achievements/:id", middleware.RequirePermission("achievements.view"), func(c *fiber.Ctx) error {
+	protected.Get("/achievements/:id", "achievements.view", func(c *fiber.Ctx) error {
 		return svc.GetAchievementService(c, database.MongoDB)
 	})
-	protected.Post("/achievements", middleware.RequirePermission("achievements.create"), func(c *fiber.Ctx) error {
+	protected.Post("/achievements", "achievements.create", func(c *fiber.Ctx) error {
 		return svc.CreateAchievementService(c, database.MongoDB)
 	})
-	protected.Put("/achievements/:id", middleware.RequirePermission("achievements.update"), func(c *fiber.Ctx) error {
+	protected.Put("/achievements/:id", "achievements.update", func(c *fiber.Ctx) error {
 		return svc.UpdateAchievementService(c, database.MongoDB)
 	})
-	protected.Delete("/achievements/:id", middleware.RequirePermission("achievements.delete"), func(c *fiber.Ctx) error {
+	// admin edits outside the student workflow, audited
+	protected.Put("/achievements/:id/override", "achievements.override", func(c *fiber.Ctx) error {
+		return svc.OverrideAchievementService(c, database.MongoDB)
+	})
+	protected.Get("/achievements/:id/overrides", "achievements.override", svc.ListAchievementOverridesService)
+	protected.Delete("/achievements/:id", "achievements.delete", func(c *fiber.Ctx) error {
 		return svc.DeleteAchievementService(c, database.MongoDB)
 	})
 	// Hard delete (admin)
-	protected.Delete("/achievements/:id/permanent", middleware.RequirePermission("achievements.hard_delete"), func(c *fiber.Ctx) error {
+	protected.Delete("/achievements/:id/permanent", "achievements.hard_delete", func(c *fiber.Ctx) error {
 		return svc.HardDeleteAchievementService(c, database.MongoDB)
 	})
 
 	// Submit / verify / reject flows (these operate by linking mongo doc -> postgres reference)
-	protected.Post("/achievements/:id/submit", middleware.RequirePermission("achievements.submit"), func(c *fiber.Ctx) error {
+	protected.Post("/achievements/:id/submit", "achievements.submit", func(c *fiber.Ctx) error {
 		return svc.SubmitAchievementService(c, database.MongoDB)
 	})
-	protected.Post("/achievements/:id/verify", middleware.RequirePermission("achievements.verify"), func(c *fiber.Ctx) error {
+	protected.Post("/achievements/:id/verify", "achievements.verify", func(c *fiber.Ctx) error {
 		return svc.VerifyAchievementService(c, database.MongoDB)
 	})
-	protected.Post("/achievements/:id/reject", middleware.RequirePermission("achievements.reject"), func(c *fiber.Ctx) error {
+	protected.Post("/achievements/:id/reject", "achievements.reject", func(c *fiber.Ctx) error {
 		return svc.RejectAchievementService(c, database.MongoDB)
 	})
+	protected.Post("/achievements/:id/request-revision", "achievements.request_revision", func(c *fiber.Ctx) error {
+		return svc.RequestRevisionService(c, database.MongoDB)
+	})
+	protected.Get("/achievements/:id/review-comments", "achievements.view", func(c *fiber.Ctx) error {
+		return svc.ListReviewCommentsService(c, database.MongoDB)
+	})
+	protected.Post("/achievements/:id/review-comments/:commentId/resolve", "achievements.submit", func(c *fiber.Ctx) error {
+		return svc.ResolveReviewCommentService(c, database.MongoDB)
+	})
 
 	// Status history (reads from Postgres references)
-	protected.Get("/achievements/:id/history", middleware.RequirePermission("achievements.history"), func(c *fiber.Ctx) error {
+	protected.Get("/achievements/:id/history", "achievements.history", func(c *fiber.Ctx) error {
 		return svc.GetAchievementHistoryService(c, database.MongoDB)
 	})
+	// Document versions (immutable snapshots; diff is registered before :version)
+	protected.Get("/achievements/:id/versions", "achievements.history", func(c *fiber.Ctx) error {
+		return svc.ListAchievementVersionsService(c, database.MongoDB)
+	})
+	protected.Get("/achievements/:id/versions/diff", "achievements.history", func(c *fiber.Ctx) error {
+		return svc.DiffAchievementVersionsService(c, database.MongoDB)
+	})
+	protected.Get("/achievements/:id/versions/:version", "achievements.history", func(c *fiber.Ctx) error {
+		return svc.GetAchievementVersionService(c, database.MongoDB)
+	})
 
 	// Attachments upload & list (mongo-backed attachments collection or GridFS)
-	protected.Post("/achievements/:id/attachments", middleware.RequirePermission("achievements.upload_attachment"), func(c *fiber.Ctx) error {
+	protected.Post("/achievements/:id/attachments", "achievements.upload_attachment", func(c *fiber.Ctx) error {
 		return svc.AddAttachmentService(c, database.MongoDB)
 	})
-	protected.Get("/achievements/:id/attachments", middleware.RequirePermission("achievements.view_attachments"), func(c *fiber.Ctx) error {
+	protected.Get("/achievements/:id/attachments", "achievements.view_attachments", func(c *fiber.Ctx) error {
 		return svc.ListAttachmentsService(c, database.MongoDB)
 	})
 
 	// ----------------------
 	// Achievement References (Postgres) - alternate entry (if needed)
 	// ----------------------
-	protected.Post("/refs", middleware.RequirePermission("refs.create"), svc.CreateAchievementReferenceService)
-	protected.Post("/refs/:id/submit", middleware.RequirePermission("refs.submit"), svc.SubmitAchievementReferenceService)
-	protected.Post("/refs/:id/verify", middleware.RequirePermission("refs.verify"), svc.VerifyAchievementReferenceService)
-	protected.Post("/refs/:id/reject", middleware.RequirePermission("refs.reject"), svc.RejectAchievementReferenceService)
+	protected.Post("/refs", "refs.create", func(c *fiber.Ctx) error {
+		return svc.CreateAchievementReferenceService(c, database.MongoDB)
+	})
+	protected.Post("/refs/:id/submit", "refs.submit", svc.SubmitAchievementReferenceService)
+	protected.Post("/refs/:id/verify", "refs.verify", func(c *fiber.Ctx) error {
+		return svc.VerifyAchievementReferenceService(c, database.MongoDB)
+	})
+	protected.Post("/refs/:id/reject", "refs.reject", svc.RejectAchievementReferenceService)
 
 	// ----------------------
 	// Students & Lecturers
 	// ----------------------
 	// Students
-	protected.Post("/students", middleware.RequirePermission("students.create"), svc.CreateStudentService)
-	protected.Get("/students", middleware.RequirePermission("students.list"), svc.ListStudentsByAdvisorService) // NOTE: this route could be adapted to list all or by query
-	protected.Get("/students/:id", middleware.RequirePermission("students.view"), svc.GetStudentService)
-	protected.Get("/students/:id/achievements", middleware.RequirePermission("students.read_achievements"), svc.GetStudentAchievementsService)
-	protected.Put("/students/:id/advisor", middleware.RequirePermission("students.set_advisor"), svc.SetStudentAdvisorService)
+	protected.Post("/students", "students.create", svc.CreateStudentService)
+	protected.Get("/students", "students.list", svc.ListStudentsByAdvisorService) // NOTE: this route could be adapted to list all or by query
+	protected.Get("/students/:id", "students.view", svc.GetStudentService)
+	protected.Get("/students/:id/achievements", "students.read_achievements", svc.GetStudentAchievementsService)
+	protected.Put("/students/:id/advisor", "students.set_advisor", svc.SetStudentAdvisorService)
 
 	// Lecturers
-	protected.Post("/lecturers", middleware.RequirePermission("lecturers.create"), svc.CreateLecturerService)
-	protected.Get("/lecturers", middleware.RequirePermission("lecturers.list"), svc.ListLecturersService)
-	protected.Get("/lecturers/:id", middleware.RequirePermission("lecturers.view"), svc.GetLecturerService)
-	protected.Get("/lecturers/:id/advisees", middleware.RequirePermission("lecturers.view_advisees"), svc.GetLecturerAdviseesService)
+	protected.Post("/lecturers", "lecturers.create", svc.CreateLecturerService)
+	protected.Get("/lecturers", "lecturers.list", svc.ListLecturersService)
+	protected.Get("/lecturers/:id", "lecturers.view", svc.GetLecturerService)
+	protected.Get("/lecturers/:id/advisees", "lecturers.view_advisees", svc.GetLecturerAdviseesService)
 
 	// ----------------------
 	// Reports & Analytics
 	// ----------------------
-	protected.Get("/reports/statistics", middleware.RequirePermission("reports.read"), svc.StatisticsService)
-	protected.Get("/reports/student/:id", middleware.RequirePermission("reports.read"), svc.StudentReportService)
+	protected.Get("/reports/statistics", "reports.read", svc.StatisticsService)
+	protected.Get("/reports/student/:id", "reports.read", svc.StudentReportService)
 }
@@ -0,0 +1,60 @@
+package route
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"clean-arch/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+var permissionName = regexp.MustCompile(`^[a-z_]+\.[a-z_]+$`)
+
+func TestManifest_RecordsPermissions(t *testing.T) {
+	endpoints := Manifest()
+	assert.NotEmpty(t, endpoints)
+
+	seen := map[string]bool{}
+	for _, e := range endpoints {
+		key := e.Method + " " + e.Path
+		assert.False(t, seen[key], "registered twice: %s", key)
+		seen[key] = true
+
+		for _, p := range e.RequiredPermissions() {
+			assert.Regexp(t, permissionName, p, key)
+			assert.False(t, e.Public, "public route with a permission: %s", key)
+		}
+	}
+	assert.True(t, seen["GET /api/v1/users"])
+	assert.True(t, seen["POST /api/v1/auth/login"])
+}
+
+func TestRegistry_MultiPermissionRoutes(t *testing.T) {
+	resetManifest()
+	defer resetManifest()
+	middleware.SetCachedPerms("role-reg", []string{"reports.read"}, 0)
+	defer middleware.InvalidateCachedPerms("role-reg")
+
+	app := fiber.New()
+	r := newRegistry(app.Group("/x", func(c *fiber.Ctx) error {
+		c.Locals(middleware.LocalsRoleID, "role-reg")
+		return c.Next()
+	}), "/x", false)
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+	r.Handle(fiber.MethodGet, "/any", anyOf("reports.read", "reports.export"), ok)
+	r.Handle(fiber.MethodGet, "/all", allOf("reports.read", "reports.export"), ok)
+
+	endpoints := Endpoints()
+	assert.Equal(t, []string{"reports.read", "reports.export"}, endpoints[0].RequiredPermissions())
+	assert.Equal(t, middleware.ModeAll, endpoints[0].PermissionMode)
+	assert.Equal(t, middleware.ModeAny, endpoints[1].PermissionMode)
+	assert.Empty(t, endpoints[1].Permission)
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/x/any", nil))
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	resp, _ = app.Test(httptest.NewRequest("GET", "/x/all", nil))
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+}